@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// listAccounts implements the 'list-accounts' subcommand, which prints the
+// accounts Prism knows about, optionally filtered. VPCs are only fetched with
+// '-vpc-counts' (or '-include-empty-vpcs'), in which case accounts without any
+// are left out unless '-include-empty-vpcs' is set, as they're usually the
+// ones with missing infrastructure. Unlike 'generate' it lists every account
+// by default.
+func listAccounts(args []string) {
+	fs := flag.NewFlagSet("list-accounts", flag.ExitOnError)
+	env := fs.String("env", "prod", "Prism environment: code, local or prod")
+	prismURLOverride := fs.String("prism-url", "", "Prism base URL; overrides -env")
+	accountsURL := fs.String("accounts-url", "", "full URL of the accounts endpoint (default: derived from the Prism base URL)")
+	configPath := fs.String("config", "", "YAML config file, for its prismUrl")
+	nameRegexFlag := fs.String("account-name-regex", "", "only list accounts whose name matches this regular expression, e.g. '-prod$'")
+	ou := fs.String("ou", "", "only list accounts in this organisational unit")
+	excludeAccountsFlag := fs.String("exclude-accounts", "", "comma-separated account names or numbers to leave out")
+	includeInactive := fs.Bool("include-inactive-accounts", false, "also list accounts that Prism reports as suspended or closed")
+	vpcCounts := fs.Bool("vpc-counts", false, "also fetch VPCs and show how many each account has, leaving out accounts with none")
+	includeEmpty := fs.Bool("include-empty-vpcs", false, "with VPC counts (implies -vpc-counts), also list accounts with no VPCs, marked as such")
+	format := fs.String("format", "text", "output format: text (a table) or json")
+	timeout := fs.Duration("timeout", 0, "time limit for the request, e.g. 30s (0 for none)")
+	fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		usagef("-format must be text or json, not %q", *format)
+	}
+
+	var nameRegex *regexp.Regexp
+	if *nameRegexFlag != "" {
+		var err error
+		nameRegex, err = regexp.Compile(*nameRegexFlag)
+		if err != nil {
+			usagef("invalid -account-name-regex: %v", err)
+		}
+	}
+
+	urlOverride := *prismURLOverride
+	if urlOverride == "" && *configPath != "" {
+		config, err := loadConfig(*configPath)
+		check(err, "unable to load config")
+		urlOverride = config.PrismURL
+	}
+
+	baseURL, err := prismURL(*env, urlOverride)
+	check(err, "invalid prism environment")
+
+	for _, u := range []struct{ name, url string }{{"Prism URL", baseURL}, {"-accounts-url", *accountsURL}} {
+		if u.url == "" {
+			continue
+		}
+		if err := validateURL(u.url); err != nil {
+			usagef("invalid %s: %v", u.name, err)
+		}
+	}
+
+	client, err := newHTTPClient(ClientOptions{})
+	check(err, "unable to create HTTP client")
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	prism := Prism{
+		BaseURL:     baseURL,
+		AccountsURL: *accountsURL,
+		Client:      client,
+		Retries:     2,
+		Backoff:     newBackoff(500*time.Millisecond, 10*time.Second, 0.2, time.Now().UnixNano()),
+	}
+	accounts, err := prism.getAccounts(ctx)
+	check(err, "unable to fetch accounts")
+
+	accounts, _ = filterAccounts(accounts, AccountFilter{
+		NameRegex:       nameRegex,
+		OU:              *ou,
+		IncludeInactive: *includeInactive,
+		Exclude:         splitList(*excludeAccountsFlag),
+	})
+
+	// nil if VPCs weren't asked for, which leaves out the VPCS column.
+	var counts map[AccountID]int
+	if *vpcCounts || *includeEmpty {
+		vpcs, err := prism.getVPCs(ctx)
+		check(err, "unable to fetch vpcs")
+
+		counts = vpcCountsByAccount(accounts, vpcs)
+		if !*includeEmpty {
+			accounts = slices.DeleteFunc(accounts, func(a PrismAccount) bool { return counts[AccountID(a.AccountNumber)] == 0 })
+		}
+	}
+
+	slices.SortFunc(accounts, func(a, b PrismAccount) int { return strings.Compare(a.AccountName, b.AccountName) })
+
+	if *format == "json" {
+		err = printAccountsJSON(os.Stdout, accounts, counts)
+	} else {
+		err = printAccountsTable(os.Stdout, accounts, counts)
+	}
+	check(err, "unable to write accounts")
+}
+
+// AccountFilter narrows down a list of accounts, for 'list-accounts' and for
+// the accounts generate was asked for. The zero value keeps every active
+// account.
+type AccountFilter struct {
+	NameRegex       *regexp.Regexp
+	OU              string
+	IncludeInactive bool
+	// Account names or numbers to leave out.
+	Exclude []string
+}
+
+// filterAccounts returns the accounts that pass the filter, and those that
+// don't along with why (for '-show-skipped').
+func filterAccounts(accounts []PrismAccount, filter AccountFilter) ([]PrismAccount, []SkippedAccount) {
+	var inOU []string
+	hasOU := false
+	if filter.OU != "" {
+		inOU, hasOU = accountsInOU(accounts, filter.OU)
+	}
+
+	out := []PrismAccount{}
+	skipped := []SkippedAccount{}
+	excluded := map[string]bool{}
+	skip := func(account PrismAccount, reason string) {
+		skipped = append(skipped, SkippedAccount{Account: account.AccountName, Reason: reason})
+	}
+
+	for _, account := range accounts {
+		// Exclusions are recorded before the other filters, so that an
+		// account left out by one of those too isn't reported as an unused
+		// exclusion.
+		isExcluded := false
+		for _, key := range []string{account.AccountName, account.AccountNumber} {
+			if slices.Contains(filter.Exclude, key) {
+				excluded[key] = true
+				isExcluded = true
+			}
+		}
+
+		switch {
+		case filter.NameRegex != nil && !filter.NameRegex.MatchString(account.AccountName):
+			skip(account, "doesn't match -account-name-regex")
+		case hasOU && !slices.Contains(inOU, account.AccountName):
+			skip(account, "not in organisational unit "+filter.OU)
+		case !filter.IncludeInactive && !account.IsActive():
+			logVerbose("skipping %s as its status is %s", account.AccountName, account.Status)
+			skip(account, "account status is "+account.Status)
+		case isExcluded:
+			skip(account, "in -exclude-accounts")
+		default:
+			out = append(out, account)
+		}
+	}
+
+	for _, name := range filter.Exclude {
+		if !excluded[name] {
+			warnf("", "excluded account %s was not among the selected accounts", name)
+		}
+	}
+
+	return out, skipped
+}
+
+// AccountRequest is which accounts generate was asked to process. Accounts can
+// come from several sources, which are combined.
+type AccountRequest struct {
+	// Account names, numbers or aliases, e.g. from '-accounts'.
+	Names []string
+	// Adds the accounts in this organisational unit.
+	OU string
+	// Adds every account.
+	All bool
+	// Adds the accounts whose name matches.
+	NameRegex *regexp.Regexp
+	Aliases   map[string]string
+	// Makes several accounts sharing a requested name an error, rather than
+	// a warning.
+	Strict bool
+}
+
+// AmbiguousAccountError is returned by selectAccounts with Strict, for a
+// requested name that several accounts have.
+type AmbiguousAccountError struct {
+	Name    string
+	Numbers []string
+}
+
+func (e *AmbiguousAccountError) Error() string {
+	return fmt.Sprintf("%d accounts are named %s (%s); using %s - specify an account number to disambiguate", len(e.Numbers), e.Name, strings.Join(e.Numbers, ", "), e.Numbers[0])
+}
+
+// selectAccounts works out which of 'accounts' were requested, and narrows
+// them down with 'filter'. It also returns every account that was left out
+// and why, for '-show-skipped': requested ones that Prism doesn't have,
+// those the filter rejected, and those that weren't requested at all.
+func selectAccounts(accounts []PrismAccount, request AccountRequest, filter AccountFilter) ([]PrismAccount, []SkippedAccount, error) {
+	names := request.Names
+
+	if request.OU != "" {
+		if inOU, ok := accountsInOU(accounts, request.OU); ok {
+			names = union(names, inOU)
+		}
+	}
+
+	// Numbers rather than names are used, so that accounts sharing a name
+	// can be told apart.
+	numbers := []string{}
+	for _, account := range accounts {
+		if request.All || (request.NameRegex != nil && request.NameRegex.MatchString(account.AccountName)) {
+			numbers = append(numbers, account.AccountNumber)
+		}
+	}
+	names = union(names, numbers)
+
+	lookup := prism.NewAccountLookup(accounts)
+	names = union(resolveAliases(names, request.Aliases, lookup))
+
+	requested := []PrismAccount{}
+	skipped := []SkippedAccount{}
+	for _, name := range names {
+		if matches := lookup.AccountsNamed(name); len(matches) > 1 {
+			err := &AmbiguousAccountError{Name: name}
+			for _, m := range matches {
+				err.Numbers = append(err.Numbers, m.AccountNumber)
+			}
+
+			if request.Strict {
+				return nil, nil, err
+			}
+			warnf(name, "%v", err)
+		}
+
+		account, ok := lookup.GetAccountByName(name)
+		if !ok {
+			account, ok = lookup.GetAccountByNumber(name)
+		}
+
+		if !ok {
+			warnf(name, "account not found in prism")
+			skipped = append(skipped, SkippedAccount{Account: name, Reason: "not found in prism"})
+			continue
+		}
+
+		if slices.IndexFunc(requested, func(a PrismAccount) bool { return a.AccountNumber == account.AccountNumber }) != -1 {
+			continue
+		}
+
+		requested = append(requested, account)
+	}
+
+	selected, filtered := filterAccounts(requested, filter)
+	skipped = append(skipped, filtered...)
+
+	for _, account := range accounts {
+		if slices.IndexFunc(requested, func(a PrismAccount) bool { return a.AccountNumber == account.AccountNumber }) == -1 {
+			skipped = append(skipped, SkippedAccount{Account: account.AccountName, Reason: "not requested"})
+		}
+	}
+
+	return selected, skipped, nil
+}
+
+// vpcCountsByAccount returns how many VPCs each account has, including a zero
+// for accounts with none.
+func vpcCountsByAccount(accounts []PrismAccount, vpcs map[AccountID][]PrismVPC) map[AccountID]int {
+	counts := make(map[AccountID]int, len(accounts))
+	for _, a := range accounts {
+		counts[AccountID(a.AccountNumber)] = len(vpcs[AccountID(a.AccountNumber)])
+	}
+
+	return counts
+}
+
+// printAccountsTable prints one account per line in aligned columns, with a
+// VPCS column if 'counts' isn't nil. tabwriter is Go's built-in way of lining
+// up text, a bit like a very simple version of a table formatting library.
+func printAccountsTable(w io.Writer, accounts []PrismAccount, counts map[AccountID]int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if counts == nil {
+		fmt.Fprintln(tw, "NAME\tNUMBER\tOU\tSTATUS")
+	} else {
+		fmt.Fprintln(tw, "NAME\tNUMBER\tOU\tSTATUS\tVPCS")
+	}
+
+	for _, a := range accounts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s", a.AccountName, a.AccountNumber, valueOr(a.OrganizationalUnit, "-"), valueOr(a.Status, "-"))
+		if counts != nil {
+			if n := counts[AccountID(a.AccountNumber)]; n == 0 {
+				fmt.Fprint(tw, "\tnone")
+			} else {
+				fmt.Fprintf(tw, "\t%d", n)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// AccountListing is an account in the JSON output of 'list-accounts'. The
+// count is a pointer so that it's left out when VPCs weren't fetched, but an
+// account without VPCs still shows a zero.
+type AccountListing struct {
+	PrismAccount
+	VPCCount *int `json:"vpcCount,omitempty"`
+}
+
+func printAccountsJSON(w io.Writer, accounts []PrismAccount, counts map[AccountID]int) error {
+	listings := make([]AccountListing, 0, len(accounts))
+	for _, a := range accounts {
+		listing := AccountListing{PrismAccount: a}
+		if n, ok := counts[AccountID(a.AccountNumber)]; ok {
+			listing.VPCCount = &n
+		}
+		listings = append(listings, listing)
+	}
+
+	out, err := json.MarshalIndent(listings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
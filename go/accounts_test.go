@@ -0,0 +1,704 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+func testAccounts(n int) []PrismAccount {
+	accounts := make([]PrismAccount, n)
+	for i := range accounts {
+		accounts[i] = PrismAccount{AccountNumber: fmt.Sprint(100 + i), AccountName: fmt.Sprintf("account-%d", i)}
+	}
+
+	return accounts
+}
+
+func TestDuplicateAccountNames(t *testing.T) {
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "deploy-tools"}
+	]`, "[]")
+
+	out, err := runMain(t, "-prism-url", server.URL, "-format", "ndjson")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if want := "2 accounts are named deploy-tools (111, 222); using 111"; !strings.Contains(out, want) {
+		t.Errorf("expected %q in the output:\n%s", want, out)
+	}
+
+	// By number, there's no ambiguity.
+	out, err = runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-accounts", "222")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if strings.Contains(out, "accounts are named") || !strings.Contains(out, `"accountNumber":"222"`) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-strict")
+	if err == nil {
+		t.Fatalf("expected -strict to fail: %s", out)
+	}
+}
+
+func TestFilterAccountsExclude(t *testing.T) {
+	logged := captureLog(t)
+
+	got, skipped := filterAccounts(testAccounts(3), AccountFilter{Exclude: []string{"account-1", "100", "missing"}})
+	if len(got) != 1 || got[0].AccountName != "account-2" {
+		t.Errorf("got %v, want just account-2", got)
+	}
+	if want := []SkippedAccount{{Account: "account-0", Reason: "in -exclude-accounts"}, {Account: "account-1", Reason: "in -exclude-accounts"}}; !slices.Equal(skipped, want) {
+		t.Errorf("got skipped %v, want %v", skipped, want)
+	}
+	if want := "excluded account missing was not among the selected accounts"; !strings.Contains(logged.String(), want) {
+		t.Errorf("got warnings %q, want %q", logged, want)
+	}
+	if strings.Count(logged.String(), "warning") != 1 {
+		t.Errorf("expected one warning, got %q", logged)
+	}
+
+	// An excluded account that another filter also leaves out, or that's
+	// excluded by both name and number, was still found, so isn't warned
+	// about.
+	logged.Reset()
+	accounts := testAccounts(3)
+	accounts[2].Status = "SUSPENDED"
+	got, skipped = filterAccounts(accounts, AccountFilter{
+		NameRegex: regexp.MustCompile(`-[12]$`),
+		Exclude:   []string{"account-0", "account-1", "101", "account-2"},
+	})
+	if len(got) != 0 {
+		t.Errorf("got %v, want none", got)
+	}
+	if want := []SkippedAccount{
+		{Account: "account-0", Reason: "doesn't match -account-name-regex"},
+		{Account: "account-1", Reason: "in -exclude-accounts"},
+		{Account: "account-2", Reason: "account status is SUSPENDED"},
+	}; !slices.Equal(skipped, want) {
+		t.Errorf("got skipped %v, want %v", skipped, want)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("unexpected warnings: %s", logged)
+	}
+}
+
+func TestExcludeAccountsFlag(t *testing.T) {
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "sandbox"},
+		{"accountNumber": "333", "accountName": "frontend"}
+	]`, "[]")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		warn string
+	}{
+		{"with -all", []string{"-all", "-exclude-accounts", "sandbox"}, []string{"111", "333"}, ""},
+		{"with -all, by number", []string{"-all", "-exclude-accounts", "222,333"}, []string{"111"}, ""},
+		{"with -accounts", []string{"-accounts", "deploy-tools,frontend", "-exclude-accounts", "frontend"}, []string{"111"}, ""},
+		{"not selected", []string{"-accounts", "deploy-tools", "-exclude-accounts", "sandbox"}, []string{"111"}, "excluded account sandbox was not among the selected accounts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runMain(t, append([]string{"-prism-url", server.URL, "-format", "ndjson"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+
+			got := regexp.MustCompile(`"accountNumber":"(\d+)"`).FindAllStringSubmatch(out, -1)
+			numbers := []string{}
+			for _, match := range got {
+				numbers = append(numbers, match[1])
+			}
+			if !slices.Equal(numbers, tt.want) {
+				t.Errorf("got accounts %v, want %v", numbers, tt.want)
+			}
+			if tt.warn != "" && !strings.Contains(out, tt.warn) {
+				t.Errorf("expected %q in the output:\n%s", tt.warn, out)
+			}
+			if tt.warn == "" && strings.Contains(out, "excluded account") {
+				t.Errorf("unexpected warning:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestAccountNameRegex(t *testing.T) {
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "frontend-prod"},
+		{"accountNumber": "333", "accountName": "frontend-dev"},
+		{"accountNumber": "444", "accountName": "backend-prod"}
+	]`, "[]")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"alone", []string{"-account-name-regex", "-prod$"}, []string{"222", "444"}},
+		{"union", []string{"-accounts", "deploy-tools", "-account-name-regex", "-prod$"}, []string{"111", "222", "444"}},
+		{"intersect", []string{"-accounts", "frontend-prod,frontend-dev", "-account-name-regex", "-prod$", "-account-name-regex-mode", "intersect"}, []string{"222"}},
+		{"intersect alone", []string{"-account-name-regex", "^frontend", "-account-name-regex-mode", "intersect"}, []string{"222", "333"}},
+		{"no matches", []string{"-all", "-account-name-regex", "-staging$", "-account-name-regex-mode", "intersect"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runMain(t, append([]string{"-prism-url", server.URL, "-format", "ndjson"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+
+			got := regexp.MustCompile(`"accountNumber":"(\d+)"`).FindAllStringSubmatch(out, -1)
+			numbers := []string{}
+			for _, match := range got {
+				numbers = append(numbers, match[1])
+			}
+			if !slices.Equal(numbers, tt.want) {
+				t.Errorf("got accounts %v, want %v", numbers, tt.want)
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"-account-name-regex", "prod("},
+		{"-account-name-regex", "prod", "-account-name-regex-mode", "both"},
+	} {
+		out, err := runMain(t, args...)
+		if err == nil || !strings.Contains(out, "invalid -account-name-regex") {
+			t.Errorf("%v: got %v: %s", args, err, out)
+		}
+	}
+}
+
+func TestInactiveAccounts(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"active only", []string{"-all"}, []string{"111111111111", "222222222222"}},
+		{"include all", []string{"-all", "-include-inactive-accounts"}, []string{"111111111111", "222222222222", "333333333333"}},
+		{"requested by name", []string{"-accounts", "old-one,frontend"}, []string{"222222222222"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runMain(t, append([]string{"-prism-url", server.URL, "-format", "ndjson", "-verbose", "-show-skipped"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+
+			got := regexp.MustCompile(`"accountNumber":"(\d+)"`).FindAllStringSubmatch(out, -1)
+			numbers := []string{}
+			for _, match := range got {
+				numbers = append(numbers, match[1])
+			}
+			if !slices.Equal(numbers, tt.want) {
+				t.Errorf("got accounts %v, want %v", numbers, tt.want)
+			}
+
+			skipped := len(tt.want) < 3
+			if logged := strings.Contains(out, "skipping old-one as its status is SUSPENDED"); logged != skipped {
+				t.Errorf("got verbose skip message %t, want %t:\n%s", logged, skipped, out)
+			}
+			if shown := strings.Contains(out, "account status is SUSPENDED"); shown != skipped {
+				t.Errorf("got -show-skipped reason %t, want %t:\n%s", shown, skipped, out)
+			}
+		})
+	}
+}
+
+func TestCount(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{}, "1\n"},
+		{[]string{"-all"}, "2\n"},
+		{[]string{"-all", "-include-inactive-accounts"}, "3\n"},
+		{[]string{"-ou", "web", "-include-inactive-accounts", "-exclude-accounts", "frontend"}, "1\n"},
+		{[]string{"-accounts", "missing"}, "0\n"},
+	}
+
+	for _, tt := range tests {
+		// Just stdout, so that the count can be used in shell conditionals.
+		out, err := mainCommand(append([]string{"-prism-url", server.URL, "-count"}, tt.args...)...).Output()
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if string(out) != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.args, out, tt.want)
+		}
+	}
+
+	for _, req := range server.received() {
+		if req.URL.Path != "/sources/accounts" {
+			t.Errorf("unexpected request for %s with -count", req.URL)
+		}
+	}
+}
+
+func TestWithAccountNames(t *testing.T) {
+	lookup := prism.NewAccountLookup(testAccounts(2))
+	vpcs := map[AccountID][]PrismVPC{
+		"100": {testVPC("vpc-a", 3, 3), testVPC("vpc-b", 1, 1)},
+		"101": {},
+		// Prism has VPCs for an account it doesn't list.
+		"999": {testVPC("vpc-orphan", 3, 3)},
+	}
+
+	named := withAccountNames(lookup, vpcs)
+	if len(named) != 3 {
+		t.Fatalf("got %d accounts, want 3", len(named))
+	}
+	if got := named["100"]; got.Name != "account-0" || len(got.VPCs) != 2 || got.VPCs[1].VPCID != "vpc-b" {
+		t.Errorf("100 = %+v", got)
+	}
+	if got := named["101"]; got.Name != "account-1" || len(got.VPCs) != 0 {
+		t.Errorf("101 = %+v", got)
+	}
+	if got := named["999"]; got.Name != "" || len(got.VPCs) != 1 {
+		t.Errorf("999 = %+v, want an empty name", got)
+	}
+}
+
+func TestLogVPCCounts(t *testing.T) {
+	logged := captureLog(t)
+	log.SetFlags(0)
+	t.Cleanup(func() { log.SetFlags(log.LstdFlags) })
+	verboseToConsole = true
+	t.Cleanup(func() { verboseToConsole = false })
+
+	logVPCCounts(map[AccountID]AccountVPCs{
+		"222": {Name: "frontend", VPCs: []PrismVPC{testVPC("vpc-a", 3, 3)}},
+		"111": {Name: "deploy-tools", VPCs: []PrismVPC{}},
+		"000": {VPCs: []PrismVPC{testVPC("vpc-b", 3, 3), testVPC("vpc-c", 3, 3)}},
+	})
+
+	// Sorted by name, using the number when the name is unknown.
+	want := "000 (000): 2 VPCs\ndeploy-tools (111): 0 VPCs\nfrontend (222): 1 VPCs\n"
+	if logged.String() != want {
+		t.Errorf("got %q, want %q", logged, want)
+	}
+}
+
+func TestAccountsInOU(t *testing.T) {
+	logged := captureLog(t)
+
+	accounts := []PrismAccount{
+		{AccountName: "deploy-tools", OrganizationalUnit: "tools"},
+		{AccountName: "frontend", OrganizationalUnit: "web"},
+		{AccountName: "backend", OrganizationalUnit: "web"},
+		{AccountName: "unassigned"},
+	}
+
+	names, ok := accountsInOU(accounts, "web")
+	if !ok || !slices.Equal(names, []string{"frontend", "backend"}) {
+		t.Errorf("got %v, %v; want [frontend backend], true", names, ok)
+	}
+
+	// An unknown OU is a valid filter that matches nothing.
+	if names, ok := accountsInOU(accounts, "missing"); !ok || len(names) != 0 {
+		t.Errorf("got %v, %v; want no names, true", names, ok)
+	}
+	if logged.Len() != 0 {
+		t.Errorf("unexpected warning: %q", logged)
+	}
+
+	// Without any OU data the filter can't be applied.
+	if _, ok := accountsInOU(testAccounts(3), "web"); ok {
+		t.Error("expected ok to be false without OU data")
+	}
+	if got := logged.String(); !strings.Contains(got, "no organisational unit data") {
+		t.Errorf("expected a warning about missing OU data, got %q", got)
+	}
+}
+
+func TestReadAccountNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"one per line", "deploy-tools\nfrontend\n", []string{"deploy-tools", "frontend"}},
+		{"blank lines and padding", "\n  deploy-tools  \n\n\tfrontend\n", []string{"deploy-tools", "frontend"}},
+		{"CRLF line endings", "deploy-tools\r\nfrontend\r\n", []string{"deploy-tools", "frontend"}},
+		{"no trailing newline", "deploy-tools", []string{"deploy-tools"}},
+		{"empty input", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Any io.Reader works, so a strings.Reader stands in for stdin.
+			got, err := readAccountNames(strings.NewReader(tt.input))
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitListAndUnion(t *testing.T) {
+	if got := splitList(" a, b,,c ,"); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("splitList got %q", got)
+	}
+	if got := splitList(""); len(got) != 0 {
+		t.Errorf("splitList of an empty string got %q", got)
+	}
+
+	got := union([]string{"a", "b"}, nil, []string{"b", "c", "a"})
+	if !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("union got %q", got)
+	}
+}
+
+func TestFilterAccounts(t *testing.T) {
+	accounts := []PrismAccount{
+		{AccountNumber: "111", AccountName: "deploy-tools", OrganizationalUnit: "tools"},
+		{AccountNumber: "222", AccountName: "frontend-prod", OrganizationalUnit: "web", Status: "ACTIVE"},
+		{AccountNumber: "333", AccountName: "frontend-dev", OrganizationalUnit: "web"},
+		{AccountNumber: "444", AccountName: "old-prod", OrganizationalUnit: "web", Status: "SUSPENDED"},
+	}
+
+	tests := []struct {
+		name   string
+		filter AccountFilter
+		want   []string
+	}{
+		{"zero value", AccountFilter{}, []string{"111", "222", "333"}},
+		{"include inactive", AccountFilter{IncludeInactive: true}, []string{"111", "222", "333", "444"}},
+		{"regex", AccountFilter{NameRegex: regexp.MustCompile("-prod$")}, []string{"222"}},
+		{"regex and inactive", AccountFilter{NameRegex: regexp.MustCompile("-prod$"), IncludeInactive: true}, []string{"222", "444"}},
+		{"ou", AccountFilter{OU: "web"}, []string{"222", "333"}},
+		{"ou and regex", AccountFilter{OU: "web", NameRegex: regexp.MustCompile("dev")}, []string{"333"}},
+		{"unknown ou", AccountFilter{OU: "data"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			numbers := []string{}
+			kept, _ := filterAccounts(accounts, tt.filter)
+			for _, account := range kept {
+				numbers = append(numbers, account.AccountNumber)
+			}
+			if !slices.Equal(numbers, tt.want) {
+				t.Errorf("got %v, want %v", numbers, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintAccounts(t *testing.T) {
+	accounts := []PrismAccount{
+		{AccountNumber: "111111111111", AccountName: "deploy-tools", OrganizationalUnit: "tools", Status: "ACTIVE"},
+		{AccountNumber: "222", AccountName: "web"},
+	}
+
+	var buf bytes.Buffer
+	if err := printAccountsTable(&buf, accounts, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `NAME          NUMBER        OU     STATUS
+deploy-tools  111111111111  tools  ACTIVE
+web           222           -      -
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := printAccountsJSON(&buf, accounts, nil); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []PrismAccount
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || !slices.Equal(decoded, accounts) {
+		t.Errorf("got %v (%v) from:\n%s", decoded, err, buf.String())
+	}
+}
+
+func TestListAccounts(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	out, err := mainCommand("list-accounts", "-prism-url", server.URL, "-ou", "web", "-include-inactive-accounts", "-format", "json").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accounts []PrismAccount
+	if err := json.Unmarshal(out, &accounts); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if len(accounts) != 2 || accounts[0].AccountName != "frontend" || accounts[1].AccountName != "old-one" {
+		t.Errorf("got %+v", accounts)
+	}
+
+	text, err := runMain(t, "list-accounts", "-prism-url", server.URL, "-exclude-accounts", "frontend")
+	if err != nil {
+		t.Fatalf("%v: %s", err, text)
+	}
+	if !strings.Contains(text, "deploy-tools  111111111111  tools  ACTIVE") || strings.Contains(text, "frontend") || strings.Contains(text, "old-one") {
+		t.Errorf("unexpected listing:\n%s", text)
+	}
+
+	for _, req := range server.received() {
+		if req.URL.Path != "/sources/accounts" {
+			t.Errorf("unexpected request for %s", req.URL)
+		}
+	}
+
+	if out, err := runMain(t, "list-accounts", "-format", "csv"); err == nil || !strings.Contains(out, `-format must be text or json, not "csv"`) {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestListAccountsIncludeEmptyVPCs(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{
+		{VPCID: "vpc-1", AccountID: "111"},
+		{VPCID: "vpc-2", AccountID: "333"},
+		{VPCID: "vpc-3", AccountID: "333"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools", "status": "ACTIVE"},
+		{"accountNumber": "222", "accountName": "sandbox", "status": "ACTIVE"},
+		{"accountNumber": "333", "accountName": "frontend", "status": "ACTIVE"}
+	]`, string(vpcs))
+
+	// Without either flag, VPCs aren't fetched and every account is listed.
+	tests := []struct {
+		golden string
+		args   []string
+	}{
+		{"list-accounts.txt", nil},
+		{"list-accounts-vpc-counts.txt", []string{"-vpc-counts"}},
+		{"list-accounts-include-empty.txt", []string{"-include-empty-vpcs"}},
+		{"list-accounts-vpc-counts.json", []string{"-vpc-counts", "-format", "json"}},
+		{"list-accounts-include-empty.json", []string{"-include-empty-vpcs", "-format", "json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			out, err := mainCommand(append([]string{"list-accounts", "-prism-url", server.URL}, tt.args...)...).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.golden, out)
+		})
+	}
+}
+
+func TestDedupeAccountNumbers(t *testing.T) {
+	accounts := []PrismAccount{
+		{AccountNumber: "111", AccountName: "tools-old"},
+		{AccountNumber: "222", AccountName: "sandbox"},
+		{AccountNumber: "111", AccountName: "deploy-tools"},
+		{AccountNumber: "111", AccountName: "tools"},
+	}
+
+	got, duplicates := dedupeAccountNumbers(accounts)
+
+	want := []PrismAccount{
+		{AccountNumber: "111", AccountName: "deploy-tools"},
+		{AccountNumber: "222", AccountName: "sandbox"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	names := []string{}
+	for _, account := range duplicates["111"] {
+		names = append(names, account.AccountName)
+	}
+	if want := []string{"deploy-tools", "tools", "tools-old"}; !slices.Equal(names, want) {
+		t.Errorf("got duplicates %v, want %v", names, want)
+	}
+	if len(duplicates) != 1 {
+		t.Errorf("expected only 111 to be duplicated, got %v", duplicates)
+	}
+
+	// Sorting is stable, so accounts with the same name keep Prism's order.
+	_, duplicates = dedupeAccountNumbers([]PrismAccount{
+		{AccountNumber: "111", AccountName: "tools", Status: "SUSPENDED"},
+		{AccountNumber: "111", AccountName: "tools", Status: "ACTIVE"},
+	})
+	if got := duplicates["111"]; len(got) != 2 || got[0].Status != "SUSPENDED" || got[1].Status != "ACTIVE" {
+		t.Errorf("got duplicates %v, want Prism's order", got)
+	}
+}
+
+func TestDuplicateAccountNumbers(t *testing.T) {
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "tools"},
+		{"accountNumber": "111", "accountName": "deploy-tools"}
+	]`, `[{"vpcId": "vpc-1", "accountId": "111", "subnets": []}]`)
+
+	out, err := runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-all")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	want := "2 accounts share the number 111 (deploy-tools, tools); using deploy-tools"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected %q in the output:\n%s", want, out)
+	}
+	if strings.Count(out, `"accountNumber":"111"`) != 1 || !strings.Contains(out, `"accountName":"deploy-tools"`) {
+		t.Errorf("expected a single deploy-tools account:\n%s", out)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-all", "-strict")
+	if err == nil || !strings.Contains(out, want) {
+		t.Errorf("expected -strict to fail with %q, got %v: %s", want, err, out)
+	}
+}
+
+func TestFailOnEmpty(t *testing.T) {
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, "[]")
+	noMatch := []string{"-prism-url", server.URL, "-account-name-regex", "^nothing$"}
+
+	// By default, matching nothing still succeeds.
+	out, err := runMain(t, noMatch...)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	out, err = runMain(t, append(noMatch, "-fail-on-empty")...)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() == 0 {
+		t.Fatalf("expected a non-zero exit, got %v: %s", err, out)
+	}
+	if !strings.Contains(out, "no accounts matched the filters (-fail-on-empty)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	// Matching accounts are processed as normal.
+	if out, err := runMain(t, "-prism-url", server.URL, "-fail-on-empty"); err != nil {
+		t.Errorf("%v: %s", err, out)
+	}
+}
+
+func TestSelectAccounts(t *testing.T) {
+	captureLog(t)
+
+	accounts := []PrismAccount{
+		{AccountNumber: "111", AccountName: "deploy-tools", OrganizationalUnit: "tools", Status: "ACTIVE"},
+		{AccountNumber: "222", AccountName: "frontend-prod", OrganizationalUnit: "web", Status: "ACTIVE"},
+		{AccountNumber: "333", AccountName: "backend-prod", OrganizationalUnit: "web", Status: "ACTIVE"},
+		{AccountNumber: "444", AccountName: "old-prod", OrganizationalUnit: "web", Status: "SUSPENDED"},
+		{AccountNumber: "555", AccountName: "media-code", OrganizationalUnit: "media", Status: "ACTIVE"},
+	}
+
+	names := func(accounts []PrismAccount) []string {
+		out := []string{}
+		for _, a := range accounts {
+			out = append(out, a.AccountName)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		request AccountRequest
+		filter  AccountFilter
+		want    []string
+		skipped []SkippedAccount
+	}{
+		{
+			name:    "names, numbers and aliases",
+			request: AccountRequest{Names: []string{"deploy-tools", "222", "deploy-tools", "tools", "missing"}, Aliases: map[string]string{"tools": "111"}},
+			want:    []string{"deploy-tools", "frontend-prod"},
+			skipped: []SkippedAccount{{Account: "missing", Reason: "not found in prism"}},
+		},
+		{
+			name:    "sources are combined",
+			request: AccountRequest{Names: []string{"media-code"}, OU: "web", NameRegex: regexp.MustCompile(`^deploy`)},
+			want:    []string{"media-code", "frontend-prod", "backend-prod", "deploy-tools"},
+			skipped: []SkippedAccount{{Account: "old-prod", Reason: "account status is SUSPENDED"}},
+		},
+		{
+			name:    "filtered",
+			request: AccountRequest{All: true},
+			filter:  AccountFilter{NameRegex: regexp.MustCompile(`-prod$`), IncludeInactive: true, Exclude: []string{"333"}},
+			want:    []string{"frontend-prod", "old-prod"},
+			skipped: []SkippedAccount{
+				{Account: "deploy-tools", Reason: "doesn't match -account-name-regex"},
+				{Account: "backend-prod", Reason: "in -exclude-accounts"},
+				{Account: "media-code", Reason: "doesn't match -account-name-regex"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, skipped, err := selectAccounts(accounts, test.request, test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := names(selected); !slices.Equal(got, test.want) {
+				t.Errorf("selected %v, want %v", got, test.want)
+			}
+
+			// Everything else is listed as not requested.
+			want := append([]SkippedAccount{}, test.skipped...)
+			for _, account := range accounts {
+				considered := slices.Contains(test.want, account.AccountName) || slices.ContainsFunc(test.skipped, func(s SkippedAccount) bool { return s.Account == account.AccountName })
+				if !considered {
+					want = append(want, SkippedAccount{Account: account.AccountName, Reason: "not requested"})
+				}
+			}
+			if !slices.Equal(skipped, want) {
+				t.Errorf("skipped %v, want %v", skipped, want)
+			}
+		})
+	}
+}
+
+func TestSelectAccountsSharedNames(t *testing.T) {
+	logged := captureLog(t)
+
+	accounts := []PrismAccount{
+		{AccountNumber: "111", AccountName: "frontend"},
+		{AccountNumber: "222", AccountName: "frontend"},
+	}
+
+	selected, _, err := selectAccounts(accounts, AccountRequest{Names: []string{"frontend"}}, AccountFilter{IncludeInactive: true})
+	if err != nil || len(selected) != 1 || selected[0].AccountNumber != "111" {
+		t.Errorf("got %v, %v; want the first frontend account", selected, err)
+	}
+	if !strings.Contains(logged.String(), "2 accounts are named frontend (111, 222)") {
+		t.Errorf("expected a warning about the shared name, got %q", logged)
+	}
+
+	_, _, err = selectAccounts(accounts, AccountRequest{Names: []string{"frontend"}, Strict: true}, AccountFilter{})
+	var ambiguous *AmbiguousAccountError
+	if !errors.As(err, &ambiguous) || ambiguous.Name != "frontend" {
+		t.Errorf("got %v, want an AmbiguousAccountError with Strict", err)
+	}
+
+	// A number is never ambiguous.
+	if selected, _, err := selectAccounts(accounts, AccountRequest{Names: []string{"222"}, Strict: true}, AccountFilter{IncludeInactive: true}); err != nil || len(selected) != 1 {
+		t.Errorf("got %v, %v; want account 222", selected, err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// The supported values for '-source'.
+var sources = []string{"prism", "aws"}
+
+// EC2API is the subset of the EC2 client that AWSPrism uses. Being an
+// interface, a fake can stand in for the real client - Go interfaces are
+// satisfied implicitly, so unlike a Scala trait the SDK doesn't need to know
+// about it.
+type EC2API interface {
+	ec2.DescribeVpcsAPIClient
+	ec2.DescribeSubnetsAPIClient
+	ec2.DescribeRouteTablesAPIClient
+}
+
+type STSAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// AWSPrism is a PrismLike that reads VPCs straight from the EC2 API, for
+// environments without Prism ('-source aws'). It only sees the account (and
+// region) of the current AWS credentials.
+type AWSPrism struct {
+	EC2    EC2API
+	STS    STSAPI
+	Region string
+	// AWS doesn't know our names for accounts, so this is used as the
+	// account's name. Defaults to the account number.
+	AccountName string
+}
+
+// newAWSPrism creates an AWSPrism using the default AWS credential chain
+// (environment, shared config, instance role etc.).
+func newAWSPrism(ctx context.Context, region string, accountName string) (AWSPrism, error) {
+	opts := []func(*awsconfig.LoadOptions) error{}
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return AWSPrism{}, fmt.Errorf("unable to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return AWSPrism{}, fmt.Errorf("no AWS region configured; set -aws-region or AWS_REGION")
+	}
+
+	return AWSPrism{
+		EC2:         ec2.NewFromConfig(cfg),
+		STS:         sts.NewFromConfig(cfg),
+		Region:      cfg.Region,
+		AccountName: accountName,
+	}, nil
+}
+
+func (p AWSPrism) getAccounts(ctx context.Context) ([]PrismAccount, error) {
+	identity, err := p.STS.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get AWS account: %w", err)
+	}
+
+	number := aws.ToString(identity.Account)
+	if number == "" {
+		return nil, errors.New("AWS didn't say which account the credentials are for")
+	}
+	return []PrismAccount{{AccountNumber: number, AccountName: valueOr(p.AccountName, number)}}, nil
+}
+
+func (p AWSPrism) getVPCs(ctx context.Context) (map[AccountID][]PrismVPC, error) {
+	vpcs, err := p.describeVPCs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get AWS vpcs: %w", err)
+	}
+
+	return groupBy(vpcs, func(item PrismVPC) AccountID {
+		return AccountID(item.AccountID)
+	}), nil
+}
+
+// getVPCsForAccount is the same as getVPCs, as the credentials only give
+// access to one account anyway.
+func (p AWSPrism) getVPCsForAccount(ctx context.Context, id AccountID) ([]PrismVPC, error) {
+	vpcs, err := p.getVPCs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return vpcs[id], nil
+}
+
+// describeVPCs builds the same structures as Prism's /vpcs endpoint from the
+// VPCs, subnets and route tables in the region. As with Prism, a subnet is
+// public if its route table (or the VPC's main one) routes to an internet
+// gateway.
+func (p AWSPrism) describeVPCs(ctx context.Context) ([]PrismVPC, error) {
+	routeTables, err := p.describeRouteTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subnetsByVPC := map[string][]PrismSubnet{}
+	subnets := ec2.NewDescribeSubnetsPaginator(p.EC2, &ec2.DescribeSubnetsInput{})
+	for subnets.HasMorePages() {
+		page, err := subnets.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range page.Subnets {
+			vpcID := aws.ToString(s.VpcId)
+			table, ok := routeTables.subnets[aws.ToString(s.SubnetId)]
+			if !ok {
+				table, ok = routeTables.main[vpcID]
+			}
+
+			subnet := PrismSubnet{
+				SubnetID:         aws.ToString(s.SubnetId),
+				AvailabilityZone: aws.ToString(s.AvailabilityZone),
+				CIDR:             aws.ToString(s.CidrBlock),
+				Tags:             tagMap(s.Tags),
+			}
+			if ok {
+				igw, nat := routesOf(table)
+				subnet.IsPublic = aws.Bool(igw)
+				subnet.HasInternetGatewayRoute = aws.Bool(igw)
+				subnet.NATGatewayID = nat
+			}
+
+			subnetsByVPC[vpcID] = append(subnetsByVPC[vpcID], subnet)
+		}
+	}
+
+	out := []PrismVPC{}
+	now := time.Now()
+	vpcs := ec2.NewDescribeVpcsPaginator(p.EC2, &ec2.DescribeVpcsInput{})
+	for vpcs.HasMorePages() {
+		page, err := vpcs.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range page.Vpcs {
+			vpcID := aws.ToString(v.VpcId)
+			out = append(out, PrismVPC{
+				VPCID:       vpcID,
+				AccountID:   aws.ToString(v.OwnerId),
+				IsDefault:   aws.ToBool(v.IsDefault),
+				Subnets:     subnetsByVPC[vpcID],
+				Tags:        tagMap(v.Tags),
+				LastUpdated: now,
+				Region:      p.Region,
+				State:       string(v.State),
+			})
+		}
+	}
+
+	return out, nil
+}
+
+// AWSRouteTables indexes route tables by the subnets explicitly associated
+// with them, and by VPC for each VPC's main route table (used by subnets
+// without an explicit association).
+type AWSRouteTables struct {
+	subnets map[string]types.RouteTable
+	main    map[string]types.RouteTable
+}
+
+func (p AWSPrism) describeRouteTables(ctx context.Context) (AWSRouteTables, error) {
+	tables := AWSRouteTables{subnets: map[string]types.RouteTable{}, main: map[string]types.RouteTable{}}
+
+	pages := ec2.NewDescribeRouteTablesPaginator(p.EC2, &ec2.DescribeRouteTablesInput{})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return AWSRouteTables{}, err
+		}
+
+		for _, table := range page.RouteTables {
+			for _, association := range table.Associations {
+				if aws.ToBool(association.Main) {
+					tables.main[aws.ToString(table.VpcId)] = table
+				}
+				if association.SubnetId != nil {
+					tables.subnets[*association.SubnetId] = table
+				}
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+// routesOf returns whether the route table routes to an internet gateway, and
+// the NAT gateway it uses, if any.
+func routesOf(table types.RouteTable) (igw bool, natGatewayID string) {
+	for _, route := range table.Routes {
+		if strings.HasPrefix(aws.ToString(route.GatewayId), "igw-") {
+			igw = true
+		}
+		if route.NatGatewayId != nil {
+			natGatewayID = *route.NatGatewayId
+		}
+	}
+
+	return igw, natGatewayID
+}
+
+func tagMap(tags []types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	return m
+}
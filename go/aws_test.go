@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// fakeEC2 is an EC2API returning canned pages. Subnets are split over two
+// pages to check that the paginators are followed.
+type fakeEC2 struct {
+	vpcs        []types.Vpc
+	subnets     [][]types.Subnet
+	routeTables []types.RouteTable
+	err         error
+}
+
+func (f fakeEC2) DescribeVpcs(ctx context.Context, params *ec2.DescribeVpcsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVpcsOutput, error) {
+	return &ec2.DescribeVpcsOutput{Vpcs: f.vpcs}, f.err
+}
+
+func (f fakeEC2) DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error) {
+	page := 0
+	if params.NextToken != nil {
+		page = 1
+	}
+
+	out := &ec2.DescribeSubnetsOutput{}
+	if page < len(f.subnets) {
+		out.Subnets = f.subnets[page]
+	}
+	if page+1 < len(f.subnets) {
+		out.NextToken = aws.String("next")
+	}
+
+	return out, f.err
+}
+
+func (f fakeEC2) DescribeRouteTables(ctx context.Context, params *ec2.DescribeRouteTablesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRouteTablesOutput, error) {
+	return &ec2.DescribeRouteTablesOutput{RouteTables: f.routeTables}, f.err
+}
+
+type fakeSTS struct {
+	account string
+}
+
+func (f fakeSTS) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: aws.String(f.account)}, nil
+}
+
+func testEC2() fakeEC2 {
+	subnet := func(id, az string) types.Subnet {
+		return types.Subnet{SubnetId: aws.String(id), VpcId: aws.String("vpc-main"), AvailabilityZone: aws.String(az), CidrBlock: aws.String("10.0.0.0/24")}
+	}
+
+	return fakeEC2{
+		vpcs: []types.Vpc{
+			{
+				VpcId:     aws.String("vpc-main"),
+				OwnerId:   aws.String("111"),
+				IsDefault: aws.Bool(false),
+				State:     types.VpcStateAvailable,
+				Tags:      []types.Tag{{Key: aws.String("Name"), Value: aws.String("main")}},
+			},
+			{VpcId: aws.String("vpc-default"), OwnerId: aws.String("111"), IsDefault: aws.Bool(true)},
+		},
+		subnets: [][]types.Subnet{
+			{subnet("subnet-pub-a", "eu-west-1a")},
+			{subnet("subnet-priv-a", "eu-west-1a"), subnet("subnet-isolated-a", "eu-west-1a")},
+		},
+		routeTables: []types.RouteTable{
+			{
+				VpcId:        aws.String("vpc-main"),
+				Associations: []types.RouteTableAssociation{{SubnetId: aws.String("subnet-pub-a")}},
+				Routes:       []types.Route{{GatewayId: aws.String("local")}, {GatewayId: aws.String("igw-1")}},
+			},
+			{
+				VpcId:        aws.String("vpc-main"),
+				Associations: []types.RouteTableAssociation{{SubnetId: aws.String("subnet-priv-a")}},
+				Routes:       []types.Route{{GatewayId: aws.String("local")}, {NatGatewayId: aws.String("nat-1")}},
+			},
+			// subnet-isolated-a has no association, so uses the main table.
+			{
+				VpcId:        aws.String("vpc-main"),
+				Associations: []types.RouteTableAssociation{{Main: aws.Bool(true)}},
+				Routes:       []types.Route{{GatewayId: aws.String("local")}},
+			},
+		},
+	}
+}
+
+func TestAWSPrismGetAccounts(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "111"},
+		{"deploy-tools", "deploy-tools"},
+	}
+
+	for _, tt := range tests {
+		p := AWSPrism{STS: fakeSTS{account: "111"}, AccountName: tt.name}
+		got, err := p.getAccounts(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []PrismAccount{{AccountNumber: "111", AccountName: tt.want}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestAWSPrismGetVPCs(t *testing.T) {
+	p := AWSPrism{EC2: testEC2(), Region: "eu-west-1"}
+
+	vpcs, err := p.getVPCsForAccount(context.Background(), "111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vpcs) != 2 {
+		t.Fatalf("got %d VPCs, want 2", len(vpcs))
+	}
+
+	main, def := vpcs[0], vpcs[1]
+	if main.VPCID != "vpc-main" || main.IsDefault || main.Region != "eu-west-1" || main.State != "available" || main.Tags["Name"] != "main" {
+		t.Errorf("unexpected VPC %+v", main)
+	}
+	if def.VPCID != "vpc-default" || !def.IsDefault || len(def.Subnets) != 0 {
+		t.Errorf("unexpected default VPC %+v", def)
+	}
+
+	want := []PrismSubnet{
+		{SubnetID: "subnet-pub-a", AvailabilityZone: "eu-west-1a", CIDR: "10.0.0.0/24", Tags: map[string]string{}, IsPublic: aws.Bool(true), HasInternetGatewayRoute: aws.Bool(true)},
+		{SubnetID: "subnet-priv-a", AvailabilityZone: "eu-west-1a", CIDR: "10.0.0.0/24", Tags: map[string]string{}, IsPublic: aws.Bool(false), HasInternetGatewayRoute: aws.Bool(false), NATGatewayID: "nat-1"},
+		{SubnetID: "subnet-isolated-a", AvailabilityZone: "eu-west-1a", CIDR: "10.0.0.0/24", Tags: map[string]string{}, IsPublic: aws.Bool(false), HasInternetGatewayRoute: aws.Bool(false)},
+	}
+	if !reflect.DeepEqual(main.Subnets, want) {
+		t.Errorf("got subnets %+v, want %+v", main.Subnets, want)
+	}
+
+	if other, err := p.getVPCsForAccount(context.Background(), "222"); err != nil || len(other) != 0 {
+		t.Errorf("expected no VPCs for another account, got %v, %v", other, err)
+	}
+}
+
+func TestAWSPrismError(t *testing.T) {
+	p := AWSPrism{EC2: fakeEC2{err: errors.New("access denied")}}
+
+	_, err := p.getVPCs(context.Background())
+	if err == nil || err.Error() != "unable to get AWS vpcs: access denied" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestAWSGetAccountsWithoutAccount(t *testing.T) {
+	p := AWSPrism{STS: fakeSTS{}}
+	accounts, err := p.getAccounts(context.Background())
+	if err == nil || len(accounts) != 0 {
+		t.Errorf("got %v, %v; want an error", accounts, err)
+	}
+}
+
+func TestSourceFlag(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-source", "ec2"}, `invalid -source "ec2"`},
+		{[]string{"-source", "aws", "-replay", t.TempDir()}, "-record, -replay and -cache-dir only apply to -source prism"},
+	} {
+		out, err := runMain(t, tt.args...)
+		if err == nil || !strings.Contains(out, tt.want) {
+			t.Errorf("%v: got %v: %s", tt.args, err, out)
+		}
+	}
+}
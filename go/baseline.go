@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// loadBaseline reads a report previously written with '-format json'.
+func loadBaseline(path string) ([]AccountReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []AccountReport
+	err = json.Unmarshal(data, &reports)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse baseline %s: %w", path, err)
+	}
+
+	return reports, nil
+}
+
+// diffReports describes how each account has changed since the baseline,
+// including accounts which have been added or removed. Unchanged accounts are
+// not mentioned. Note that an account is 'removed' if it's not in the current
+// run for any reason, e.g. a narrower '-accounts'.
+func diffReports(baseline []AccountReport, current []AccountReport) []string {
+	previous := map[string]AccountReport{}
+	for _, r := range baseline {
+		previous[r.AccountNumber] = r
+	}
+
+	changes := []string{}
+	seen := map[string]bool{}
+	for _, cur := range current {
+		seen[cur.AccountNumber] = true
+
+		prev, ok := previous[cur.AccountNumber]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s: added (%s)", cur.AccountName, reportVPC(cur)))
+			continue
+		}
+
+		name := cur.AccountName
+		wasMatched := prev.Status == StatusMatched
+		isMatched := cur.Status == StatusMatched
+
+		switch {
+		case !wasMatched && isMatched:
+			changes = append(changes, fmt.Sprintf("%s: newly matched (%s)", name, cur.VPCID))
+		case wasMatched && !isMatched:
+			changes = append(changes, fmt.Sprintf("%s: newly unmatched (was %s): %s", name, prev.VPCID, cur.Reason))
+		case wasMatched && isMatched:
+			if prev.VPCID != cur.VPCID {
+				changes = append(changes, fmt.Sprintf("%s: VPC changed from %s to %s", name, prev.VPCID, cur.VPCID))
+			}
+
+			if len(prev.PublicSubnets) != len(cur.PublicSubnets) || len(prev.PrivateSubnets) != len(cur.PrivateSubnets) {
+				changes = append(changes, fmt.Sprintf(
+					"%s: subnet count changed from %d public, %d private to %d public, %d private",
+					name, len(prev.PublicSubnets), len(prev.PrivateSubnets), len(cur.PublicSubnets), len(cur.PrivateSubnets),
+				))
+			}
+		}
+	}
+
+	for _, prev := range baseline {
+		if !seen[prev.AccountNumber] {
+			changes = append(changes, fmt.Sprintf("%s: removed (was %s)", prev.AccountName, reportVPC(prev)))
+		}
+	}
+
+	return changes
+}
+
+// reportVPC returns the report's VPC ID, or 'no VPC' if it didn't match one.
+func reportVPC(r AccountReport) string {
+	if r.Status != StatusMatched {
+		return "no VPC"
+	}
+	return r.VPCID
+}
+
+// printBaselineDiff writes the changes since the baseline to w, and returns
+// how many there were.
+func printBaselineDiff(w io.Writer, baseline []AccountReport, infos []AccountInfo) int {
+	current := []AccountReport{}
+	for _, info := range infos {
+		current = append(current, info.asReport())
+	}
+
+	changes := diffReports(baseline, current)
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "baseline: no changes")
+		return 0
+	}
+
+	for _, change := range changes {
+		fmt.Fprintf(w, "baseline: %s\n", change)
+	}
+
+	return len(changes)
+}
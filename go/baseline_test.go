@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffReports(t *testing.T) {
+	matched := func(number string, name string, vpc string, public int, private int) AccountReport {
+		r := AccountReport{AccountNumber: number, AccountName: name, Status: StatusMatched, VPCID: vpc}
+		for i := 0; i < public; i++ {
+			r.PublicSubnets = append(r.PublicSubnets, "public")
+		}
+		for i := 0; i < private; i++ {
+			r.PrivateSubnets = append(r.PrivateSubnets, "private")
+		}
+		return r
+	}
+	unmatched := func(number string, name string, reason string) AccountReport {
+		return AccountReport{AccountNumber: number, AccountName: name, Status: StatusNoVPC, Reason: reason}
+	}
+
+	baseline := []AccountReport{
+		matched("1", "unchanged", "vpc-1", 3, 3),
+		unmatched("2", "found", "no VPCs found"),
+		matched("3", "lost", "vpc-3", 3, 3),
+		matched("4", "moved", "vpc-4", 3, 3),
+		matched("5", "grown", "vpc-5", 3, 3),
+		matched("7", "gone", "vpc-7", 3, 3),
+		unmatched("8", "gone-unmatched", "no VPCs found"),
+	}
+	current := []AccountReport{
+		matched("1", "unchanged", "vpc-1", 3, 3),
+		matched("2", "found", "vpc-2", 3, 3),
+		unmatched("3", "lost", "no VPCs found"),
+		matched("4", "moved", "vpc-4b", 3, 3),
+		matched("5", "grown", "vpc-5", 4, 4),
+		matched("6", "new", "vpc-6", 3, 3),
+		unmatched("9", "new-unmatched", "no VPCs found"),
+	}
+
+	want := []string{
+		"found: newly matched (vpc-2)",
+		"lost: newly unmatched (was vpc-3): no VPCs found",
+		"moved: VPC changed from vpc-4 to vpc-4b",
+		"grown: subnet count changed from 3 public, 3 private to 4 public, 4 private",
+		"new: added (vpc-6)",
+		"new-unmatched: added (no VPC)",
+		"gone: removed (was vpc-7)",
+		"gone-unmatched: removed (was no VPC)",
+	}
+	if got := diffReports(baseline, current); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	// A report written with -format json can be loaded as a baseline.
+	infos := []AccountInfo{goldenAccountInfo()}
+	data, err := reportsAsJSON(infos, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	baseline, err := loadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if n := printBaselineDiff(&buf, baseline, infos); n != 0 || buf.String() != "baseline: no changes\n" {
+		t.Errorf("got %d, %q", n, buf.String())
+	}
+
+	// The VPC going away shows up as a change.
+	changed := goldenAccountInfo()
+	changed.Selection = VPCSelection{Reason: "no VPCs found"}
+	buf.Reset()
+	if n := printBaselineDiff(&buf, baseline, []AccountInfo{changed}); n != 1 || buf.String() != "baseline: deploy-tools: newly unmatched (was vpc-main): no VPCs found\n" {
+		t.Errorf("got %d, %q", n, buf.String())
+	}
+}
+
+func TestFailOnBaselineChange(t *testing.T) {
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, "[]")
+
+	// Only stdout, as the summary goes to stderr.
+	report, err := mainCommand("-prism-url", server.URL, "-format", "json").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchanged := filepath.Join(t.TempDir(), "unchanged.json")
+	if err := os.WriteFile(unchanged, report, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed := filepath.Join(t.TempDir(), "changed.json")
+	if err := os.WriteFile(changed, []byte(`[{"accountNumber": "222", "accountName": "security", "status": "matched", "vpcId": "vpc-222"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		wantExit int
+		want     string
+	}{
+		{[]string{"-baseline", unchanged, "-fail-on-baseline-change"}, 0, "baseline: no changes"},
+		{[]string{"-baseline", changed}, 0, "baseline: security: removed (was vpc-222)"},
+		{[]string{"-baseline", changed, "-fail-on-baseline-change"}, 1, "baseline: deploy-tools: added (no VPC)"},
+		{[]string{"-fail-on-baseline-change"}, 1, "-fail-on-baseline-change requires -baseline"},
+	}
+
+	for _, tt := range tests {
+		out, err := runMain(t, append([]string{"-prism-url", server.URL, "-format", "json"}, tt.args...)...)
+		exit := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exit = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if exit != tt.wantExit || !strings.Contains(out, tt.want) {
+			t.Errorf("%v: got exit %d, want %d and %q:\n%s", tt.args, exit, tt.wantExit, tt.want, out)
+		}
+	}
+}
+
+func TestLoadBaselineErrors(t *testing.T) {
+	if _, err := loadBaseline(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	if err := os.WriteFile(path, []byte(`{"not": "a list"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadBaseline(path); err == nil || !strings.Contains(err.Error(), "unable to parse baseline") {
+		t.Errorf("got %v", err)
+	}
+}
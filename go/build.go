@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// BuildOptions controls how buildAccountInfos chooses each account's primary
+// VPC and fills in its details. It's the parsed form of generate's flags and
+// config, so that the selection can be driven without going through flag
+// parsing.
+type BuildOptions struct {
+	Defaults           AccountDefaults
+	StreamNameTemplate *template.Template
+	// Per-account settings from the config; see overrideFor.
+	Overrides map[string]AccountOverride
+	Selector  VPCSelector
+	// Used for topology warnings with Lenient.
+	SubnetRange SubnetRange
+	Lenient     bool
+
+	// Filters applied to the VPCs before selection.
+	IncludeVPCIDs      []string
+	ExcludeVPCIDs      []string
+	IncludeShared      bool
+	IncludeUnavailable bool
+	// Keep only subnets with this tag, if SubnetTagKey is set.
+	SubnetTagKey   string
+	SubnetTagValue string
+	// Drop subnets matching these; see excludeSubnets.
+	ExcludeSubnetPrefixes []string
+	ExcludeSubnetTagKey   string
+	ExcludeSubnetTagValue string
+
+	MultiRegion bool
+	// Data quality checks, which are warnings unless Strict is set. Zero
+	// values disable them.
+	MaxAge        time.Duration
+	PublicPrefix  int
+	PrivatePrefix int
+	Strict        bool
+	// Stop at the first account that fails.
+	StopOnError bool
+	// What the ages of VPC data are measured against. Defaults to the
+	// current time, but can be fixed for repeatable results.
+	Now time.Time
+	// For checking the generated Typescript names are valid.
+	Render RenderOptions
+}
+
+// buildAccountInfos chooses the primary VPC for each account and assembles
+// what's needed to render it. Accounts missing from 'vpcs' are treated as
+// having none. Failures (including those in 'fetchErrs', from fetching the
+// account's VPCs) are recorded in the returned summary rather than stopping
+// the run, unless StopOnError is set. An account failing several checks
+// (with Strict) has them all reported together as one joined error, rather
+// than just the first. Cancelling ctx stops early, marking the summary as
+// interrupted, whereas its deadline passing is recorded as a (timeout)
+// failure.
+func buildAccountInfos(ctx context.Context, accounts []PrismAccount, vpcs map[AccountID][]PrismVPC, fetchErrs map[AccountID]error, opts BuildOptions) ([]AccountInfo, RunSummary) {
+	summary := RunSummary{}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Included VPCs win if any are suitable, otherwise fall back to
+	// considering all of them.
+	chooseVPC := func(candidates []PrismVPC) (PrismVPC, bool, string) {
+		if included := includeVPCs(candidates, opts.IncludeVPCIDs); len(included) > 0 {
+			if vpc, found, _ := opts.Selector.Select(included); found {
+				return vpc, true, ""
+			}
+		}
+
+		return opts.Selector.Select(candidates)
+	}
+
+	fail := func(account PrismAccount, err error) {
+		summary.fail(account.AccountName, err)
+	}
+
+	infos := []AccountInfo{}
+	for _, account := range accounts {
+		if opts.StopOnError && len(summary.Failures) > 0 {
+			break
+		}
+
+		if err := ctx.Err(); errors.Is(err, context.DeadlineExceeded) {
+			summary.fail("", fmt.Errorf("timed out with %d of %d accounts processed: %w", summary.Processed, len(accounts), err))
+			break
+		} else if err != nil {
+			summary.Interrupted = true
+			break
+		}
+
+		summary.Processed++
+
+		if err, ok := fetchErrs[AccountID(account.AccountNumber)]; ok {
+			fail(account, err)
+			continue
+		}
+
+		vpcs, ok := vpcs[AccountID(account.AccountNumber)]
+		if !ok {
+			vpcs = []PrismVPC{}
+		}
+
+		// Problems from the data quality checks, which are reported together
+		// at the end so that fixing one doesn't just reveal the next.
+		var problems []error
+		report := func(msg string) {
+			if opts.Strict {
+				problems = append(problems, errors.New(msg))
+			} else {
+				warnf(account.AccountName, "%s", msg)
+			}
+		}
+
+		if opts.MaxAge > 0 {
+			for _, vpc := range staleVPCs(vpcs, opts.MaxAge, now) {
+				report(fmt.Sprintf("data for %s was last updated %s ago", vpc.VPCID, now.Sub(vpc.LastUpdated).Round(time.Second)))
+			}
+		}
+
+		stream, err := streamName(opts.StreamNameTemplate, account)
+		if err != nil {
+			fail(account, err)
+			continue
+		}
+
+		info := AccountInfo{
+			AccountNumber:          account.AccountNumber,
+			AccountName:            account.AccountName,
+			Stack:                  valueOr(opts.Defaults.Stack, placeholder),
+			BucketForArtifact:      stringPtr(valueOr(opts.Defaults.BucketForArtifacts, placeholder)),
+			BucketForPrivateConfig: stringPtr(valueOr(opts.Defaults.BucketForPrivateConfig, placeholder)),
+			Logging:                Logging{StreamName: stream},
+			VPCs:                   vpcs,
+		}
+
+		candidates := excludeVPCs(vpcs, opts.ExcludeVPCIDs)
+		if !opts.IncludeShared {
+			candidates = excludeSharedVPCs(candidates)
+		}
+
+		if opts.SubnetTagKey != "" {
+			candidates = filterSubnetsByTag(candidates, opts.SubnetTagKey, opts.SubnetTagValue)
+		}
+		if len(opts.ExcludeSubnetPrefixes) > 0 || opts.ExcludeSubnetTagKey != "" {
+			candidates = excludeSubnets(candidates, opts.ExcludeSubnetPrefixes, opts.ExcludeSubnetTagKey, opts.ExcludeSubnetTagValue)
+		}
+
+		var unavailable []PrismVPC
+		if !opts.IncludeUnavailable {
+			candidates, unavailable = excludeUnavailableVPCs(candidates)
+		}
+
+		if unknown := unknownSubnets(candidates); len(unknown) > 0 {
+			warnf(account.AccountName, "subnets that are neither public nor private are excluded from subnet counts: %s", strings.Join(unknown, ", "))
+		}
+
+		// A VPC configured for the account bypasses the usual selection.
+		override, hasOverride := overrideFor(opts.Overrides, account)
+		hasOverride = hasOverride && override.VPCID != ""
+
+		var vpc PrismVPC
+		var found bool
+		var reason string
+		if hasOverride {
+			isOverride := func(v PrismVPC) bool { return v.VPCID == override.VPCID }
+			i := slices.IndexFunc(vpcs, isOverride)
+			if i == -1 || (vpcs[i].AccountID != "" && vpcs[i].AccountID != account.AccountNumber) {
+				fail(account, fmt.Errorf("configured vpcId %s is not one of the account's VPCs", override.VPCID))
+				continue
+			}
+
+			// The candidate has the subnet filters applied, so is what gets
+			// rendered.
+			j := slices.IndexFunc(candidates, isOverride)
+			if j == -1 {
+				fail(account, fmt.Errorf("configured vpcId %s was excluded (shared, not available or -exclude-vpc-ids)", override.VPCID))
+				continue
+			}
+
+			vpc, found = candidates[j], true
+		} else {
+			vpc, found, reason = chooseVPC(candidates)
+		}
+
+		if !found && len(candidates) == 0 && len(vpcs) > 0 {
+			reason = fmt.Sprintf("all %d VPCs were excluded (shared, not available or -exclude-vpc-ids)", len(vpcs))
+		}
+		if !found && len(unavailable) > 0 {
+			states := []string{}
+			for _, u := range unavailable {
+				states = append(states, fmt.Sprintf("%s (%s)", u.VPCID, u.State))
+			}
+			reason += "; ignored VPCs that are not available: " + strings.Join(states, ", ")
+		}
+		info.Selection = VPCSelection{VPC: vpc, Found: found, Reason: reason}
+		if !found {
+			warnf(account.AccountName, "%s", reason)
+		}
+		if found && opts.Lenient {
+			info.Selection.Warning = topologyWarning(vpc, opts.SubnetRange)
+			if info.Selection.Warning != "" {
+				warnf(account.AccountName, "accepted %s with %s", vpc.VPCID, info.Selection.Warning)
+			}
+		}
+
+		if opts.MultiRegion && !hasOverride {
+			byRegion := groupBy(candidates, vpcRegion)
+			regions := sortedKeys(byRegion)
+
+			for _, region := range regions {
+				regionVPC, ok, _ := chooseVPC(byRegion[region])
+				if !ok {
+					continue
+				}
+
+				selection := VPCSelection{VPC: regionVPC, Found: true}
+				if opts.Lenient {
+					selection.Warning = topologyWarning(regionVPC, opts.SubnetRange)
+				}
+				info.Regions = append(info.Regions, RegionSelection{Region: region, Selection: selection})
+			}
+
+			if len(info.Regions) > 0 {
+				info.Selection = info.Regions[0].Selection
+				vpc = info.Selection.VPC
+			}
+		}
+
+		if _, ok := knownAvailabilityZones(vpc); found && !ok {
+			warnf(account.AccountName, "prism has no availability zone for some subnets in %s; leaving out availabilityZones", vpc.VPCID)
+		}
+
+		if found {
+			for _, problem := range subnetPrefixProblems(vpc, opts.PublicPrefix, opts.PrivatePrefix) {
+				report(problem)
+			}
+		}
+
+		if unrouted := unroutedPublicSubnets(vpc.Subnets); len(unrouted) > 0 {
+			report(fmt.Sprintf("public subnets in %s have no internet gateway route: %s", vpc.VPCID, strings.Join(subnetIDs(unrouted), ", ")))
+		}
+
+		// Invalid names are always errors, as the output wouldn't compile.
+		if name := info.constName(opts.Render); !isIdentifier(name) {
+			problems = append(problems, fmt.Errorf("generated constant name %q is not a valid Typescript identifier", name))
+		}
+
+		// Regions come from Prism, so could make the subnet consts invalid
+		// even if the account's name is fine.
+		if opts.Render.SubnetConsts {
+			i := slices.IndexFunc(info.Regions, func(r RegionSelection) bool {
+				return !isIdentifier(info.subnetConstPrefix(opts.Render, r.Region))
+			})
+			if i != -1 {
+				problems = append(problems, fmt.Errorf("generated subnet constant name %q is not a valid Typescript identifier", info.subnetConstPrefix(opts.Render, info.Regions[i].Region)))
+			}
+		}
+
+		// errors.Join combines them into one error (nil if there are none),
+		// whose message has each on its own line. Callers can get them back
+		// individually with 'Unwrap() []error'.
+		if err := errors.Join(problems...); err != nil {
+			fail(account, err)
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, summary
+}
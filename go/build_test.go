@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestBuildAccountInfos(t *testing.T) {
+	captureLog(t)
+
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+	vpcs := map[AccountID][]PrismVPC{"111": {testVPC("vpc-small", 1, 1), testVPC("vpc-1", 3, 3)}}
+
+	infos, summary := buildAccountInfos(context.Background(), accounts, vpcs, nil, BuildOptions{
+		Defaults:           AccountDefaults{Stack: "Tools"},
+		StreamNameTemplate: template.Must(template.New("stream-name").Parse("{{.AccountName}}-logs")),
+		Selector:           SubnetCountSelector{Range: standardSubnetRange},
+	})
+	if len(summary.Failures) > 0 || summary.Processed != 1 {
+		t.Fatalf("got %d processed and failures %v", summary.Processed, summary.Failures)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("got %d infos, want 1", len(infos))
+	}
+
+	info := infos[0]
+	if info.AccountNumber != "111" || info.AccountName != "deploy-tools" || info.Stack != "Tools" || *info.BucketForArtifact != placeholder {
+		t.Errorf("unexpected details %+v", info)
+	}
+	if info.Logging.StreamName != "deploy-tools-logs" {
+		t.Errorf("got stream name %q", info.Logging.StreamName)
+	}
+	if !info.Selection.Found || info.Selection.VPC.VPCID != "vpc-1" || len(info.VPCs) != 2 {
+		t.Errorf("got selection %+v from %d VPCs, want vpc-1 from 2", info.Selection, len(info.VPCs))
+	}
+}
+
+func TestBuildAccountInfosAccountWithoutVPCs(t *testing.T) {
+	logged := captureLog(t)
+
+	// Prism returned VPCs for deploy-tools only, so frontend isn't in the
+	// map at all.
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}, {AccountNumber: "222", AccountName: "frontend"}}
+	vpcs := map[AccountID][]PrismVPC{"111": {testVPC("vpc-1", 3, 3)}}
+
+	infos, summary := buildAccountInfos(context.Background(), accounts, vpcs, nil, BuildOptions{Selector: SubnetCountSelector{Range: standardSubnetRange}})
+	if len(summary.Failures) > 0 || summary.Processed != 2 {
+		t.Fatalf("got %d processed and failures %v, want both processed without failing", summary.Processed, summary.Failures)
+	}
+
+	if len(infos) != 2 || !infos[0].Selection.Found {
+		t.Fatalf("got %+v, want both accounts with deploy-tools' VPC found", infos)
+	}
+
+	missing := infos[1]
+	if missing.Selection.Found || missing.Selection.Reason != "no VPCs found" || missing.VPCs == nil {
+		t.Errorf("got selection %+v and VPCs %v, want none found", missing.Selection, missing.VPCs)
+	}
+	if !strings.Contains(logged.String(), "frontend: no VPCs found") {
+		t.Errorf("expected a warning for frontend, got %q", logged)
+	}
+}
+
+func TestBuildAccountInfosFailures(t *testing.T) {
+	captureLog(t)
+
+	accounts := []PrismAccount{
+		{AccountNumber: "111", AccountName: "deploy-tools"},
+		{AccountNumber: "222", AccountName: "frontend"},
+		{AccountNumber: "333", AccountName: "backend"},
+	}
+	vpcs := map[AccountID][]PrismVPC{"111": {testVPC("vpc-1", 3, 3)}, "333": {testVPC("vpc-3", 3, 3)}}
+	fetchErrs := map[AccountID]error{"222": errors.New("connection refused")}
+	opts := BuildOptions{Selector: SubnetCountSelector{Range: standardSubnetRange}}
+
+	// A failed account is recorded, and the rest still built.
+	infos, summary := buildAccountInfos(context.Background(), accounts, vpcs, fetchErrs, opts)
+	if len(infos) != 2 || summary.Processed != 3 {
+		t.Errorf("got %d infos from %d processed, want 2 from 3", len(infos), summary.Processed)
+	}
+	if len(summary.Failures) != 1 || summary.Failures[0].Account != "frontend" || summary.Failures[0].Err.Error() != "connection refused" {
+		t.Errorf("got failures %v", summary.Failures)
+	}
+
+	// With StopOnError, nothing more is processed after the failure.
+	opts.StopOnError = true
+	infos, summary = buildAccountInfos(context.Background(), accounts, vpcs, fetchErrs, opts)
+	if len(infos) != 1 || summary.Processed != 2 || len(summary.Failures) != 1 {
+		t.Errorf("got %d infos, %d processed and failures %v, want to stop at frontend", len(infos), summary.Processed, summary.Failures)
+	}
+
+	// An invalid Typescript name fails just that account.
+	invalid := []PrismAccount{{AccountNumber: "111", AccountName: "legacy|tools"}}
+	infos, summary = buildAccountInfos(context.Background(), invalid, vpcs, nil, BuildOptions{Selector: opts.Selector})
+	if len(infos) != 0 || len(summary.Failures) != 1 || !strings.Contains(summary.Failures[0].Err.Error(), "is not a valid Typescript identifier") {
+		t.Errorf("got %d infos and failures %v", len(infos), summary.Failures)
+	}
+}
+
+func TestBuildAccountInfosInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+	infos, summary := buildAccountInfos(ctx, accounts, nil, nil, BuildOptions{Selector: SubnetCountSelector{Range: standardSubnetRange}})
+	if len(infos) != 0 || summary.Processed != 0 || !summary.Interrupted {
+		t.Errorf("got %d infos and summary %+v, want an interrupted run", len(infos), summary)
+	}
+}
+
+func TestBuildAccountInfosStaleData(t *testing.T) {
+	logged := captureLog(t)
+
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	vpc := testVPC("vpc-1", 3, 3)
+	vpc.LastUpdated = now.Add(-3 * 24 * time.Hour)
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+	vpcs := map[AccountID][]PrismVPC{"111": {vpc}}
+	opts := BuildOptions{Selector: SubnetCountSelector{Range: standardSubnetRange}, MaxAge: 24 * time.Hour, Now: now}
+
+	// Ages are measured against Now, so the message is repeatable.
+	want := "data for vpc-1 was last updated 72h0m0s ago"
+	infos, summary := buildAccountInfos(context.Background(), accounts, vpcs, nil, opts)
+	if len(infos) != 1 || len(summary.Failures) > 0 || !strings.Contains(logged.String(), want) {
+		t.Errorf("got %d infos, failures %v and log %q, want a warning %q", len(infos), summary.Failures, logged, want)
+	}
+
+	opts.Strict = true
+	infos, summary = buildAccountInfos(context.Background(), accounts, vpcs, nil, opts)
+	if len(infos) != 0 || len(summary.Failures) != 1 || summary.Failures[0].Err.Error() != want {
+		t.Errorf("got %d infos and failures %v, want a failure %q", len(infos), summary.Failures, want)
+	}
+}
+
+func TestBuildAccountInfosVPCOverride(t *testing.T) {
+	captureLog(t)
+
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+
+	// vpc-odd would never be chosen by the subnet counts; it has a subnet
+	// tagged to be left out, and vpc-other belongs to a different account.
+	odd := testVPC("vpc-odd", 1, 5)
+	odd.Subnets[0].Tags = map[string]string{"exclude": "true"}
+	other := testVPC("vpc-other", 3, 3)
+	other.AccountID = "222"
+	vpcs := map[AccountID][]PrismVPC{"111": {testVPC("vpc-standard", 3, 3), odd, other}}
+
+	build := func(vpcID string, opts BuildOptions) ([]AccountInfo, RunSummary) {
+		opts.Selector = SubnetCountSelector{Range: standardSubnetRange}
+		if vpcID != "" {
+			opts.Overrides = map[string]AccountOverride{"deploy-tools": {VPCID: vpcID}}
+		}
+		return buildAccountInfos(context.Background(), accounts, vpcs, nil, opts)
+	}
+
+	t.Run("present", func(t *testing.T) {
+		infos, summary := build("vpc-odd", BuildOptions{ExcludeSubnetTagKey: "exclude", ExcludeSubnetTagValue: "true"})
+		if len(summary.Failures) > 0 {
+			t.Fatalf("unexpected failures: %v", summary.Failures)
+		}
+
+		selection := infos[0].Selection
+		if !selection.Found || selection.VPC.VPCID != "vpc-odd" {
+			t.Fatalf("got %+v, want the configured vpc-odd", selection)
+		}
+		// The subnet filters still apply to a configured VPC.
+		if n := len(selection.VPC.Subnets); n != 5 {
+			t.Errorf("got %d subnets, want the 5 that weren't excluded", n)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		for _, vpcID := range []string{"vpc-missing", "vpc-other"} {
+			_, summary := build(vpcID, BuildOptions{})
+			if len(summary.Failures) != 1 || !strings.Contains(summary.Failures[0].Err.Error(), "is not one of the account's VPCs") {
+				t.Errorf("%s: got failures %v, want it reported as not the account's", vpcID, summary.Failures)
+			}
+		}
+	})
+
+	t.Run("excluded", func(t *testing.T) {
+		_, summary := build("vpc-odd", BuildOptions{ExcludeVPCIDs: []string{"vpc-odd"}})
+		if len(summary.Failures) != 1 || !strings.Contains(summary.Failures[0].Err.Error(), "was excluded") {
+			t.Errorf("got failures %v, want it reported as excluded", summary.Failures)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		infos, summary := build("", BuildOptions{})
+		if len(summary.Failures) > 0 {
+			t.Fatalf("unexpected failures: %v", summary.Failures)
+		}
+		if got := infos[0].Selection.VPC.VPCID; got != "vpc-standard" {
+			t.Errorf("got %s, want the heuristic's choice, vpc-standard", got)
+		}
+	})
+}
+
+func TestBuildAccountInfosJoinsProblems(t *testing.T) {
+	logged := captureLog(t)
+
+	// Stale, with a public subnet of the wrong size, another without an
+	// internet gateway route, and a name that isn't a valid identifier.
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	vpc := testVPC("vpc-1", 3, 3)
+	vpc.LastUpdated = now.Add(-48 * time.Hour)
+	vpc.Subnets[0].CIDR = "10.0.0.0/24"
+	noRoute := false
+	vpc.Subnets[1].HasInternetGatewayRoute = &noRoute
+
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "legacy|tools"}}
+	vpcs := map[AccountID][]PrismVPC{"111": {vpc}}
+	opts := BuildOptions{
+		Selector:     SubnetCountSelector{Range: standardSubnetRange},
+		MaxAge:       24 * time.Hour,
+		Now:          now,
+		PublicPrefix: 20,
+		Strict:       true,
+	}
+
+	want := []string{
+		"data for vpc-1 was last updated 48h0m0s ago",
+		"public subnet vpc-1-public-0 is 10.0.0.0/24, expected a /20",
+		"public subnets in vpc-1 have no internet gateway route: vpc-1-public-1",
+		`generated constant name "Legacy|ToolsAccount" is not a valid Typescript identifier`,
+	}
+
+	infos, summary := buildAccountInfos(context.Background(), accounts, vpcs, nil, opts)
+	if len(infos) != 0 || len(summary.Failures) != 1 {
+		t.Fatalf("got %d infos and failures %v, want one failure", len(infos), summary.Failures)
+	}
+	err := summary.Failures[0].Err
+	if err.Error() != strings.Join(want, "\n") {
+		t.Errorf("got:\n%v\nwant:\n%s", err, strings.Join(want, "\n"))
+	}
+	if problems := joinedErrors(err); len(problems) != len(want) {
+		t.Errorf("got %d problems, want %d", len(problems), len(want))
+	}
+
+	// Without -strict the data checks are warnings, so only the name fails.
+	opts.Strict = false
+	_, summary = buildAccountInfos(context.Background(), accounts, vpcs, nil, opts)
+	if len(summary.Failures) != 1 || summary.Failures[0].Err.Error() != want[3] {
+		t.Errorf("got failures %v, want just the name", summary.Failures)
+	}
+	for _, msg := range want[:3] {
+		if !strings.Contains(logged.String(), msg) {
+			t.Errorf("expected a warning %q, got:\n%s", msg, logged)
+		}
+	}
+}
+
+func TestBuildAccountInfosWarnsOnceAboutUnknownSubnets(t *testing.T) {
+	logged := captureLog(t)
+
+	vpc := testVPC("vpc-1", 3, 3)
+	vpc.Subnets = append(vpc.Subnets, PrismSubnet{SubnetID: "subnet-unknown"})
+
+	// Lenient and private-only fallbacks, included VPCs and multiple regions
+	// all run the selection more than once.
+	selector := SubnetCountSelector{Range: standardSubnetRange, Lenient: true, AllowPrivateOnly: true}
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+	_, summary := buildAccountInfos(context.Background(), accounts, map[AccountID][]PrismVPC{"111": {vpc}}, nil, BuildOptions{
+		Selector:      selector,
+		SubnetRange:   standardSubnetRange,
+		IncludeVPCIDs: []string{"vpc-1"},
+		MultiRegion:   true,
+	})
+
+	if len(summary.Failures) > 0 {
+		t.Fatalf("unexpected failures: %v", summary.Failures)
+	}
+
+	want := "deploy-tools: subnets that are neither public nor private are excluded from subnet counts: subnet-unknown (vpc-1)"
+	if n := strings.Count(logged.String(), "subnet-unknown"); n != 1 || !strings.Contains(logged.String(), want) {
+		t.Errorf("got %d warnings about subnet-unknown, want 1 %q:\n%s", n, want, logged)
+	}
+}
+
+func TestBuildAccountInfosTimeoutIsNotAnInterruption(t *testing.T) {
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+	vpcs := map[AccountID][]PrismVPC{"111": {testVPC("vpc-1", 3, 3)}}
+	opts := BuildOptions{Selector: SubnetCountSelector{Range: standardSubnetRange}}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	_, summary := buildAccountInfos(expired, accounts, vpcs, nil, opts)
+	if summary.Interrupted {
+		t.Error("a timeout shouldn't count as interrupted")
+	}
+	if len(summary.Failures) != 1 || errorCode(summary.Failures[0].Err) != "timeout" {
+		t.Errorf("got failures %v, want one timeout", summary.Failures)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, summary = buildAccountInfos(cancelled, accounts, vpcs, nil, opts)
+	if !summary.Interrupted || len(summary.Failures) > 0 {
+		t.Errorf("got interrupted %t and failures %v, want just interrupted", summary.Interrupted, summary.Failures)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long to wait for another run to finish with a cache entry before giving
+// up on the cache for that request.
+const cacheLockTimeout = 10 * time.Second
+
+// cacheEntry is a Prism response saved with '-cache-dir', so that the next
+// run can make a conditional request and reuse the body if it hasn't changed.
+type cacheEntry struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+	// The raw response body. It isn't necessarily valid JSON (see
+	// '-lenient-json'), so is stored as a string rather than
+	// json.RawMessage.
+	Body string `json:"body"`
+}
+
+// cachePath is the file for url in dir, which is locked via a '.lock' file
+// alongside it (see lockFile). The API version is part of the key as
+// it changes the shape of the response for the same URL.
+func cachePath(dir string, url string, apiVersion int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d %s", apiVersion, url)))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// readCache returns the cached response for url. A missing entry is not an
+// error, just 'ok' false.
+func readCache(dir string, url string, apiVersion int) (entry cacheEntry, ok bool, err error) {
+	path := cachePath(dir, url, apiVersion)
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return cacheEntry{}, false, nil
+	}
+
+	unlock, err := lockFile(path+".lock", false, cacheLockTimeout)
+	if err != nil {
+		return cacheEntry{}, false, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cacheEntry{}, false, nil
+	}
+	if err != nil {
+		return cacheEntry{}, false, err
+	}
+
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return cacheEntry{}, false, fmt.Errorf("invalid cache entry for %s: %w", url, err)
+	}
+
+	return entry, entry.URL == url, nil
+}
+
+func writeCache(dir string, entry cacheEntry, apiVersion int) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	path := cachePath(dir, entry.URL, apiVersion)
+	unlock, err := lockFile(path+".lock", true, cacheLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeFileAtomic(path, data)
+}
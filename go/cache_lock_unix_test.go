@@ -0,0 +1,55 @@
+//go:build unix
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.lock")
+
+	unlock, err := lockFile(path, true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another exclusive or shared lock has to wait, and gives up at the
+	// timeout rather than blocking forever.
+	for _, exclusive := range []bool{true, false} {
+		start := time.Now()
+		_, err := lockFile(path, exclusive, 100*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "timed out after 100ms waiting for lock") {
+			t.Errorf("exclusive %t: got %v, want a timeout", exclusive, err)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("exclusive %t: gave up after %s", exclusive, elapsed)
+		}
+	}
+
+	unlock()
+
+	// Readers can share the lock, but a writer waits for them.
+	unlockA, err := lockFile(path, false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockB, err := lockFile(path, false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockFile(path, true, 100*time.Millisecond); err == nil {
+		t.Error("got an exclusive lock while shared locks were held")
+	}
+	unlockA()
+	unlockB()
+
+	unlock, err = lockFile(path, true, time.Second)
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	unlock()
+}
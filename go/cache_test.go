@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCachePath(t *testing.T) {
+	a := cachePath("dir", "https://prism/vpcs", 0)
+	if a != cachePath("dir", "https://prism/vpcs", 0) {
+		t.Error("cachePath isn't stable")
+	}
+	if a == cachePath("dir", "https://prism/vpcs", 2) {
+		t.Error("the API version should be part of the cache key")
+	}
+	if a == cachePath("dir", "https://prism/vpcs?accountId=1", 0) {
+		t.Error("the query should be part of the cache key")
+	}
+}
+
+func TestReadWriteCache(t *testing.T) {
+	dir := t.TempDir()
+	url := "https://prism/vpcs"
+
+	if _, ok, err := readCache(dir, url, 0); ok || err != nil {
+		t.Errorf("got %t, %v for a missing entry; want false, nil", ok, err)
+	}
+
+	// The body needn't be valid JSON.
+	entry := cacheEntry{URL: url, ETag: `"v1"`, Body: `{"data": [1, 2,]}`}
+	if err := writeCache(dir, entry, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := readCache(dir, url, 0); !ok || err != nil || got != entry {
+		t.Errorf("got %+v, %t, %v; want %+v", got, ok, err, entry)
+	}
+
+	// Another API version has its own entry.
+	if _, ok, _ := readCache(dir, url, 2); ok {
+		t.Error("got a cached response for another API version")
+	}
+
+	if err := os.WriteFile(cachePath(dir, url, 0), []byte("nonsense"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := readCache(dir, url, 0); ok || err == nil || !strings.Contains(err.Error(), "invalid cache entry") {
+		t.Errorf("got %t, %v for a corrupt entry", ok, err)
+	}
+}
+
+// etagServer serves 'body' with 'etag', answering 304 to a matching
+// If-None-Match, and records the If-None-Match headers it receives.
+type etagServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	etag        string
+	body        string
+	ifNoneMatch []string
+}
+
+func newETagServer(t *testing.T, etag string, body string) *etagServer {
+	s := &etagServer{etag: etag, body: body}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+		if s.etag != "" && r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if s.etag != "" {
+			w.Header().Set("ETag", s.etag)
+		}
+		w.Write([]byte(s.body))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *etagServer) update(etag string, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.etag, s.body = etag, body
+}
+
+func TestPrismETagCache(t *testing.T) {
+	server := newETagServer(t, `"v1"`, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+	prism := Prism{BaseURL: server.URL, Client: server.Client(), CacheDir: t.TempDir()}
+
+	get := func() []PrismAccount {
+		t.Helper()
+		accounts, err := prism.getAccounts(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return accounts
+	}
+
+	// The first request is unconditional; the second revalidates and reuses
+	// the cached body on a 304.
+	first, second := get(), get()
+	if len(first) != 1 || len(second) != 1 || second[0] != first[0] {
+		t.Errorf("got %v then %v", first, second)
+	}
+
+	// A changed response replaces the cached one.
+	server.update(`"v2"`, `{"data": [{"accountNumber": "222", "accountName": "frontend"}]}`)
+	if got := get(); len(got) != 1 || got[0].AccountName != "frontend" {
+		t.Errorf("got %v after the response changed", got)
+	}
+	if got := get(); len(got) != 1 || got[0].AccountName != "frontend" {
+		t.Errorf("got %v from the updated cache", got)
+	}
+
+	want := []string{"", `"v1"`, `"v1"`, `"v2"`}
+	if strings.Join(server.ifNoneMatch, " ") != strings.Join(want, " ") {
+		t.Errorf("got If-None-Match %q, want %q", server.ifNoneMatch, want)
+	}
+}
+
+func TestPrismETagCacheWithoutETag(t *testing.T) {
+	server := newETagServer(t, "", `{"data": []}`)
+	dir := t.TempDir()
+	prism := Prism{BaseURL: server.URL, Client: server.Client(), CacheDir: dir}
+
+	for i := 0; i < 2; i++ {
+		if _, err := prism.getAccounts(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Responses without an ETag aren't cached, so every request is
+	// unconditional.
+	if entries, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(entries) != 0 {
+		t.Errorf("got %d cache entries, want none", len(entries))
+	}
+	if strings.Join(server.ifNoneMatch, ",") != "," {
+		t.Errorf("got If-None-Match %q", server.ifNoneMatch)
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+	url := "https://prism/vpcs"
+
+	// Large bodies make a torn read or write more likely to show up.
+	bodies := map[string]string{
+		`"a"`: strings.Repeat("a", 1<<20),
+		`"b"`: strings.Repeat("b", 1<<20),
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for etag, body := range bodies {
+		etag, body := etag, body
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := writeCache(dir, cacheEntry{URL: url, ETag: etag, Body: body}, 0); err != nil {
+					errs <- err
+					return
+				}
+
+				entry, ok, err := readCache(dir, url, 0)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !ok || bodies[entry.ETag] != entry.Body {
+					errs <- fmt.Errorf("got a corrupt entry with ETag %s and a %d byte body", entry.ETag, len(entry.Body))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// availabilityZones returns the distinct AZs of the subnets, sorted.
+func availabilityZones(subnets []PrismSubnet) []string {
+	seen := map[string]bool{}
+	azs := []string{}
+
+	for _, subnet := range subnets {
+		if subnet.AvailabilityZone != "" && !seen[subnet.AvailabilityZone] {
+			seen[subnet.AvailabilityZone] = true
+			azs = append(azs, subnet.AvailabilityZone)
+		}
+	}
+
+	sort.Strings(azs)
+	return azs
+}
+
+// knownAvailabilityZones is like availabilityZones for the VPC's public,
+// private and reserved subnets, but 'ok' is false if any of them has no AZ in
+// Prism, as a partial list would be misleading.
+func knownAvailabilityZones(vpc PrismVPC) (azs []string, ok bool) {
+	subnets := append(append(prism.PublicSubnets(vpc.Subnets), prism.PrivateSubnets(vpc.Subnets)...), prism.ReservedSubnets(vpc.Subnets)...)
+	for _, subnet := range subnets {
+		if subnet.AvailabilityZone == "" {
+			return nil, false
+		}
+	}
+
+	return availabilityZones(subnets), len(subnets) > 0
+}
+
+func asTypescriptStringArray(values []string) string {
+	out := "["
+	for i, v := range values {
+		if i > 0 {
+			out += ", "
+		}
+		out += fmt.Sprintf("'%s'", v)
+	}
+
+	return out + "]"
+}
+
+// renderCDKAttributes writes a function that imports the account's primary VPC
+// into a CDK stack with 'Vpc.fromVpcAttributes', for '-format
+// cdk-attributes'. CDK pairs subnets with AZs by position, so subnets are
+// always ordered by AZ here, regardless of '-subnet-order'. If Prism is
+// missing the AZ of any of the subnets, availabilityZones is left out (with
+// a warning) rather than listing only some of them.
+func (info AccountInfo) renderCDKAttributes(w io.Writer, opts RenderOptions) error {
+	if !info.Selection.Found {
+		_, err := fmt.Fprintf(w, "// No suitable VPC found for %s: %s\n", info.AccountName, info.Selection.Reason)
+		return err
+	}
+
+	vpc := info.Selection.VPC
+	public := subnetIDs(orderSubnets(prism.PublicSubnets(vpc.Subnets), "az"))
+	private := subnetIDs(orderSubnets(prism.PrivateSubnets(vpc.Subnets), "az"))
+
+	azs := ""
+	if known, ok := knownAvailabilityZones(vpc); ok {
+		azs = fmt.Sprintf("\n        availabilityZones: %s,", asTypescriptStringArray(known))
+	} else {
+		warnf(info.AccountName, "some subnets in %s have no availability zone; leaving availabilityZones out of the CDK attributes", vpc.VPCID)
+	}
+
+	_, err := fmt.Fprintf(w, `import { Vpc } from 'aws-cdk-lib/aws-ec2';
+import type { IVpc } from 'aws-cdk-lib/aws-ec2';
+import type { Construct } from 'constructs';
+
+export function primaryVpcFor%s(scope: Construct): IVpc {
+    return Vpc.fromVpcAttributes(scope, 'Primary', {
+        vpcId: '%s',%s
+        publicSubnetIds: %s,
+        privateSubnetIds: %s,
+    });
+}
+`, info.constName(opts), vpc.VPCID, azs, asTypescriptStringArray(public), asTypescriptStringArray(private))
+
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// A stand-in for the real '../types' module so that generated files can be
+// compiled outside of the CDK repo. We only care that they are valid
+// Typescript here, not that they match the real props.
+const stubTypesModule = "export type AwsAccountSetupProps = any;\n"
+
+// checkTypescript implements the 'check' subcommand, which runs each generated
+// Typescript file through 'tsc --noEmit' and reports any that fail to compile.
+// Arguments are files or directories (searched for '*.ts' files).
+func checkTypescript(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	tscPath := fs.String("tsc", "tsc", "path to the Typescript compiler")
+	fs.Parse(args)
+
+	tsc, err := exec.LookPath(*tscPath)
+	if err != nil {
+		warnf("", "%s not found on PATH; skipping check", *tscPath)
+		return
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := typescriptFiles(paths)
+	check(err, "unable to find files to check")
+
+	if len(files) == 0 {
+		warnf("", "no Typescript files found in %s", strings.Join(paths, ", "))
+		return
+	}
+
+	failed := 0
+	for _, file := range files {
+		output, err := compileTypescript(tsc, file)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s\n%s\n", file, strings.TrimSpace(output))
+			continue
+		}
+
+		fmt.Printf("ok   %s\n", file)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d files failed to compile", failed, len(files))
+	}
+}
+
+// typescriptFiles expands the given paths into a list of '.ts' files, searching
+// directories recursively (for '-group-by' output). It skips 'index.ts' barrel
+// files, which import from their siblings, and '.cdk.ts' files, which need the
+// real CDK libraries.
+func typescriptFiles(paths []string) ([]string, error) {
+	files := []string{}
+
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !stat.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		// WalkDir calls the function for every file and directory under
+		// path, in lexical order.
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			base := entry.Name()
+			if !entry.IsDir() && strings.HasSuffix(base, ".ts") && base != "index.ts" && !strings.HasSuffix(base, ".cdk.ts") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// compileTypescript copies 'file' into a temporary directory alongside a stub
+// types module and compiles it, returning the compiler output.
+func compileTypescript(tsc string, file string) (string, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.MkdirTemp("", "vpc-examples-check")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = os.WriteFile(filepath.Join(tmp, "types.ts"), []byte(stubTypesModule), 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	accountsDir := filepath.Join(tmp, "accounts")
+	err = os.Mkdir(accountsDir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(accountsDir, filepath.Base(file))
+	err = os.WriteFile(target, content, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.Command(tsc, "--noEmit", "--pretty", "false", target)
+	out, err := cmd.CombinedOutput()
+
+	// Point any errors back at the original file rather than our copy.
+	output := strings.ReplaceAll(string(out), target, file)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return output, fmt.Errorf("tsc exited with status %d", exitErr.ExitCode())
+	}
+
+	return output, err
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTypescriptFiles(t *testing.T) {
+	// t.TempDir is removed automatically when the test finishes.
+	dir := t.TempDir()
+	for _, name := range []string{"deploy-tools.ts", "deploy-tools.cdk.ts", "index.ts", "notes.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := typescriptFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "deploy-tools.ts")}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Directories are searched recursively, as with '-group-by stack'.
+	nested := filepath.Join(dir, "Tools", "Frontend.ts")
+	if err := os.MkdirAll(filepath.Dir(nested), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(nested, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = typescriptFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{nested, filepath.Join(dir, "deploy-tools.ts")}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Files named explicitly are checked even if they'd be skipped in a
+	// directory.
+	index := filepath.Join(dir, "index.ts")
+	got, err = typescriptFiles([]string{index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, []string{index}) {
+		t.Errorf("got %v, want %v", got, []string{index})
+	}
+
+	if _, err := typescriptFiles([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestCompileTypescript(t *testing.T) {
+	tsc, err := exec.LookPath("tsc")
+	if err != nil {
+		t.Skip("tsc is not installed")
+	}
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.ts")
+	invalid := filepath.Join(dir, "invalid.ts")
+	for file, content := range map[string]string{
+		valid:   "import type { AwsAccountSetupProps } from '../types';\n\nexport const a: AwsAccountSetupProps = { b: 'c' };\n",
+		invalid: "export const a = {\n",
+	} {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out, err := compileTypescript(tsc, valid); err != nil {
+		t.Errorf("valid file failed to compile: %v\n%s", err, out)
+	}
+
+	// Errors point at the original file, not the temporary copy.
+	out, err := compileTypescript(tsc, invalid)
+	if err == nil || !strings.Contains(out, invalid) {
+		t.Errorf("got %v and output:\n%s", err, out)
+	}
+}
+
+func TestCheckWithoutTsc(t *testing.T) {
+	out, err := runMain(t, "check", "-tsc", "no-such-tsc", t.TempDir())
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, "no-such-tsc not found on PATH; skipping check") {
+		t.Errorf("expected a warning, got %q", out)
+	}
+}
+
+func TestCheckGroupedOutput(t *testing.T) {
+	tsc, _ := stubCommand(t, "0")
+
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "Tools", "DeployTools.ts")
+	if err := os.MkdirAll(filepath.Dir(nested), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(nested, []byte("export const x = 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runMain(t, "check", "-tsc", tsc, dir)
+	if err != nil || !strings.Contains(out, "ok   "+nested) {
+		t.Errorf("expected %s to be checked, got %v: %s", nested, err, out)
+	}
+
+	// Finding nothing to check is worth a warning, not silent success.
+	empty := t.TempDir()
+	out, err = runMain(t, "check", "-tsc", tsc, empty)
+	if err != nil || !strings.Contains(out, "warning: no Typescript files found in "+empty) {
+		t.Errorf("expected a warning, got %v: %s", err, out)
+	}
+}
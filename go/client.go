@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options for newHTTPClient.
+type ClientOptions struct {
+	// An explicit proxy URL, overriding the environment.
+	Proxy string
+	// Log each request and response; see tracingTransport.
+	Trace bool
+	// The maximum requests per second to each host, or 0 for no limit.
+	RatePerHost float64
+}
+
+// newHTTPClient returns the client used for Prism requests. Requests go via
+// the proxy from the standard HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment
+// variables, unless an explicit proxy URL is given.
+func newHTTPClient(opts ClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse proxy URL %q: %w", opts.Proxy, err)
+		}
+
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("proxy URL %q must include a scheme and host", opts.Proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var rt http.RoundTripper = transport
+	if opts.Trace {
+		rt = tracingTransport{next: rt}
+	}
+	if opts.RatePerHost > 0 {
+		rt = newRateLimitedTransport(rt, opts.RatePerHost)
+	}
+
+	return &http.Client{Transport: rt, Timeout: 30 * time.Second}, nil
+}
+
+// rateLimitedTransport spaces out requests to each host so that there are at
+// most 'rate' per second. Each host is paced independently, so that e.g. the
+// accounts and VPCs endpoints don't share a budget if they're on different
+// hosts.
+type rateLimitedTransport struct {
+	next     http.RoundTripper
+	interval time.Duration
+
+	mu sync.Mutex
+	// When the next request to each host may be sent.
+	slots map[string]time.Time
+}
+
+func newRateLimitedTransport(next http.RoundTripper, rate float64) *rateLimitedTransport {
+	return &rateLimitedTransport{
+		next:     next,
+		interval: time.Duration(float64(time.Second) / rate),
+		slots:    map[string]time.Time{},
+	}
+}
+
+// reserve claims the next slot for host, returning how long to wait for it.
+func (t *rateLimitedTransport) reserve(host string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	slot := t.slots[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	t.slots[host] = slot.Add(t.interval)
+
+	return slot.Sub(now)
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := sleep(req.Context(), t.reserve(req.URL.Host, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(req)
+}
+
+// tracingTransport logs each request's method, URL and headers, and the
+// response's status and size, for debugging Prism issues. Bodies aren't
+// logged, and nor is the Authorization header.
+//
+// http.RoundTripper is the equivalent of a middleware: any type with this
+// RoundTrip method can wrap the real transport.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	log.Printf("trace: %s %s %s", req.Method, req.URL, formatHeaders(req.Header))
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		log.Printf("trace: %s %s failed after %s: %v", req.Method, req.URL, time.Since(start).Round(time.Millisecond), err)
+		return nil, err
+	}
+
+	log.Printf("trace: %s %s -> %s in %s %s", req.Method, req.URL, resp.Status, time.Since(start).Round(time.Millisecond), formatHeaders(resp.Header))
+	resp.Body = &countingBody{ReadCloser: resp.Body, url: req.URL.String()}
+
+	return resp, nil
+}
+
+// formatHeaders renders headers sorted by name, with credentials redacted.
+func formatHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{}
+	for _, name := range names {
+		value := strings.Join(h.Values(name), ", ")
+		if name == "Authorization" || name == "Proxy-Authorization" || name == "Cookie" {
+			value = "REDACTED"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", name, value))
+	}
+
+	return "[" + strings.Join(parts, "; ") + "]"
+}
+
+// countingBody logs how many bytes were read from a response body once it's
+// closed.
+type countingBody struct {
+	io.ReadCloser
+	url string
+	n   int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	log.Printf("trace: %s read %d bytes", b.url, b.n)
+	return b.ReadCloser.Close()
+}
+
+// headerFlag collects repeated '-request-header "Key: Value"' flags.
+//
+// Implementing flag.Value (String and Set) lets the flag package parse custom
+// types, a bit like a scopt Read instance in Scala.
+type headerFlag struct {
+	header http.Header
+}
+
+func (f *headerFlag) String() string {
+	if f.header == nil {
+		return ""
+	}
+	return formatHeaders(f.header)
+}
+
+func (f *headerFlag) Set(s string) error {
+	name, value, err := parseHeader(s)
+	if err != nil {
+		return err
+	}
+
+	if f.header == nil {
+		f.header = http.Header{}
+	}
+	f.header.Add(name, value)
+
+	return nil
+}
+
+var headerNamePattern = regexp.MustCompile(`^[!#$%&'*+.^_|~0-9A-Za-z-]+$`)
+
+// parseHeader parses a 'Key: Value' header.
+func parseHeader(s string) (string, string, error) {
+	name, value, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", "", fmt.Errorf("header %q must be of the form 'Key: Value'", s)
+	}
+
+	name = strings.TrimSpace(name)
+	if !headerNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid header name %q", name)
+	}
+
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, "\r\n") {
+		return "", "", fmt.Errorf("header %s has a newline in its value", name)
+	}
+
+	return http.CanonicalHeaderKey(name), value, nil
+}
+
+// Headers that custom request headers only replace if explicitly allowed.
+var protectedHeaders = []string{"Authorization", "User-Agent"}
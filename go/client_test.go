@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPClientUsesProxy(t *testing.T) {
+	// A proxy receives the absolute URL of the request it's forwarding, so a
+	// plain httptest server can stand in for one.
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+	}))
+	defer proxy.Close()
+
+	client, err := newHTTPClient(ClientOptions{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := Prism{BaseURL: "http://prism.example", Client: client}.getAccounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 {
+		t.Errorf("got %+v", accounts)
+	}
+	if proxied != "http://prism.example/sources/accounts" {
+		t.Errorf("proxy saw %q, want the Prism accounts URL", proxied)
+	}
+}
+
+func TestNewHTTPClientInvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"://nope", "prism-proxy:3128"} {
+		if _, err := newHTTPClient(ClientOptions{Proxy: proxy}); err == nil {
+			t.Errorf("newHTTPClient(%q) should fail", proxy)
+		}
+	}
+}
+
+func TestTracingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "test")
+		// The body itself shouldn't appear in the trace.
+		fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "secret-name"}]}`)
+	}))
+	defer server.Close()
+
+	client, err := newHTTPClient(ClientOptions{Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := captureLog(t)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/sources/accounts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer hunter2")
+	req.Header.Set("Cookie", "session=hunter2")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	trace := logged.String()
+	for _, want := range []string{
+		"trace: GET " + server.URL + "/sources/accounts [Accept: application/json; Authorization: REDACTED; Cookie: REDACTED]",
+		"-> 200 OK in ",
+		"X-Served-By: test",
+		fmt.Sprintf("read %d bytes", len(body)),
+	} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("expected %q in the trace:\n%s", want, trace)
+		}
+	}
+	for _, unwanted := range []string{"hunter2", "secret-name"} {
+		if strings.Contains(trace, unwanted) {
+			t.Errorf("the trace contains %q:\n%s", unwanted, trace)
+		}
+	}
+}
+
+func TestTracingTransportFailure(t *testing.T) {
+	client, err := newHTTPClient(ClientOptions{Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := captureLog(t)
+
+	// Nothing listens on port 1.
+	if _, err := client.Get("http://127.0.0.1:1/vpcs"); err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if !strings.Contains(logged.String(), "trace: GET http://127.0.0.1:1/vpcs failed after") {
+		t.Errorf("got trace %q", logged)
+	}
+}
+
+func TestWithoutTrace(t *testing.T) {
+	client, err := newHTTPClient(ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.Transport.(tracingTransport); ok {
+		t.Error("tracing is on without -trace")
+	}
+}
+
+func TestRateLimitedTransportReserve(t *testing.T) {
+	// Two requests a second, so slots are 500ms apart.
+	limiter := newRateLimitedTransport(http.DefaultTransport, 2)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		host  string
+		after time.Duration
+		want  time.Duration
+	}{
+		{"accounts.example", 0, 0},
+		{"accounts.example", 0, 500 * time.Millisecond},
+		{"accounts.example", 0, time.Second},
+		// Another host has its own budget.
+		{"vpcs.example", 0, 0},
+		{"vpcs.example", 100 * time.Millisecond, 400 * time.Millisecond},
+		// Once the backlog has passed, requests go straight away again.
+		{"accounts.example", 2 * time.Second, 0},
+		{"accounts.example", 2 * time.Second, 500 * time.Millisecond},
+	}
+
+	for i, step := range steps {
+		if got := limiter.reserve(step.host, start.Add(step.after)); got != step.want {
+			t.Errorf("step %d (%s at +%s): got a wait of %s, want %s", i, step.host, step.after, got, step.want)
+		}
+	}
+}
+
+func TestRateLimitedTransportHosts(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": []}`)
+	})
+	accounts := httptest.NewServer(handler)
+	defer accounts.Close()
+	vpcs := httptest.NewServer(handler)
+	defer vpcs.Close()
+
+	client, err := newHTTPClient(ClientOptions{RatePerHost: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(url string) {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// One request to each host is allowed straight away, but a second to
+	// the same host waits for the next slot. (TestRateLimitedTransportReserve
+	// checks the exact pacing without a real clock.)
+	start := time.Now()
+	get(accounts.URL)
+	get(vpcs.URL)
+	get(accounts.URL)
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("a second request to the same host was sent after %s", elapsed)
+	}
+	if slots := len(client.Transport.(*rateLimitedTransport).slots); slots != 2 {
+		t.Errorf("got %d hosts paced, want 2", slots)
+	}
+}
+
+func TestRateLimitedTransportCancelled(t *testing.T) {
+	limiter := newRateLimitedTransport(http.DefaultTransport, 0.001)
+	limiter.reserve("prism.example", time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://prism.example/vpcs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rather than waiting over 15 minutes for a slot.
+	if _, err := limiter.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		in    string
+		name  string
+		value string
+		err   string
+	}{
+		{"X-Request-ID: abc", "X-Request-Id", "abc", ""},
+		{"x-feature:  on ", "X-Feature", "on", ""},
+		{"X-Empty:", "X-Empty", "", ""},
+		{"X-Url: https://example.com:8080", "X-Url", "https://example.com:8080", ""},
+		{"X-Request-ID abc", "", "", `header "X-Request-ID abc" must be of the form 'Key: Value'`},
+		{": abc", "", "", `invalid header name ""`},
+		{"X Request: abc", "", "", `invalid header name "X Request"`},
+		{"X-Injected: a\r\nHost: evil", "", "", "header X-Injected has a newline in its value"},
+	}
+
+	for _, tt := range tests {
+		name, value, err := parseHeader(tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseHeader(%q) error = %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || name != tt.name || value != tt.value {
+			t.Errorf("parseHeader(%q) = %q, %q, %v; want %q, %q", tt.in, name, value, err, tt.name, tt.value)
+		}
+	}
+}
+
+func TestHeaderFlag(t *testing.T) {
+	var f headerFlag
+	if f.String() != "" {
+		t.Errorf("got %q for an unset flag", f.String())
+	}
+
+	for _, s := range []string{"X-Trace: 1", "X-Trace: 2", "X-Request-ID: abc"} {
+		if err := f.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Set("nonsense"); err == nil {
+		t.Error("expected an error for an invalid header")
+	}
+
+	// Repeated headers are kept, rather than replaced.
+	if got := f.header.Values("X-Trace"); len(got) != 2 {
+		t.Errorf("got X-Trace %v, want both values", got)
+	}
+	if want := "[X-Request-Id: abc; X-Trace: 1, 2]"; f.String() != want {
+		t.Errorf("got %q, want %q", f.String(), want)
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var mu sync.Mutex
+	received := []http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Clone())
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/sources/accounts":
+			fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+		default:
+			fmt.Fprint(w, `{"data": {"vpcs": []}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	out, err := runMain(t, "-prism-url", server.URL, "-request-header", "X-Request-ID: abc", "-request-header", "X-Feature: on")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) == 0 {
+		t.Fatal("no requests received")
+	}
+	for _, h := range received {
+		if h.Get("X-Request-Id") != "abc" || h.Get("X-Feature") != "on" {
+			t.Errorf("request missing custom headers: %v", h)
+		}
+	}
+
+	for _, name := range []string{"Authorization", "user-agent"} {
+		out, err := runMain(t, "-request-header", name+": x")
+		if err == nil || !strings.Contains(out, "set -override-protected-headers if that's intended") {
+			t.Errorf("%s: got %v: %s", name, err, out)
+		}
+	}
+}
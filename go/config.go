@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/nicl/scala-school-example/prism"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is loaded from the YAML file given by '-config', and from the
+// per-environment file '<config-dir>/<env>.yaml'. For example:
+//
+//	prismUrl: https://prism.gutools.co.uk
+//	aliases:
+//	  prod: ophan-production
+//	defaults:
+//	  stack: deploy
+//	  bucketForArtifacts: deploy-tools-dist
+//	  bucketForPrivateConfig: deploy-tools-private
+//	  streamNameTemplate: '{{.AccountName}}-logging'
+//	accounts:
+//	  ophan-production:
+//	    vpcId: vpc-0123456789abcdef0
+type Config struct {
+	PrismURL string `yaml:"prismUrl"`
+	// Friendly names for accounts, mapping alias to Prism account name (or
+	// number).
+	Aliases  map[string]string `yaml:"aliases"`
+	Defaults AccountDefaults   `yaml:"defaults"`
+	// Per-account settings, keyed by account name or number.
+	Accounts map[string]AccountOverride `yaml:"accounts"`
+}
+
+// AccountOverride replaces the usual behaviour for a single account.
+type AccountOverride struct {
+	// Use this VPC as the primary VPC rather than choosing one.
+	VPCID string `yaml:"vpcId"`
+}
+
+// overrideFor returns the override for the account, if any, preferring one
+// keyed by account number to one keyed by name.
+func overrideFor(overrides map[string]AccountOverride, account PrismAccount) (AccountOverride, bool) {
+	if override, ok := overrides[account.AccountNumber]; ok {
+		return override, true
+	}
+
+	override, ok := overrides[account.AccountName]
+	return override, ok
+}
+
+// AccountDefaults are the values used for every generated account. Empty
+// fields are unset.
+type AccountDefaults struct {
+	Stack                  string `yaml:"stack"`
+	BucketForArtifacts     string `yaml:"bucketForArtifacts"`
+	BucketForPrivateConfig string `yaml:"bucketForPrivateConfig"`
+	StreamNameTemplate     string `yaml:"streamNameTemplate"`
+}
+
+// merge returns d with any fields set in 'other' taking precedence.
+func (d AccountDefaults) merge(other AccountDefaults) AccountDefaults {
+	override := func(a string, b string) string {
+		if b != "" {
+			return b
+		}
+		return a
+	}
+
+	return AccountDefaults{
+		Stack:                  override(d.Stack, other.Stack),
+		BucketForArtifacts:     override(d.BucketForArtifacts, other.BucketForArtifacts),
+		BucketForPrivateConfig: override(d.BucketForPrivateConfig, other.BucketForPrivateConfig),
+		StreamNameTemplate:     override(d.StreamNameTemplate, other.StreamNameTemplate),
+	}
+}
+
+// mergeMaps combines maps (e.g. of aliases), with later maps taking
+// precedence.
+func mergeMaps[V any](maps ...map[string]V) map[string]V {
+	out := map[string]V{}
+	for _, m := range maps {
+		for alias, target := range m {
+			out[alias] = target
+		}
+	}
+
+	return out
+}
+
+// loadEnvironmentConfig loads '<dir>/<env>.yaml', which must set all of the
+// account defaults - the point being to have no 'TODO's left in the output.
+func loadEnvironmentConfig(dir string, env string) (Config, error) {
+	path := filepath.Join(dir, env+".yaml")
+
+	config, err := loadConfig(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	missing := []string{}
+	required := map[string]string{
+		"defaults.stack":                  config.Defaults.Stack,
+		"defaults.bucketForArtifacts":     config.Defaults.BucketForArtifacts,
+		"defaults.bucketForPrivateConfig": config.Defaults.BucketForPrivateConfig,
+	}
+	for key, value := range required {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return Config{}, fmt.Errorf("%s is missing required keys: %s", path, strings.Join(missing, ", "))
+	}
+
+	return config, nil
+}
+
+func loadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	var config Config
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	err = dec.Decode(&config)
+	// On a *yaml.TypeError (e.g. unknown keys) the rest of the config is
+	// still decoded, which validate-config uses to report everything at once.
+	if err != nil && !errors.Is(err, io.EOF) {
+		return config, fmt.Errorf("unable to parse config %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// resolveAliases maps any aliases in 'names' to the Prism account they refer
+// to. A name which is a real Prism account name or number always refers to that
+// account, even if it is also configured as an alias.
+func resolveAliases(names []string, aliases map[string]string, lookup prism.AccountLookup) []string {
+	out := []string{}
+
+	for _, name := range names {
+		_, isName := lookup.GetAccountByName(name)
+		_, isNumber := lookup.GetAccountByNumber(name)
+		target, isAlias := aliases[name]
+
+		switch {
+		case (isName || isNumber) && isAlias:
+			warnf("", "alias %s is also a Prism account; using the account rather than %s", name, target)
+			out = append(out, name)
+		case isAlias:
+			_, targetIsName := lookup.GetAccountByName(target)
+			_, targetIsNumber := lookup.GetAccountByNumber(target)
+			if !targetIsName && !targetIsNumber {
+				warnf("", "alias %s refers to %s, which is not a Prism account", name, target)
+			}
+			out = append(out, target)
+		default:
+			out = append(out, name)
+		}
+	}
+
+	return out
+}
+
+var digitsPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// validateConfig checks the config for mistakes that loadConfig can't catch,
+// returning all of them rather than just the first.
+func validateConfig(config Config) []error {
+	errs := []error{}
+
+	if config.PrismURL != "" {
+		if err := validateURL(config.PrismURL); err != nil {
+			errs = append(errs, fmt.Errorf("prismUrl: %w", err))
+		}
+	}
+
+	aliases := sortedKeys(config.Aliases)
+	for _, alias := range aliases {
+		target := config.Aliases[alias]
+
+		switch {
+		case strings.TrimSpace(alias) == "":
+			errs = append(errs, errors.New("aliases: alias names can't be empty"))
+		case target == "":
+			errs = append(errs, fmt.Errorf("aliases.%s: target can't be empty", alias))
+		case digitsPattern.MatchString(target) && !accountNumberPattern.MatchString(target):
+			errs = append(errs, fmt.Errorf("aliases.%s: %q is not a valid 12-digit account number", alias, target))
+		case !digitsPattern.MatchString(target) && !isIdentifier(camelCase(target)+"Account"):
+			errs = append(errs, fmt.Errorf("aliases.%s: account name %q doesn't give a valid Typescript identifier", alias, target))
+		}
+	}
+
+	accounts := sortedKeys(config.Accounts)
+	for _, account := range accounts {
+		if id := config.Accounts[account].VPCID; id != "" && !strings.HasPrefix(id, "vpc-") {
+			errs = append(errs, fmt.Errorf("accounts.%s.vpcId: %q is not a VPC ID", account, id))
+		}
+	}
+
+	if tmpl := config.Defaults.StreamNameTemplate; tmpl != "" {
+		if _, err := template.New("stream-name").Parse(tmpl); err != nil {
+			errs = append(errs, fmt.Errorf("defaults.streamNameTemplate: %w", err))
+		}
+	}
+
+	return errs
+}
+
+// validateConfigFile implements the 'validate-config' subcommand, which
+// reports every problem with a config file without running.
+func validateConfigFile(args []string) {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	path := fs.String("config", "", "the YAML config file to validate")
+	fs.Parse(args)
+
+	if *path == "" {
+		usagef("validate-config requires -config")
+	}
+
+	errs := []error{}
+
+	config, err := loadConfig(*path)
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, errors.New(msg))
+		}
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	errs = append(errs, validateConfig(config)...)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *path, err)
+	}
+
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s is valid\n", *path)
+}
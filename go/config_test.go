@@ -0,0 +1,332 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := loadConfig(writeConfig(t, "aliases:\n  prod: ophan-production\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Aliases["prod"] != "ophan-production" {
+		t.Errorf("got %+v", config)
+	}
+
+	// An empty file is a valid, empty config.
+	if _, err := loadConfig(writeConfig(t, "")); err != nil {
+		t.Errorf("empty config: %v", err)
+	}
+
+	// Typos in keys are caught rather than silently ignored.
+	if _, err := loadConfig(writeConfig(t, "alias:\n  prod: ophan-production\n")); err == nil || !strings.Contains(err.Error(), "unable to parse config") {
+		t.Errorf("got %v, want a parse error for an unknown key", err)
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestResolveAliases(t *testing.T) {
+	lookup := prism.NewAccountLookup([]PrismAccount{
+		{AccountNumber: "111", AccountName: "ophan-production"},
+		{AccountNumber: "222", AccountName: "frontend"},
+	})
+	aliases := map[string]string{
+		"prod":     "ophan-production",
+		"fe":       "222",
+		"frontend": "ophan-production", // collides with a real account
+		"typo":     "ophan-prodution",
+		"chain":    "prod",
+		"loop-a":   "loop-b",
+		"loop-b":   "loop-a",
+	}
+
+	tests := []struct {
+		name string
+		want string
+		warn string
+	}{
+		{"prod", "ophan-production", ""},
+		{"fe", "222", ""},
+		{"111", "111", ""},
+		{"unaliased", "unaliased", ""},
+		{"frontend", "frontend", "alias frontend is also a Prism account; using the account rather than ophan-production"},
+		{"typo", "ophan-prodution", "alias typo refers to ophan-prodution, which is not a Prism account"},
+		// Aliases refer to accounts, not to other aliases, so chains and
+		// cycles stop after one step (and warn).
+		{"chain", "prod", "alias chain refers to prod, which is not a Prism account"},
+		{"loop-a", "loop-b", "alias loop-a refers to loop-b, which is not a Prism account"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logged := captureLog(t)
+
+			got := resolveAliases([]string{tt.name}, aliases, lookup)
+			if !slices.Equal(got, []string{tt.want}) {
+				t.Errorf("got %v, want [%s]", got, tt.want)
+			}
+			if tt.warn == "" && logged.Len() > 0 {
+				t.Errorf("unexpected warning %q", logged)
+			}
+			if !strings.Contains(logged.String(), tt.warn) {
+				t.Errorf("got warnings %q, want %q", logged, tt.warn)
+			}
+		})
+	}
+}
+
+func TestLoadEnvironmentConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(env string, content string) {
+		if err := os.WriteFile(filepath.Join(dir, env+".yaml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("prod", "defaults:\n  stack: deploy\n  bucketForArtifacts: dist\n  bucketForPrivateConfig: private\n")
+	write("code", "defaults:\n  stack: deploy\n")
+
+	config, err := loadEnvironmentConfig(dir, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (AccountDefaults{Stack: "deploy", BucketForArtifacts: "dist", BucketForPrivateConfig: "private"}); config.Defaults != want {
+		t.Errorf("got %+v, want %+v", config.Defaults, want)
+	}
+
+	_, err = loadEnvironmentConfig(dir, "code")
+	if want := "missing required keys: defaults.bucketForArtifacts, defaults.bucketForPrivateConfig"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want an error containing %q", err, want)
+	}
+
+	if _, err := loadEnvironmentConfig(dir, "local"); err == nil {
+		t.Error("expected an error for a missing environment file")
+	}
+}
+
+func TestAccountDefaultsMerge(t *testing.T) {
+	base := AccountDefaults{Stack: "env-stack", BucketForArtifacts: "env-dist", BucketForPrivateConfig: "env-private"}
+	got := base.merge(AccountDefaults{Stack: "flag-stack"})
+
+	want := AccountDefaults{Stack: "flag-stack", BucketForArtifacts: "env-dist", BucketForPrivateConfig: "env-private"}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, "[]")
+
+	dir := t.TempDir()
+	envConfig := "prismUrl: " + server.URL + "\n" +
+		"aliases:\n  dt: deploy-tools\n" +
+		"defaults:\n  stack: env-stack\n  bucketForArtifacts: env-dist\n  bucketForPrivateConfig: env-private\n"
+	if err := os.WriteFile(filepath.Join(dir, "prod.yaml"), []byte(envConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := writeConfig(t, "defaults:\n  bucketForArtifacts: config-dist\n")
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"environment config only", nil, []string{"stack: 'env-stack'", "bucketForArtifacts: 'env-dist'", "bucketForPrivateConfig: 'env-private'"}},
+		{"config file beats environment", []string{"-config", config}, []string{"stack: 'env-stack'", "bucketForArtifacts: 'config-dist'"}},
+		{"flags beat both", []string{"-config", config, "-stack", "flag-stack", "-bucket-for-artifacts", "flag-dist"}, []string{"stack: 'flag-stack'", "bucketForArtifacts: 'flag-dist'", "bucketForPrivateConfig: 'env-private'"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The Prism URL and the 'dt' alias both come from the environment
+			// config.
+			args := append([]string{"-config-dir", dir, "-accounts", "dt"}, tt.args...)
+			out, err := runMain(t, args...)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected %s in the output:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := Config{
+		PrismURL: "https://prism.example.com",
+		Aliases:  map[string]string{"tools": "deploy-tools", "web": "123456789012"},
+		Defaults: AccountDefaults{StreamNameTemplate: "{{.AccountName}}-logs"},
+	}
+	if errs := validateConfig(valid); len(errs) != 0 {
+		t.Errorf("valid config: got %v", errs)
+	}
+	if errs := validateConfig(Config{}); len(errs) != 0 {
+		t.Errorf("empty config: got %v", errs)
+	}
+
+	invalid := Config{
+		PrismURL: "prism.example.com",
+		Aliases: map[string]string{
+			"":        "deploy-tools",
+			"empty":   "",
+			"short":   "12345678901",
+			"digits":  "9-lives",
+			"fine":    "frontend",
+			"toolong": "1234567890123",
+		},
+		Defaults: AccountDefaults{StreamNameTemplate: "{{.AccountName"},
+	}
+
+	// Every problem is reported, in a stable order.
+	var got []string
+	for _, err := range validateConfig(invalid) {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"prismUrl: ",
+		"aliases: alias names can't be empty",
+		"aliases.digits: account name \"9-lives\" doesn't give a valid Typescript identifier",
+		"aliases.empty: target can't be empty",
+		"aliases.short: \"12345678901\" is not a valid 12-digit account number",
+		"aliases.toolong: \"1234567890123\" is not a valid 12-digit account number",
+		"defaults.streamNameTemplate: ",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d errors, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("error %d: got %q, want prefix %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestValidateConfigCommand(t *testing.T) {
+	valid := writeConfig(t, "prismUrl: https://prism.example.com\naliases:\n  tools: deploy-tools\n")
+	out, err := runMain(t, "validate-config", "-config", valid)
+	if err != nil || !strings.Contains(out, valid+" is valid") {
+		t.Errorf("got %v: %s", err, out)
+	}
+
+	// Unknown keys and validation errors are reported together.
+	invalid := writeConfig(t, "prismUrl: prism.example.com\nalias:\n  tools: deploy-tools\naliases:\n  web: '12345'\n")
+	out, err = runMain(t, "validate-config", "-config", invalid)
+	if err == nil {
+		t.Errorf("expected invalid config to fail: %s", out)
+	}
+	for _, want := range []string{"field alias not found", "prismUrl: ", `aliases.web: "12345" is not a valid 12-digit account number`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+
+	// YAML that can't be parsed at all is a single error.
+	broken := writeConfig(t, "aliases: [\n")
+	if out, err := runMain(t, "validate-config", "-config", broken); err == nil || !strings.Contains(out, "unable to parse config") {
+		t.Errorf("got %v: %s", err, out)
+	}
+
+	if out, err := runMain(t, "validate-config"); err == nil || !strings.Contains(out, "validate-config requires -config") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestOverrideFor(t *testing.T) {
+	overrides := map[string]AccountOverride{
+		"deploy-tools": {VPCID: "vpc-by-name"},
+		"111":          {VPCID: "vpc-by-number"},
+		"frontend":     {VPCID: "vpc-frontend"},
+	}
+
+	tests := []struct {
+		account PrismAccount
+		want    string
+		ok      bool
+	}{
+		{PrismAccount{AccountNumber: "111", AccountName: "deploy-tools"}, "vpc-by-number", true},
+		{PrismAccount{AccountNumber: "222", AccountName: "frontend"}, "vpc-frontend", true},
+		{PrismAccount{AccountNumber: "333", AccountName: "sandbox"}, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := overrideFor(overrides, tt.account)
+		if got.VPCID != tt.want || ok != tt.ok {
+			t.Errorf("overrideFor(%+v) = %q, %t; want %q, %t", tt.account, got.VPCID, ok, tt.want, tt.ok)
+		}
+	}
+
+	errs := validateConfig(Config{Accounts: map[string]AccountOverride{"frontend": {VPCID: "subnet-1"}}})
+	if len(errs) != 1 || errs[0].Error() != `accounts.frontend.vpcId: "subnet-1" is not a VPC ID` {
+		t.Errorf("got %v", errs)
+	}
+}
+
+func TestAccountVPCOverride(t *testing.T) {
+	other := testVPC("vpc-other-account", 1, 1)
+	other.AccountID = "222"
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 3, 3), testVPC("vpc-b", 1, 1), other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "frontend"}
+	]`, string(vpcs))
+
+	run := func(config string) (string, error) {
+		return runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-config", writeConfig(t, config))
+	}
+
+	t.Run("forced selection", func(t *testing.T) {
+		out, err := run("accounts:\n  deploy-tools:\n    vpcId: vpc-b\n")
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !strings.Contains(out, `"vpcId":"vpc-b"`) {
+			t.Errorf("expected the configured VPC:\n%s", out)
+		}
+	})
+
+	t.Run("missing VPC", func(t *testing.T) {
+		for _, id := range []string{"vpc-missing", "vpc-other-account"} {
+			out, err := run("accounts:\n  '111':\n    vpcId: " + id + "\n")
+			if err == nil || !strings.Contains(out, "configured vpcId "+id+" is not one of the account's VPCs") {
+				t.Errorf("%s: got %v: %s", id, err, out)
+			}
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		out, err := run("accounts:\n  frontend:\n    vpcId: vpc-other-account\n")
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !strings.Contains(out, `"vpcId":"vpc-a"`) {
+			t.Errorf("expected the heuristic's choice:\n%s", out)
+		}
+	})
+}
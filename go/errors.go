@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Go errors are just values implementing the 'error' interface, so we can
+// define our own types to carry extra information. Callers use 'errors.As' to
+// check for a specific type, a bit like pattern matching on an exception in
+// Scala.
+
+// NetworkError indicates that the request to Prism could not be completed, or
+// the response body could not be read.
+type NetworkError struct {
+	URL string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("network error requesting %s: %v", e.URL, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError indicates that Prism responded with a non-2xx status code.
+type StatusError struct {
+	URL  string
+	Code int
+	Body string
+	// How long the server asked us to wait before retrying, from the
+	// Retry-After header (zero if absent).
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s: %s", e.Code, e.URL, e.Body)
+}
+
+// ParseError indicates that the Prism response body was not valid JSON (or
+// did not match the expected shape).
+type ParseError struct {
+	URL string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("unable to parse response from %s: %v", e.URL, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ResponseTooLargeError indicates that a Prism response was bigger than
+// Prism.MaxResponseBytes, so was abandoned rather than read into memory.
+type ResponseTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *ResponseTooLargeError) Error() string {
+	return fmt.Sprintf("response from %s exceeded size limit of %d bytes", e.URL, e.Limit)
+}
+
+// Set by '-error-format json', to report errors as JSON rather than text.
+var jsonErrors bool
+
+// ErrorReport is the JSON form of an error with '-error-format json'.
+type ErrorReport struct {
+	Error string `json:"error"`
+	// One of 'usage', 'network', 'http_status', 'parse', 'timeout',
+	// 'interrupted', 'too_large', 'warning' or (for anything else) 'error'.
+	Code string `json:"code"`
+	// The account being processed, if any.
+	Account string `json:"account,omitempty"`
+	// Each of the errors, for an account failing several checks at once
+	// (see joinedErrors). 'error' has them all too, separated by newlines.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// joinedErrors returns the errors combined with errors.Join (or anything else
+// with an 'Unwrap() []error' method), or nil if err is a single error.
+func joinedErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+
+	return joined.Unwrap()
+}
+
+// errorCode classifies err for ErrorReport.
+func errorCode(err error) string {
+	var networkErr *NetworkError
+	var statusErr *StatusError
+	var parseErr *ParseError
+	var usageErr usageError
+	var warningErr warningError
+	var tooLargeErr *ResponseTooLargeError
+
+	switch {
+	case errors.As(err, &usageErr):
+		return "usage"
+	case errors.As(err, &warningErr):
+		return "warning"
+	case errors.As(err, &tooLargeErr):
+		return "too_large"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "interrupted"
+	case errors.As(err, &statusErr):
+		return "http_status"
+	case errors.As(err, &parseErr):
+		return "parse"
+	case errors.As(err, &networkErr):
+		return "network"
+	default:
+		return "error"
+	}
+}
+
+// usageError is an invalid combination of flags or flag value.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// writeError writes err to w, as JSON with '-error-format json' and as plain
+// text otherwise (indented, to list it under the summary).
+func writeError(w io.Writer, err error, account string) {
+	errs := joinedErrors(err)
+
+	if !jsonErrors && len(errs) > 1 {
+		// One per line, under the account.
+		fmt.Fprintf(w, "  %s: %d problems\n", valueOr(account, "error"), len(errs))
+		for _, e := range errs {
+			fmt.Fprintf(w, "    - %v\n", e)
+		}
+		return
+	}
+
+	if !jsonErrors {
+		if account != "" {
+			fmt.Fprintf(w, "  %s: %v\n", account, err)
+		} else {
+			fmt.Fprintf(w, "  %v\n", err)
+		}
+		return
+	}
+
+	report := ErrorReport{Error: err.Error(), Code: errorCode(err), Account: account}
+	if len(errs) > 1 {
+		for _, e := range errs {
+			report.Problems = append(report.Problems, e.Error())
+		}
+	}
+
+	out, _ := json.Marshal(report)
+	fmt.Fprintln(w, string(out))
+}
+
+// fatal reports err and exits. Without '-error-format json' this is the same
+// as log.Fatal.
+func fatal(err error, account string) {
+	if !jsonErrors {
+		log.Fatal(err)
+	}
+
+	writeError(stderr, err, account)
+	os.Exit(1)
+}
+
+// usagef reports an invalid flag and exits.
+func usagef(format string, args ...any) {
+	fatal(usageError{msg: fmt.Sprintf(format, args...)}, "")
+}
+
+// Set by '-warn-as-error', to record every warning as an error in the run
+// summary (and so exit non-zero) instead of just logging it.
+var warnAsError bool
+
+// warningError is a warning promoted to an error by '-warn-as-error'.
+type warningError struct {
+	msg string
+}
+
+func (e warningError) Error() string {
+	return e.msg
+}
+
+// Warnings can come from concurrent Prism requests, so access is guarded by a
+// mutex. There's no 'synchronized' keyword in Go; the lock is just a value.
+var promoted struct {
+	sync.Mutex
+	failures []AccountFailure
+}
+
+// warnf logs a warning, optionally about a specific account, and records it
+// for the summary if '-warn-as-error' is set.
+func warnf(account string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if account != "" {
+		log.Printf("warning: %s: %s", account, msg)
+	} else {
+		log.Printf("warning: %s", msg)
+	}
+
+	if !warnAsError {
+		return
+	}
+
+	promoted.Lock()
+	defer promoted.Unlock()
+	promoted.failures = append(promoted.failures, AccountFailure{Account: account, Err: warningError{msg: msg}})
+}
+
+// promotedWarnings returns the warnings recorded so far by '-warn-as-error'.
+func promotedWarnings() []AccountFailure {
+	promoted.Lock()
+	defer promoted.Unlock()
+	return append([]AccountFailure{}, promoted.failures...)
+}
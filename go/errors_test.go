@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Go tests are plain functions starting with 'Test' that take a *testing.T,
+// run with 'go test'. There's no assertion DSL like ScalaTest's 'should' -
+// you compare values and call t.Errorf (or t.Fatalf to stop the test).
+
+func TestGetJSONErrorTypes(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "prism is down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	malformed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [`)
+	}))
+	defer malformed.Close()
+
+	// Closing the server straight away leaves a URL that nothing listens on.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	prism := Prism{Client: http.DefaultClient}
+	var wrapper PrismResponseAccountsWrapper
+
+	t.Run("status", func(t *testing.T) {
+		err := prism.getJSON(context.Background(), failing.URL, &wrapper)
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("got %v, want a *StatusError", err)
+		}
+		if statusErr.Code != http.StatusServiceUnavailable {
+			t.Errorf("got code %d, want %d", statusErr.Code, http.StatusServiceUnavailable)
+		}
+		if statusErr.Body != "prism is down\n" {
+			t.Errorf("got body %q, want %q", statusErr.Body, "prism is down\n")
+		}
+	})
+
+	t.Run("parse", func(t *testing.T) {
+		err := prism.getJSON(context.Background(), malformed.URL, &wrapper)
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("got %v, want a *ParseError", err)
+		}
+		if parseErr.URL != malformed.URL {
+			t.Errorf("got URL %s, want %s", parseErr.URL, malformed.URL)
+		}
+		if parseErr.Unwrap() == nil {
+			t.Error("ParseError should wrap the JSON error")
+		}
+	})
+
+	t.Run("network", func(t *testing.T) {
+		err := prism.getJSON(context.Background(), closed.URL, &wrapper)
+
+		var networkErr *NetworkError
+		if !errors.As(err, &networkErr) {
+			t.Fatalf("got %v, want a *NetworkError", err)
+		}
+		if networkErr.Unwrap() == nil {
+			t.Error("NetworkError should wrap the underlying error")
+		}
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		// Wrapping with %w, as getAccounts does, keeps the type visible to
+		// errors.As.
+		err := fmt.Errorf("unable to get prism accounts: %w", prism.getJSON(context.Background(), failing.URL, &wrapper))
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("got %v, want a wrapped *StatusError", err)
+		}
+	})
+}
+
+func TestGetJSONDecodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+	}))
+	defer server.Close()
+
+	prism := Prism{Client: http.DefaultClient}
+	var wrapper PrismResponseAccountsWrapper
+	if err := prism.getJSON(context.Background(), server.URL, &wrapper); err != nil {
+		t.Fatal(err)
+	}
+
+	want := PrismAccount{AccountNumber: "111", AccountName: "deploy-tools"}
+	if len(wrapper.Data) != 1 || wrapper.Data[0] != want {
+		t.Errorf("got %+v, want [%+v]", wrapper.Data, want)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{usageError{msg: "bad flag"}, "usage"},
+		{fmt.Errorf("fetching: %w", context.DeadlineExceeded), "timeout"},
+		{&NetworkError{URL: "u", Err: context.Canceled}, "interrupted"},
+		{fmt.Errorf("unable to fetch accounts: %w", &StatusError{URL: "u", Code: 500}), "http_status"},
+		{&ParseError{URL: "u", Err: errors.New("bad json")}, "parse"},
+		{fmt.Errorf("unable to fetch accounts: %w", &ResponseTooLargeError{URL: "u", Limit: 1}), "too_large"},
+		{&NetworkError{URL: "u", Err: errors.New("connection refused")}, "network"},
+		{errors.New("something else"), "error"},
+	}
+
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	var buf bytes.Buffer
+	writeError(&buf, errors.New("no VPCs"), "frontend")
+	writeError(&buf, errors.New("bad flag"), "")
+	if want := "  frontend: no VPCs\n  bad flag\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	jsonErrors = true
+	t.Cleanup(func() { jsonErrors = false })
+
+	buf.Reset()
+	writeError(&buf, &ParseError{URL: "u", Err: errors.New("bad json")}, "frontend")
+	writeError(&buf, usageError{msg: "bad flag"}, "")
+	want := `{"error":"unable to parse response from u: bad json","code":"parse","account":"frontend"}` + "\n" +
+		`{"error":"bad flag","code":"usage"}` + "\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteJoinedErrors(t *testing.T) {
+	joined := errors.Join(errors.New("data is stale"), errors.New("no internet gateway route"))
+
+	var buf bytes.Buffer
+	writeError(&buf, joined, "frontend")
+	writeError(&buf, errors.Join(errors.New("just one")), "frontend")
+	want := "  frontend: 2 problems\n    - data is stale\n    - no internet gateway route\n  frontend: just one\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	jsonErrors = true
+	t.Cleanup(func() { jsonErrors = false })
+
+	buf.Reset()
+	writeError(&buf, joined, "frontend")
+	var report ErrorReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Error != "data is stale\nno internet gateway route" || !slices.Equal(report.Problems, []string{"data is stale", "no internet gateway route"}) {
+		t.Errorf("got %+v", report)
+	}
+
+	if got := joinedErrors(errors.New("single")); got != nil {
+		t.Errorf("got %v for a single error, want nil", got)
+	}
+}
+
+func TestErrorFormatJSON(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "prism is down", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+
+	accounts := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "deploy-tools"}
+	]`, "[]")
+
+	tests := []struct {
+		name string
+		args []string
+		want ErrorReport
+	}{
+		{"usage", []string{"-group-by", "region"}, ErrorReport{Error: `invalid -group-by "region"; valid values are: none, stack`, Code: "usage"}},
+		{"http status", []string{"-prism-url", failing.URL, "-retries", "0"}, ErrorReport{Code: "http_status"}},
+		{"account", []string{"-prism-url", accounts.URL, "-strict"}, ErrorReport{Code: "error", Account: "deploy-tools"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runMain(t, append([]string{"-error-format", "json"}, tt.args...)...)
+			if err == nil {
+				t.Fatalf("expected the run to fail: %s", out)
+			}
+
+			// The JSON error is the last line, after any log output.
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			var got ErrorReport
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &got); err != nil {
+				t.Fatalf("last line isn't a JSON error (%v):\n%s", err, out)
+			}
+
+			if got.Code != tt.want.Code || got.Account != tt.want.Account || got.Error == "" || (tt.want.Error != "" && got.Error != tt.want.Error) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	out, err := runMain(t, "-error-format", "xml")
+	if err == nil || !strings.Contains(out, `invalid -error-format "xml"`) {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestWarnf(t *testing.T) {
+	logged := captureLog(t)
+	t.Cleanup(func() {
+		warnAsError = false
+		promoted.failures = nil
+	})
+
+	warnf("frontend", "no VPCs found")
+	if got := promotedWarnings(); len(got) != 0 {
+		t.Errorf("got %v recorded without -warn-as-error", got)
+	}
+
+	warnAsError = true
+	warnf("frontend", "no VPCs found")
+	warnf("", "prism returned no organisational unit data")
+
+	got := promotedWarnings()
+	if len(got) != 2 || got[0].Account != "frontend" || got[0].Err.Error() != "no VPCs found" || got[1].Account != "" {
+		t.Errorf("got %+v", got)
+	}
+	if code := errorCode(got[0].Err); code != "warning" {
+		t.Errorf("got code %q, want warning", code)
+	}
+
+	// Warnings are logged either way.
+	if n := strings.Count(logged.String(), "warning: frontend: no VPCs found"); n != 2 {
+		t.Errorf("got %d logged warnings, want 2:\n%s", n, logged)
+	}
+}
+
+func TestWarnAsError(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 3, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "frontend"}
+	]`, string(vpcs))
+
+	// Two accounts that don't exist, and one with no VPCs.
+	args := []string{"-prism-url", server.URL, "-accounts", "deploy-tools,frontend,missing-1,missing-2"}
+
+	out, err := runMain(t, args...)
+	if err != nil {
+		t.Fatalf("warnings alone shouldn't fail the run: %v: %s", err, out)
+	}
+
+	out, err = runMain(t, append(args, "-warn-as-error")...)
+	if err == nil {
+		t.Fatalf("expected -warn-as-error to fail the run: %s", out)
+	}
+
+	// Every warning is listed, and the rest of the run still happens.
+	for _, want := range []string{
+		"summary: 2 accounts processed, 3 failed",
+		"  missing-1: account not found in prism",
+		"  missing-2: account not found in prism",
+		"  frontend: no VPCs found",
+		"export const DeployToolsAccount",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var unsafeFixtureChars = regexp.MustCompile(`[^A-Za-z0-9=._-]+`)
+
+// fixtureName is the file a response is recorded to with '-record', based on
+// the request path and query (but not host, so that recordings can be
+// replayed against any Prism). For example '/vpcs?accountId=123' is saved as
+// 'vpcs_accountId=123.json'.
+func fixtureName(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.Trim(u.Path, "/")
+	if u.RawQuery != "" {
+		name += "?" + u.RawQuery
+	}
+
+	name = strings.Trim(unsafeFixtureChars.ReplaceAllString(name, "_"), "_.")
+	if name == "" {
+		name = "root"
+	}
+
+	return name + ".json", nil
+}
+
+func writeFixture(dir string, rawURL string, data []byte) error {
+	name, err := fixtureName(rawURL)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(dir, name), data)
+}
+
+func readFixture(dir string, rawURL string) ([]byte, error) {
+	name, err := fixtureName(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no recorded response for %s in %s (expected %s)", rawURL, dir, name)
+	}
+
+	return data, err
+}
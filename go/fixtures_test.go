@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := map[string]string{
+		"https://prism.example.com/sources/accounts":      "sources_accounts.json",
+		"https://prism.example.com/vpcs?accountId=123":    "vpcs_accountId=123.json",
+		"http://localhost:8080/vpcs?accountId=1&state=ok": "vpcs_accountId=1_state=ok.json",
+		"https://other.example.com/base/vpcs/":            "base_vpcs.json",
+		"https://prism.example.com/":                      "root.json",
+		"https://prism.example.com/../../etc/passwd?x=..": "etc_passwd_x=.json",
+	}
+
+	for rawURL, want := range tests {
+		got, err := fixtureName(rawURL)
+		if err != nil {
+			t.Errorf("fixtureName(%q): %v", rawURL, err)
+		} else if got != want {
+			t.Errorf("fixtureName(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+
+	if _, err := fixtureName("http://[::1"); err == nil {
+		t.Error("expected an error for an invalid URL")
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	server := newPrismTestServer(t)
+
+	recording := server.prism()
+	recording.RecordDir = dir
+
+	ctx := context.Background()
+	accounts, err := recording.getAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vpcs, err := recording.getVPCs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forAccount, err := recording.getVPCsForAccount(ctx, "222222222222")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"sources_accounts.json", "vpcs.json", "vpcs_accountId=222222222222.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected a recording: %v", err)
+		}
+	}
+
+	// Replaying doesn't touch the network, or care which Prism it's pointed
+	// at.
+	server.Close()
+	replaying := Prism{BaseURL: "http://prism.invalid", ReplayDir: dir}
+
+	replayedAccounts, err := replaying.getAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayedVPCs, err := replaying.getVPCs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayedForAccount, err := replaying.getVPCsForAccount(ctx, "222222222222")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(replayedAccounts, accounts) || !reflect.DeepEqual(replayedVPCs, vpcs) || !reflect.DeepEqual(replayedForAccount, forAccount) {
+		t.Errorf("replay differs from the recording")
+	}
+
+	_, err = replaying.getVPCsForAccount(ctx, "999")
+	if err == nil || !strings.Contains(err.Error(), "no recorded response") || !strings.Contains(err.Error(), "vpcs_accountId=999.json") {
+		t.Errorf("got %v, want an error naming the missing fixture", err)
+	}
+}
+
+func TestRecordReplayFlags(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	server := newPrismTestServer(t)
+
+	// Only stdout is compared, as the log lines on stderr are timestamped.
+	recorded, err := mainCommand("-prism-url", server.URL, "-all", "-format", "ndjson", "-record", dir).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	replayed, err := mainCommand("-prism-url", server.URL, "-all", "-format", "ndjson", "-replay", dir).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(replayed, recorded) {
+		t.Errorf("replayed output differs:\n%s\nrecorded:\n%s", replayed, recorded)
+	}
+
+	// The header says where the data really came from.
+	out, err := runMain(t, "-prism-url", server.URL, "-all", "-replay", dir)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, "// Replayed from: "+dir+"\n") || strings.Contains(out, "// Prism: ") {
+		t.Errorf("expected the replay directory in the header:\n%s", out)
+	}
+
+	out, err = runMain(t, "-record", dir, "-replay", dir)
+	if err == nil || !strings.Contains(out, "-record and -replay can't both be set") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
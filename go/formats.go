@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// The supported values for '-format'.
+var outputFormats = []string{"typescript", "cdk-attributes", "json", "ndjson", "markdown", "csv", "readme"}
+
+// File extensions used when writing each format to '-output-dir'.
+var formatExtensions = map[string]string{
+	"typescript":     "ts",
+	"cdk-attributes": "cdk.ts",
+	"json":           "json",
+	"ndjson":         "ndjson",
+	"markdown":       "md",
+	"csv":            "csv",
+	"readme":         "md",
+}
+
+// Formats which render all accounts as a single document. Only one of these
+// can be written to stdout at once, otherwise the output can't be parsed.
+var documentFormats = []string{"json", "ndjson", "markdown", "csv", "readme"}
+
+// Formats which render Typescript modules. Only one of these can be written to
+// stdout at once, otherwise the module's exports clash.
+var typescriptFormats = []string{"typescript", "cdk-attributes"}
+
+// parseFormats parses a comma-separated '-format' value, rejecting unknown
+// formats, duplicates and (when writing to stdout) combinations that would
+// produce unparseable output.
+func parseFormats(s string, toStdout bool) ([]string, error) {
+	formats := []string{}
+	documents := []string{}
+	modules := []string{}
+
+	for _, format := range strings.Split(s, ",") {
+		format = strings.TrimSpace(format)
+
+		if !slices.Contains(outputFormats, format) {
+			return nil, fmt.Errorf("invalid format %q; valid formats are: %s", format, strings.Join(outputFormats, ", "))
+		}
+
+		if slices.Contains(formats, format) {
+			return nil, fmt.Errorf("format %q given more than once", format)
+		}
+
+		// Otherwise the files would overwrite each other in -output-dir.
+		for _, other := range formats {
+			if formatExtensions[other] == formatExtensions[format] {
+				return nil, fmt.Errorf("formats %s and %s can't be used together, as both use the .%s extension", other, format, formatExtensions[format])
+			}
+		}
+
+		if slices.Contains(documentFormats, format) {
+			documents = append(documents, format)
+		}
+		if slices.Contains(typescriptFormats, format) {
+			modules = append(modules, format)
+		}
+
+		formats = append(formats, format)
+	}
+
+	for _, group := range [][]string{documents, modules} {
+		if toStdout && len(group) > 1 {
+			return nil, fmt.Errorf("formats %s can't all be written to stdout; use -output-dir", strings.Join(group, ", "))
+		}
+	}
+
+	return formats, nil
+}
+
+// RenderAll writes all accounts to w in the given format.
+func RenderAll(w io.Writer, format string, infos []AccountInfo, opts RenderOptions) error {
+	switch format {
+	case "json":
+		out, err := reportsAsJSON(infos, opts.PrettyJSON)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(out, '\n'))
+		return err
+	case "ndjson":
+		out, err := reportsAsNDJSON(infos)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case "markdown":
+		_, err := io.WriteString(w, reportsAsMarkdown(infos))
+		return err
+	case "csv":
+		return reportsAsCSV(w, infos)
+	case "readme":
+		for i, info := range infos {
+			if i > 0 {
+				_, err := io.WriteString(w, "\n")
+				if err != nil {
+					return err
+				}
+			}
+
+			err := info.renderReadme(w, opts)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "typescript", "cdk-attributes":
+		render := AccountInfo.Render
+		if format == "cdk-attributes" {
+			render = AccountInfo.renderCDKAttributes
+		}
+
+		for _, info := range infos {
+			if opts.Provenance != nil {
+				_, err := io.WriteString(w, opts.Provenance.comment(info))
+				if err != nil {
+					return err
+				}
+			}
+
+			err := render(info, w, opts)
+			if err != nil {
+				return err
+			}
+
+			_, err = io.WriteString(w, "\n")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// renderAccount renders a single account in the given format, as written to a
+// per-account file. This is the same as RenderAll except that JSON is written
+// as a single object rather than an array.
+func renderAccount(format string, info AccountInfo, opts RenderOptions) ([]byte, error) {
+	if format == "json" {
+		marshal := json.Marshal
+		if opts.PrettyJSON {
+			marshal = func(v any) ([]byte, error) {
+				return json.MarshalIndent(v, "", "  ")
+			}
+		}
+
+		out, err := marshal(info.asReport())
+		return append(out, '\n'), err
+	}
+
+	var buf bytes.Buffer
+	err := RenderAll(&buf, format, []AccountInfo{info}, opts)
+	return buf.Bytes(), err
+}
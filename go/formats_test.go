@@ -0,0 +1,718 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden with the current output")
+
+// assertGolden compares got with testdata/golden/<name>. After an intended
+// change to the output, regenerate the files with 'go test -update' and
+// review the diff.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	golden := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s (run with -update to accept it):\n%s", golden, got)
+	}
+}
+
+// goldenAccountInfo is a typical account: a default VPC alongside a
+// three-tier VPC with a subnet in each AZ.
+func goldenAccountInfo() AccountInfo {
+	subnets := []PrismSubnet{
+		testSubnet("subnet-pub-a", true, "eu-west-1a"),
+		testSubnet("subnet-pub-b", true, "eu-west-1b"),
+		testSubnet("subnet-pub-c", true, "eu-west-1c"),
+		testSubnet("subnet-priv-a", false, "eu-west-1a"),
+		testSubnet("subnet-priv-b", false, "eu-west-1b"),
+		testSubnet("subnet-priv-c", false, "eu-west-1c"),
+	}
+
+	info := AccountInfo{
+		AccountNumber: "123456789012",
+		AccountName:   "deploy-tools",
+		// As generate sets them when there is no config.
+		Stack:                  placeholder,
+		BucketForArtifact:      stringPtr(placeholder),
+		BucketForPrivateConfig: stringPtr(placeholder),
+		Logging:                Logging{StreamName: "TODO"},
+		VPCs: []PrismVPC{
+			{VPCID: "vpc-default", AccountID: "123456789012", IsDefault: true},
+			{VPCID: "vpc-main", AccountID: "123456789012", Subnets: subnets},
+		},
+	}
+
+	vpc, found, reason := findPrimaryVPC(info.VPCs, standardSubnetRange)
+	info.Selection = VPCSelection{VPC: vpc, Found: found, Reason: reason}
+
+	return info
+}
+
+func TestTypescriptTemplateGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		opts   RenderOptions
+	}{
+		{"typescript.ts", RenderOptions{}},
+		{"typescript-annotated.ts", RenderOptions{AnnotateSubnets: true}},
+		{"typescript-only-public.ts", RenderOptions{OnlyPublic: true}},
+		{"typescript-only-private.ts", RenderOptions{OnlyPrivate: true}},
+		{"typescript-const-prefix.ts", RenderOptions{ConstPrefix: "gen"}},
+		{"typescript-const-suffix.ts", RenderOptions{ConstSuffix: "Config"}},
+		{"typescript-const-prefix-suffix.ts", RenderOptions{ConstPrefix: "gen", ConstSuffix: "Config"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, []byte(goldenAccountInfo().asTypescriptTemplate(tt.opts)))
+		})
+	}
+}
+
+// Every Typescript golden, including the compact ones, should compile. The
+// default output once had an unclosed 'logging' block and no commas between
+// the subnet fields.
+func TestTypescriptGoldensCompile(t *testing.T) {
+	tsc, err := exec.LookPath("tsc")
+	if err != nil {
+		t.Skip("tsc is not installed")
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "typescript*.ts"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("got %v, %v; want the Typescript goldens", files, err)
+	}
+	for _, file := range files {
+		if out, err := compileTypescript(tsc, file); err != nil {
+			t.Errorf("%s failed to compile: %v\n%s", file, err, out)
+		}
+	}
+}
+
+// compactGoldens are the -compact golden files, with the account rendered
+// into each.
+func compactGoldens() map[string]AccountInfo {
+	configured := goldenAccountInfo()
+	configured.Stack = "deploy"
+	configured.BucketForArtifact = stringPtr("deploy-tools-dist")
+	configured.Logging.StreamName = "deploy-tools-logging"
+
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+	noVPC.Stack = placeholder
+	noVPC.BucketForArtifact = stringPtr(placeholder)
+	noVPC.BucketForPrivateConfig = stringPtr(placeholder)
+
+	return map[string]AccountInfo{
+		"typescript-compact.ts":            goldenAccountInfo(),
+		"typescript-compact-configured.ts": configured,
+		"typescript-compact-no-vpc.ts":     noVPC,
+	}
+}
+
+func TestCompactGolden(t *testing.T) {
+	for name, info := range compactGoldens() {
+		t.Run(name, func(t *testing.T) {
+			assertGolden(t, name, []byte(info.asTypescriptTemplate(RenderOptions{Compact: true})))
+		})
+	}
+}
+
+func TestTopologyWarningGolden(t *testing.T) {
+	info := goldenAccountInfo()
+	info.Selection.VPC = testVPC("vpc-two-az", 2, 2)
+	info.Selection.Warning = topologyWarning(info.Selection.VPC, standardSubnetRange)
+
+	assertGolden(t, "typescript-topology-warning.ts", []byte(info.asTypescriptTemplate(RenderOptions{})))
+	assertGolden(t, "typescript-compact-topology-warning.ts", []byte(info.asTypescriptTemplate(RenderOptions{Compact: true})))
+}
+
+// goldenThreeTierAccountInfo is goldenAccountInfo with a reserved subnet per
+// AZ as well.
+func goldenThreeTierAccountInfo() AccountInfo {
+	info := goldenAccountInfo()
+	for _, az := range []string{"a", "b", "c"} {
+		subnet := testSubnet("subnet-res-"+az, false, "eu-west-1"+az)
+		subnet.Tier = "reserved"
+		info.Selection.VPC.Subnets = append(info.Selection.VPC.Subnets, subnet)
+	}
+
+	return info
+}
+
+func TestReservedTierGolden(t *testing.T) {
+	info := goldenThreeTierAccountInfo()
+
+	tests := []struct {
+		golden string
+		opts   RenderOptions
+	}{
+		{"typescript-three-tier.ts", RenderOptions{}},
+		{"typescript-three-tier-compact.ts", RenderOptions{Compact: true}},
+		// Only one tier was asked for, so reserved subnets are left out.
+		{"typescript-three-tier-only-public.ts", RenderOptions{OnlyPublic: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, []byte(info.asTypescriptTemplate(tt.opts)))
+		})
+	}
+
+	report, err := json.MarshalIndent(info.asReport(), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "report-three-tier.json", report)
+
+	// Two-tier VPCs don't mention the reserved tier at all; see typescript.ts.
+	if two := goldenAccountInfo().asReport(); two.ReservedSubnets != nil {
+		t.Errorf("got reserved subnets %v for a two-tier VPC", two.ReservedSubnets)
+	}
+}
+
+func TestCDKAttributesGolden(t *testing.T) {
+	// Subnets are paired with AZs by position, so they're sorted by AZ
+	// whatever order Prism gave them in.
+	info := goldenAccountInfo()
+	subnets := info.Selection.VPC.Subnets
+	info.Selection.VPC.Subnets = []PrismSubnet{subnets[2], subnets[0], subnets[1], subnets[5], subnets[4], subnets[3]}
+
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+
+	for name, info := range map[string]AccountInfo{
+		"cdk-attributes.cdk.ts":        info,
+		"cdk-attributes-no-vpc.cdk.ts": noVPC,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := RenderAll(&buf, "cdk-attributes", []AccountInfo{info}, RenderOptions{SubnetOrder: "prism"}); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, name, buf.Bytes())
+		})
+	}
+}
+
+func TestCDKAttributesAvailabilityZones(t *testing.T) {
+	render := func(info AccountInfo) string {
+		var buf bytes.Buffer
+		if err := RenderAll(&buf, "cdk-attributes", []AccountInfo{info}, RenderOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	// Only the public and private subnets' AZs are listed, as they're the
+	// ones CDK pairs them with.
+	logged := captureLog(t)
+	unknown := goldenAccountInfo()
+	unknown.Selection.VPC.Subnets = append(append([]PrismSubnet{}, unknown.Selection.VPC.Subnets...), PrismSubnet{SubnetID: "subnet-unknown", AvailabilityZone: "eu-west-1d"})
+	if out := render(unknown); !strings.Contains(out, "availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],") {
+		t.Errorf("expected just the public and private subnets' AZs:\n%s", out)
+	}
+	if logged.Len() > 0 {
+		t.Errorf("unexpected warnings: %s", logged)
+	}
+
+	// If any are missing, the field is left out rather than listing only
+	// some of the AZs.
+	missing := goldenAccountInfo()
+	missing.Selection.VPC.Subnets = append([]PrismSubnet{}, missing.Selection.VPC.Subnets...)
+	missing.Selection.VPC.Subnets[0].AvailabilityZone = ""
+	assertGolden(t, "cdk-attributes-missing-azs.cdk.ts", []byte(render(missing)))
+	if want := "warning: deploy-tools: some subnets in vpc-main have no availability zone"; !strings.Contains(logged.String(), want) {
+		t.Errorf("got warnings %q, want %q", logged, want)
+	}
+}
+
+func TestAvailabilityZones(t *testing.T) {
+	subnets := []PrismSubnet{
+		testSubnet("a", true, "eu-west-1b"),
+		testSubnet("b", false, "eu-west-1a"),
+		testSubnet("c", true, "eu-west-1b"),
+		testSubnet("d", true, ""),
+	}
+
+	if got := availabilityZones(subnets); !slices.Equal(got, []string{"eu-west-1a", "eu-west-1b"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := availabilityZones(nil); len(got) != 0 {
+		t.Errorf("got %v for no subnets", got)
+	}
+}
+
+func TestKnownAvailabilityZones(t *testing.T) {
+	reserved := testSubnet("r", false, "eu-west-1c")
+	reserved.Tier = "reserved"
+
+	tests := []struct {
+		name    string
+		subnets []PrismSubnet
+		want    []string
+		ok      bool
+	}{
+		{"sorted and distinct", []PrismSubnet{testSubnet("a", true, "eu-west-1b"), testSubnet("b", false, "eu-west-1a"), testSubnet("c", false, "eu-west-1b")}, []string{"eu-west-1a", "eu-west-1b"}, true},
+		{"includes reserved", []PrismSubnet{testSubnet("a", true, "eu-west-1a"), reserved}, []string{"eu-west-1a", "eu-west-1c"}, true},
+		{"one missing", []PrismSubnet{testSubnet("a", true, "eu-west-1a"), testSubnet("b", false, "")}, nil, false},
+		{"no subnets", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		azs, ok := knownAvailabilityZones(PrismVPC{Subnets: tt.subnets})
+		if !slices.Equal(azs, tt.want) || ok != tt.ok {
+			t.Errorf("%s: got %v, %t; want %v, %t", tt.name, azs, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAvailabilityZonesGolden(t *testing.T) {
+	// Prism sometimes has no AZ for a subnet, in which case the field is
+	// left out rather than listing only some of the AZs.
+	missing := goldenAccountInfo()
+	missing.Selection.VPC.Subnets = append([]PrismSubnet{}, missing.Selection.VPC.Subnets...)
+	missing.Selection.VPC.Subnets[0].AvailabilityZone = ""
+
+	tmpl, err := loadTemplateFile(writeTemplate(t, "export const {{.ConstName}}AZs = {{tsStrings .AvailabilityZones}};\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		golden string
+		info   AccountInfo
+		opts   RenderOptions
+	}{
+		{"typescript-missing-azs.ts", missing, RenderOptions{SubnetOrder: "id"}},
+		{"typescript-compact-missing-azs.ts", missing, RenderOptions{SubnetOrder: "id", Compact: true}},
+		{"custom-template-azs.ts", goldenAccountInfo(), RenderOptions{Template: tmpl}},
+		{"custom-template-missing-azs.ts", missing, RenderOptions{Template: tmpl}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.info.Render(&buf, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.golden, buf.Bytes())
+		})
+	}
+}
+
+func TestMissingAvailabilityZonesWarning(t *testing.T) {
+	vpc := testVPC("vpc-a", 3, 3)
+	vpc.Subnets[0].AvailabilityZone = ""
+	vpcs, err := json.Marshal([]PrismVPC{vpc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	out, err := runMain(t, "-prism-url", server.URL)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, "warning: deploy-tools: prism has no availability zone for some subnets in vpc-a") || strings.Contains(out, "availabilityZones: ") {
+		t.Errorf("expected a warning and no availabilityZones:\n%s", out)
+	}
+}
+
+func TestProvenanceGolden(t *testing.T) {
+	provenance := &Provenance{Version: "v1.2.3", Source: "Prism: https://prism.gutools.co.uk"}
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+
+	tests := []struct {
+		golden    string
+		format    string
+		generated time.Time
+	}{
+		{"typescript-header.ts", "typescript", time.Time{}},
+		{"typescript-header-timestamp.ts", "typescript", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{"cdk-attributes-header.cdk.ts", "cdk-attributes", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			p := *provenance
+			p.Generated = tt.generated
+
+			var buf bytes.Buffer
+			if err := RenderAll(&buf, tt.format, []AccountInfo{goldenAccountInfo(), noVPC}, RenderOptions{Provenance: &p}); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.golden, buf.Bytes())
+		})
+	}
+
+	// Report formats are data, so have no header.
+	var buf bytes.Buffer
+	if err := RenderAll(&buf, "ndjson", []AccountInfo{goldenAccountInfo()}, RenderOptions{Provenance: provenance}); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Generated by")) {
+		t.Errorf("unexpected header in ndjson:\n%s", buf.String())
+	}
+}
+
+func TestDescribeSource(t *testing.T) {
+	accounts := []PrismAccount{{AccountNumber: "111", AccountName: "deploy-tools"}}
+
+	tests := []struct {
+		source PrismLike
+		want   string
+	}{
+		{Prism{BaseURL: "https://prism.gutools.co.uk"}, "Prism: https://prism.gutools.co.uk"},
+		{Prism{BaseURL: "https://prism.gutools.co.uk", ReplayDir: "testdata/fixtures"}, "Replayed from: testdata/fixtures"},
+		{AWSPrism{Region: "eu-west-1"}, "AWS: account 111 in eu-west-1"},
+	}
+
+	for _, tt := range tests {
+		if got := describeSource(tt.source, accounts); got != tt.want {
+			t.Errorf("%T: got %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestToolVersion(t *testing.T) {
+	if got := toolVersion(); got == "" {
+		t.Error("got an empty version")
+	}
+
+	defer func(v string) { version = v }(version)
+	version = "v9.9.9"
+	if got := toolVersion(); got != "v9.9.9" {
+		t.Errorf("got %q, want the -ldflags version", got)
+	}
+}
+
+// goldenMultiRegionAccountInfo is goldenAccountInfo with a second, two-AZ
+// primary VPC in us-east-1.
+func goldenMultiRegionAccountInfo() AccountInfo {
+	info := goldenAccountInfo()
+
+	us := PrismVPC{VPCID: "vpc-us", AccountID: "123456789012", Region: "us-east-1"}
+	for _, az := range []string{"a", "b"} {
+		us.Subnets = append(us.Subnets,
+			testSubnet("subnet-us-pub-"+az, true, "us-east-1"+az),
+			testSubnet("subnet-us-priv-"+az, false, "us-east-1"+az),
+		)
+	}
+
+	info.Regions = []RegionSelection{
+		{Region: "eu-west-1", Selection: info.Selection},
+		{Region: "us-east-1", Selection: VPCSelection{VPC: us, Found: true, Warning: topologyWarning(us, standardSubnetRange)}},
+	}
+
+	return info
+}
+
+func TestMultiRegionGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		opts   RenderOptions
+	}{
+		{"typescript-multi-region.ts", RenderOptions{SubnetOrder: "id"}},
+		{"typescript-multi-region-annotated.ts", RenderOptions{SubnetOrder: "id", AnnotateSubnets: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, []byte(goldenMultiRegionAccountInfo().asTypescriptTemplate(tt.opts)))
+		})
+	}
+}
+
+func TestSubnetConstsGolden(t *testing.T) {
+	tests := []struct {
+		golden string
+		info   AccountInfo
+		opts   RenderOptions
+	}{
+		{"typescript-subnet-consts.ts", goldenAccountInfo(), RenderOptions{SubnetOrder: "id", SubnetConsts: true}},
+		{"typescript-subnet-consts-annotated.ts", goldenAccountInfo(), RenderOptions{SubnetOrder: "id", SubnetConsts: true, AnnotateSubnets: true}},
+		{"typescript-subnet-consts-three-tier.ts", goldenThreeTierAccountInfo(), RenderOptions{SubnetOrder: "id", SubnetConsts: true, ConstPrefix: "gen"}},
+		{"typescript-subnet-consts-multi-region.ts", goldenMultiRegionAccountInfo(), RenderOptions{SubnetOrder: "id", SubnetConsts: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, []byte(tt.info.asTypescriptTemplate(tt.opts)))
+		})
+	}
+}
+
+func TestSubnetConstPrefix(t *testing.T) {
+	info := goldenAccountInfo()
+
+	tests := []struct {
+		opts   RenderOptions
+		region string
+		want   string
+	}{
+		{RenderOptions{}, "", ""},
+		{RenderOptions{SubnetConsts: true}, "", "deployToolsAccount"},
+		{RenderOptions{SubnetConsts: true, ConstPrefix: "gen"}, "", "genDeployToolsAccount"},
+		{RenderOptions{SubnetConsts: true, ConstSuffix: "Config"}, "", "deployToolsAccountConfig"},
+		{RenderOptions{SubnetConsts: true}, "us-east-1", "deployToolsAccountUsEast1"},
+	}
+
+	for _, tt := range tests {
+		if got := info.subnetConstPrefix(tt.opts, tt.region); got != tt.want {
+			t.Errorf("subnetConstPrefix(%+v, %q) = %q, want %q", tt.opts, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"deployToolsAccount", true},
+		{"genDeployToolsAccountConfig", true},
+		{"_private$Account", true},
+		{"Account2", true},
+		{"2Account", false},
+		{"gen-Account", false},
+		{"legacy|toolsAccount", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIdentifier(tt.name); got != tt.want {
+			t.Errorf("isIdentifier(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// goldenNoVPCAccountInfo is an account where no suitable VPC is found.
+func goldenNoVPCAccountInfo() AccountInfo {
+	info := AccountInfo{
+		AccountNumber: "210987654321",
+		AccountName:   "legacy|tools",
+		Logging:       Logging{StreamName: "TODO"},
+		VPCs:          []PrismVPC{{VPCID: "vpc-small", AccountID: "210987654321"}},
+	}
+
+	vpc, found, reason := findPrimaryVPC(info.VPCs, standardSubnetRange)
+	info.Selection = VPCSelection{VPC: vpc, Found: found, Reason: reason}
+
+	return info
+}
+
+func TestNoVPCCommentGolden(t *testing.T) {
+	// As generate sets them when there is no config.
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+	noVPC.Stack = placeholder
+	noVPC.BucketForArtifact = stringPtr(placeholder)
+	noVPC.BucketForPrivateConfig = stringPtr(placeholder)
+
+	// A different reason: the account has no VPCs at all.
+	empty := noVPC
+	empty.VPCs = nil
+	_, _, empty.Selection.Reason = findPrimaryVPC(empty.VPCs, standardSubnetRange)
+
+	runbook := template.Must(template.New("no-vpc-comment").Parse(
+		"// No suitable VPC for {{.AccountName}} ({{.AccountNumber}}): {{.Reason}}.\n// See {{.Runbook}}"))
+	opts := RenderOptions{NoVPCComment: runbook, Runbook: "https://example.com/runbooks/vpc"}
+	compactOpts := opts
+	compactOpts.Compact = true
+
+	tests := []struct {
+		golden string
+		info   AccountInfo
+		opts   RenderOptions
+	}{
+		{"typescript-no-vpc.ts", noVPC, RenderOptions{}},
+		{"typescript-no-vpcs.ts", empty, RenderOptions{}},
+		{"typescript-no-vpc-runbook.ts", noVPC, opts},
+		{"typescript-compact-no-vpc-runbook.ts", empty, compactOpts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			assertGolden(t, tt.golden, []byte(tt.info.asTypescriptTemplate(tt.opts)))
+		})
+	}
+
+	broken := template.Must(template.New("no-vpc-comment").Option("missingkey=error").Parse("// {{.Missing}}"))
+	if err := noVPC.Render(io.Discard, RenderOptions{NoVPCComment: broken}); err == nil || !strings.Contains(err.Error(), "unable to render no-VPC comment for legacy-tools") {
+		t.Errorf("got %v", err)
+	}
+
+	out, err := runMain(t, "-no-vpc-comment-template", "{{.Reason")
+	if err == nil || !strings.Contains(out, "invalid -no-vpc-comment-template") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestReadmeGolden(t *testing.T) {
+	warned := goldenAccountInfo()
+	warned.Selection.VPC.Region = "eu-west-1"
+	warned.Selection.Warning = "only 2 AZs"
+	warned.Stack = "Tools"
+
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+	noVPC.Stack = placeholder
+
+	tests := []struct {
+		golden string
+		infos  []AccountInfo
+	}{
+		{"readme.md", []AccountInfo{goldenAccountInfo()}},
+		{"readme-three-tier.md", []AccountInfo{goldenThreeTierAccountInfo()}},
+		{"readme-warning.md", []AccountInfo{warned}},
+		{"readme-no-vpc.md", []AccountInfo{noVPC}},
+		{"readme-multiple.md", []AccountInfo{goldenAccountInfo(), noVPC}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := RenderAll(&buf, "readme", tt.infos, RenderOptions{SubnetOrder: "id"}); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, tt.golden, buf.Bytes())
+		})
+	}
+}
+
+func TestRenderWritesToWriter(t *testing.T) {
+	info := goldenAccountInfo()
+
+	var buf bytes.Buffer
+	if err := info.Render(&buf, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != info.asTypescriptTemplate(RenderOptions{}) {
+		t.Error("Render and asTypescriptTemplate differ")
+	}
+	assertGolden(t, "typescript.ts", buf.Bytes())
+
+	// Write errors are returned rather than ignored.
+	for _, format := range outputFormats {
+		if err := RenderAll(failingWriter{}, format, []AccountInfo{info}, RenderOptions{}); err == nil {
+			t.Errorf("%s: expected the write error", format)
+		}
+	}
+}
+
+// failingWriter is an io.Writer whose writes always fail.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestMarkdownGolden(t *testing.T) {
+	out := reportsAsMarkdown([]AccountInfo{goldenAccountInfo(), goldenNoVPCAccountInfo()})
+	assertGolden(t, "markdown.md", []byte(out))
+}
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		value    string
+		toStdout bool
+		want     []string
+		err      string
+	}{
+		{"typescript", true, []string{"typescript"}, ""},
+		{"typescript, json", true, []string{"typescript", "json"}, ""},
+		{"json,csv", false, []string{"json", "csv"}, ""},
+		{"json,csv", true, nil, "formats json, csv can't all be written to stdout; use -output-dir"},
+		{"json,json", false, nil, `format "json" given more than once`},
+		{"typescript,readme", false, []string{"typescript", "readme"}, ""},
+		{"typescript,readme", true, []string{"typescript", "readme"}, ""},
+		{"csv,readme", true, nil, "formats csv, readme can't all be written to stdout; use -output-dir"},
+		{"csv,readme", false, []string{"csv", "readme"}, ""},
+		{"typescript,cdk-attributes", true, nil, "formats typescript, cdk-attributes can't all be written to stdout; use -output-dir"},
+		{"cdk-attributes,typescript", false, []string{"cdk-attributes", "typescript"}, ""},
+		{"cdk-attributes,json", true, []string{"cdk-attributes", "json"}, ""},
+		{"markdown,readme", false, nil, "formats markdown and readme can't be used together, as both use the .md extension"},
+		{"typescript,yaml", true, nil, `invalid format "yaml"; valid formats are: typescript, cdk-attributes, json, ndjson, markdown, csv, readme`},
+		{"", true, nil, `invalid format ""; valid formats are: typescript, cdk-attributes, json, ndjson, markdown, csv, readme`},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFormats(tt.value, tt.toStdout)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("parseFormats(%q, %v) error = %v, want %q", tt.value, tt.toStdout, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("parseFormats(%q, %v) = %v, %v; want %v", tt.value, tt.toStdout, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenderMultipleFormats(t *testing.T) {
+	infos := []AccountInfo{goldenAccountInfo()}
+
+	// To stdout, the formats follow each other.
+	var buf bytes.Buffer
+	for _, format := range []string{"typescript", "json"} {
+		if err := RenderAll(&buf, format, infos, RenderOptions{PrettyJSON: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stdout := buf.Bytes()
+	ts, err := os.ReadFile(filepath.Join("testdata", "golden", "typescript.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(stdout, append(ts, '\n')) || !bytes.HasSuffix(stdout, []byte("]\n")) {
+		t.Errorf("expected the typescript then the JSON, got:\n%s", stdout)
+	}
+
+	// In -output-dir, each account gets a file per format.
+	dir := t.TempDir()
+	if err := writeAccountFiles(testOutputOptions(t, dir, defaultFilenameTemplate), []string{"typescript", "json"}, infos, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"DeployTools.ts", "DeployTools.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Per-account JSON is a single object rather than an array.
+	out, err := os.ReadFile(filepath.Join(dir, "DeployTools.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report AccountReport
+	if err := json.Unmarshal(out, &report); err != nil || report.VPCID != "vpc-main" {
+		t.Errorf("got %+v, %v from:\n%s", report, err, out)
+	}
+}
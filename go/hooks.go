@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// PostHook is a command run on each generated file, e.g. 'prettier --write
+// {{.File}}'. Each word of the command is a template, rendered with the file's
+// path as '.File'. The command is run directly rather than via a shell, so
+// unusual filenames can't be misinterpreted.
+type PostHook struct {
+	args []*template.Template
+}
+
+func parsePostHook(s string) (*PostHook, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("post hook is empty")
+	}
+
+	hook := &PostHook{}
+	for i, word := range words {
+		tmpl, err := template.New(fmt.Sprintf("post-hook-%d", i)).Option("missingkey=error").Parse(word)
+		if err != nil {
+			return nil, err
+		}
+		hook.args = append(hook.args, tmpl)
+	}
+
+	return hook, nil
+}
+
+// run runs the hook on 'file', returning its combined output and an error if
+// it couldn't be started or exited non-zero.
+func (h *PostHook) run(file string) (string, error) {
+	args := []string{}
+	for _, tmpl := range h.args {
+		var buf strings.Builder
+		err := tmpl.Execute(&buf, struct{ File string }{File: file})
+		if err != nil {
+			return "", err
+		}
+		args = append(args, buf.String())
+	}
+
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	return string(out), err
+}
+
+// recordingSink remembers the names of the files written to it, so that post
+// hooks can be run on them. Files the underlying sink skipped aren't
+// recorded, and the skip isn't passed on as an error.
+type recordingSink struct {
+	FileSink
+	names []string
+}
+
+func (s *recordingSink) WriteFile(name string, content []byte) error {
+	err := s.FileSink.WriteFile(name, content)
+	if errors.Is(err, errSkipped) {
+		return nil
+	}
+	if err == nil {
+		s.names = append(s.names, name)
+	}
+
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// stubCommand writes a shell script that appends its argument to a log file
+// and exits with 'status', returning the script and log paths.
+func stubCommand(t *testing.T, status string) (string, string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "stub.sh")
+	logPath := filepath.Join(dir, "stub.log")
+
+	content := "#!/bin/sh\necho \"$1\" >> '" + logPath + "'\necho \"stub output for $1\"\nexit " + status + "\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	return script, logPath
+}
+
+func TestParsePostHook(t *testing.T) {
+	for _, s := range []string{"", "   ", "prettier {{.File"} {
+		if _, err := parsePostHook(s); err == nil {
+			t.Errorf("parsePostHook(%q): expected an error", s)
+		}
+	}
+
+	hook, err := parsePostHook("prettier --write {{.File}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.args) != 3 {
+		t.Errorf("got %d args, want 3", len(hook.args))
+	}
+}
+
+func TestPostHookRun(t *testing.T) {
+	script, logPath := stubCommand(t, "0")
+
+	// A filename with a space stays one argument, as there's no shell.
+	hook, err := parsePostHook(script + " {{.File}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := hook.run("out/Deploy Tools.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "stub output for out/Deploy Tools.ts\n" {
+		t.Errorf("got output %q", out)
+	}
+	if logged, _ := os.ReadFile(logPath); string(logged) != "out/Deploy Tools.ts\n" {
+		t.Errorf("stub got %q", logged)
+	}
+
+	failing, _ := stubCommand(t, "3")
+	hook, err = parsePostHook(failing + " {{.File}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exitErr *exec.ExitError
+	if _, err := hook.run("a.ts"); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("got %v, want exit status 3", err)
+	}
+
+	// Unknown fields are an error, rather than an empty argument.
+	hook, err = parsePostHook(script + " {{.Missing}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hook.run("a.ts"); err == nil {
+		t.Error("expected an error for an unknown template field")
+	}
+}
+
+func TestPostHookFlag(t *testing.T) {
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "frontend"}
+	]`, "[]")
+
+	t.Run("success", func(t *testing.T) {
+		script, logPath := stubCommand(t, "0")
+		dir := t.TempDir()
+
+		out, err := runMain(t, "-prism-url", server.URL, "-all", "-output-dir", dir, "-post-hook", script+" {{.File}}")
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+
+		logged, _ := os.ReadFile(logPath)
+		want := filepath.Join(dir, "DeployTools.ts") + "\n" + filepath.Join(dir, "Frontend.ts") + "\n"
+		if string(logged) != want {
+			t.Errorf("hook ran on:\n%s\nwant:\n%s", logged, want)
+		}
+	})
+
+	t.Run("failure is a warning", func(t *testing.T) {
+		script, _ := stubCommand(t, "1")
+
+		out, err := runMain(t, "-prism-url", server.URL, "-all", "-output-dir", t.TempDir(), "-post-hook", script+" {{.File}}")
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if strings.Count(out, ": post hook failed on ") != 2 || !strings.Contains(out, "stub output for ") {
+			t.Errorf("expected a warning with the hook's output for each file:\n%s", out)
+		}
+	})
+
+	t.Run("failure is fatal", func(t *testing.T) {
+		script, _ := stubCommand(t, "1")
+
+		out, err := runMain(t, "-prism-url", server.URL, "-all", "-output-dir", t.TempDir(), "-post-hook", script+" {{.File}}", "-post-hook-fatal")
+		if err == nil || !strings.Contains(out, "2 failed") {
+			t.Errorf("got %v: %s", err, out)
+		}
+	})
+
+	out, err := runMain(t, "-post-hook", "true")
+	if err == nil || !strings.Contains(out, "-post-hook requires -output-dir") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestRecordingSinkSkipsDeclinedFiles(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "Existing.ts")
+	if err := os.WriteFile(existing, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	captureLog(t)
+
+	// Answer 'N' to every prompt.
+	var asked []string
+	sink := &recordingSink{FileSink: dirSink{dir: dir, confirm: func(path string) bool {
+		asked = append(asked, path)
+		return false
+	}}}
+
+	for _, name := range []string{"Existing.ts", "New.ts"} {
+		if err := sink.WriteFile(name, []byte("generated")); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	if !slices.Equal(asked, []string{existing}) {
+		t.Errorf("asked about %v, want just the existing file", asked)
+	}
+
+	// The post hook should only run on the file that was actually written.
+	if !slices.Equal(sink.names, []string{"New.ts"}) {
+		t.Errorf("recorded %v, want just New.ts", sink.names)
+	}
+
+	if content, _ := os.ReadFile(existing); string(content) != "keep me" {
+		t.Errorf("declined file was overwritten with %q", content)
+	}
+}
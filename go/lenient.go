@@ -0,0 +1,51 @@
+package main
+
+// stripTrailingCommas removes commas that directly precede a closing '}' or
+// ']' (ignoring whitespace), which 'encoding/json' otherwise rejects. Commas
+// inside strings are left alone. The bool return value reports whether
+// anything was removed.
+func stripTrailingCommas(data []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	inString, escaped, fixed := false, false, false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		if inString {
+			out = append(out, c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		if c == '"' {
+			inString = true
+		}
+
+		if c == ',' {
+			j := i + 1
+			for j < len(data) && isJSONSpace(data[j]) {
+				j++
+			}
+
+			if j < len(data) && (data[j] == '}' || data[j] == ']') {
+				fixed = true
+				continue
+			}
+		}
+
+		out = append(out, c)
+	}
+
+	return out, fixed
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
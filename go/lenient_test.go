@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStripTrailingCommas(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		fixed bool
+	}{
+		{"object", `{"a": 1,}`, `{"a": 1}`, true},
+		{"array", `[1, 2, ]`, `[1, 2 ]`, true},
+		{"nested with newlines", "{\"a\": [1,\n],\n}", "{\"a\": [1\n]\n}", true},
+		{"commas in strings", `{"a": "x,}", "b": "y,]"}`, `{"a": "x,}", "b": "y,]"}`, false},
+		{"escaped quotes", `{"a": "\",}",}`, `{"a": "\",}"}`, true},
+		{"valid JSON", `{"a": [1, 2], "b": {}}`, `{"a": [1, 2], "b": {}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fixed := stripTrailingCommas([]byte(tt.input))
+			if string(got) != tt.want || fixed != tt.fixed {
+				t.Errorf("got %s, %v; want %s, %v", got, fixed, tt.want, tt.fixed)
+			}
+		})
+	}
+}
+
+func TestLenientJSON(t *testing.T) {
+	logged := captureLog(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools",},],}`)
+	}))
+	defer server.Close()
+
+	// Off by default, so the response is rejected.
+	strict := Prism{BaseURL: server.URL, Client: http.DefaultClient}
+	var parseErr *ParseError
+	if _, err := strict.getAccounts(context.Background()); !errors.As(err, &parseErr) {
+		t.Errorf("got %v, want a *ParseError", err)
+	}
+
+	lenient := Prism{BaseURL: server.URL, Client: http.DefaultClient, LenientJSON: true}
+	accounts, err := lenient.getAccounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].AccountName != "deploy-tools" {
+		t.Errorf("got %+v", accounts)
+	}
+	if !strings.Contains(logged.String(), "removed trailing commas") {
+		t.Errorf("expected a warning, got %q", logged)
+	}
+}
@@ -1,36 +1,41 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
 
-	"golang.org/x/exp/slices"
+	"github.com/nicl/scala-school-example/prism"
+	"golang.org/x/sync/errgroup"
 )
 
-// Structs are the basic data type in Go - a bit like 'case classes' but also
-// quite different! The `json:..` annotations indicate the field to use when
-// (de)serialising to JSON. Note, in Go, 'marshal' and 'unmarshal' are used
-// instead of 'serialise' and 'deserialise' (aka 'write' and 'read').
-type PrismVPC struct {
-	VPCID     string        `json:"vpcId"`
-	AccountID string        `json:"accountId"`
-	IsDefault bool          `json:"default"`
-	Subnets   []PrismSubnet `json:"subnets"`
-}
-
-type PrismSubnet struct {
-	IsPublic bool   `json:"isPublic"`
-	SubnetID string `json:"subnetId"`
-}
-
-type PrismAccount struct {
-	AccountNumber string `json:"accountNumber"`
-	AccountName   string `json:"accountName"`
-}
+// The Prism data model is in the prism package, so that other tools can use
+// it. The aliases keep the names used everywhere here.
+type PrismVPC = prism.VPC
+type PrismSubnet = prism.Subnet
+type PrismAccount = prism.Account
 
 type PrismResponseAccountsWrapper struct {
 	Data []PrismAccount `json:"data"`
@@ -46,6 +51,12 @@ type PrismResponseVPCsWrapper struct {
 	} `json:"data"`
 }
 
+// Version 2 of the Prism API (see '-prism-api-version') returns the VPCs
+// directly under 'data'.
+type PrismResponseVPCsWrapperV2 struct {
+	Data []PrismVPC `json:"data"`
+}
+
 // Internal models
 
 type Logging struct {
@@ -60,45 +71,168 @@ type AccountInfo struct {
 	BucketForPrivateConfig *string
 	Logging                Logging
 	VPCs                   []PrismVPC
+	Selection              VPCSelection
+	// With '-multi-region', the primary VPC in each region that has one,
+	// sorted by region. Selection is then the first of these.
+	Regions []RegionSelection
+}
+
+type RegionSelection struct {
+	Region    string
+	Selection VPCSelection
+}
+
+// The outcome of choosing a primary VPC from an account's VPCs. If Found is
+// false, Reason explains why nothing was chosen.
+type VPCSelection struct {
+	VPC    PrismVPC
+	Found  bool
+	Reason string
+	// Set if the VPC was accepted despite a sub-standard topology, e.g. with
+	// '-lenient-topology'.
+	Warning string
+}
+
+// SubnetRange is the acceptable number of public and private subnets for a
+// primary VPC. A maximum of -1 means there is no upper limit.
+type SubnetRange struct {
+	MinPublic  int
+	MaxPublic  int
+	MinPrivate int
+	MaxPrivate int
+}
+
+// Our standard VPC topology has a public and a private subnet in each of three
+// AZs.
+const idealSubnetCount = prism.StandardSubnetCount
+
+var standardSubnetRange = SubnetRange{
+	MinPublic:  idealSubnetCount,
+	MaxPublic:  idealSubnetCount,
+	MinPrivate: idealSubnetCount,
+	MaxPrivate: idealSubnetCount,
+}
+
+func withinRange(n int, min int, max int) bool {
+	return n >= min && (max == -1 || n <= max)
+}
+
+func (r SubnetRange) contains(public int, private int) bool {
+	return withinRange(public, r.MinPublic, r.MaxPublic) && withinRange(private, r.MinPrivate, r.MaxPrivate)
+}
+
+func describeRange(min int, max int) string {
+	switch {
+	case max == -1:
+		return fmt.Sprintf("at least %d", min)
+	case min == max:
+		return fmt.Sprint(min)
+	default:
+		return fmt.Sprintf("%d-%d", min, max)
+	}
+}
+
+func (r SubnetRange) String() string {
+	return fmt.Sprintf("%s public and %s private subnets", describeRange(r.MinPublic, r.MaxPublic), describeRange(r.MinPrivate, r.MaxPrivate))
+}
+
+// How far a VPC's subnet counts are from the ideal topology; lower is better.
+func distanceFromIdeal(public int, private int) int {
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+
+	return abs(public-idealSubnetCount) + abs(private-idealSubnetCount)
 }
 
 // Go doesn't have Options, so often used a second bool ('ok') return value to
-// indicate if found or not.
-func findPrimaryVPC(VPCs []PrismVPC) (PrismVPC, bool) {
-	i := slices.IndexFunc(VPCs, func(vpc PrismVPC) bool {
-		var publicSubnets, privateSubnets []PrismSubnet
+// indicate if found or not. Here we also return a reason when nothing is found
+// to help the operator understand what was wrong.
+//
+// A VPC is suitable if it isn't the default VPC and its subnet counts are
+// within 'r'. If several are suitable, the one closest to the ideal of 3 public
+// and 3 private subnets wins, with ties going to the first.
+//
+// Selectors call this several times per account (e.g. for fallbacks), so it
+// doesn't log anything itself; see unknownSubnets.
+func findPrimaryVPC(VPCs []PrismVPC, r SubnetRange) (PrismVPC, bool, string) {
+	best, bestDistance := -1, 0
+
+	for i, vpc := range VPCs {
+		public, private := prism.CountPublic(vpc.Subnets), prism.CountPrivate(vpc.Subnets)
+		if vpc.IsDefault || !r.contains(public, private) {
+			continue
+		}
+
+		distance := distanceFromIdeal(public, private)
+		if best == -1 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+
+	if best == -1 {
+		return PrismVPC{}, false, noPrimaryVPCReason(VPCs, r)
+	}
+
+	return VPCs[best], true, ""
+}
+
+// unknownSubnets describes the subnets that are neither public nor private
+// (see prism.ClassifySubnet), and so are left out of the subnet counts, e.g.
+// 'subnet-abc (vpc-123)'.
+func unknownSubnets(VPCs []PrismVPC) []string {
+	out := []string{}
+	for _, vpc := range VPCs {
 		for _, subnet := range vpc.Subnets {
-			if subnet.IsPublic {
-				publicSubnets = append(publicSubnets, subnet)
-			} else {
-				privateSubnets = append(privateSubnets, subnet)
+			if prism.ClassifySubnet(subnet) == prism.SubnetUnknown {
+				out = append(out, fmt.Sprintf("%s (%s)", subnet.SubnetID, vpc.VPCID))
 			}
 		}
+	}
 
-		return !vpc.IsDefault && len(publicSubnets) == 3 && len(privateSubnets) == 3
-	})
+	return out
+}
 
-	if i == -1 {
-		return PrismVPC{}, false
+// noPrimaryVPCReason describes why none of the VPCs were suitable. A VPC with
+// more subnets than expected is reported separately as it likely just needs a
+// wider range (or a closer look) rather than being unsuitable.
+func noPrimaryVPCReason(VPCs []PrismVPC, r SubnetRange) string {
+	if len(VPCs) == 0 {
+		return "no VPCs found"
 	}
 
-	return VPCs[i], true
-}
+	for _, vpc := range VPCs {
+		if vpc.IsDefault {
+			continue
+		}
 
-func subnetsAsTypescriptArray(subnets []PrismSubnet) string {
-	ids := []string{}
-	for _, s := range subnets {
-		ids = append(ids, fmt.Sprintf("'%s'", s.SubnetID))
+		public, private := prism.CountPublic(vpc.Subnets), prism.CountPrivate(vpc.Subnets)
+		if public >= r.MinPublic && private >= r.MinPrivate {
+			return fmt.Sprintf("VPC %s has more subnets than expected (%d public, %d private)", vpc.VPCID, public, private)
+		}
 	}
 
-	return "[" + strings.Join(ids, ", ") + "]"
+	// An isolated, private-only VPC is a valid design, so worth calling out
+	// (see '-allow-private-only').
+	for _, vpc := range VPCs {
+		if !vpc.IsDefault && prism.CountPublic(vpc.Subnets) == 0 && prism.CountPrivate(vpc.Subnets) > 0 {
+			return fmt.Sprintf("no public subnets found in VPC %s (private subnets: %d)", vpc.VPCID, prism.CountPrivate(vpc.Subnets))
+		}
+	}
+
+	return "no non-default VPC with " + r.String()
 }
 
-func publicSubnets(subnets []PrismSubnet) []PrismSubnet {
+// unroutedPublicSubnets returns the subnets that are flagged as public but which
+// Prism reports as having no internet gateway route - a misconfiguration that
+// shouldn't be migrated as-is. Subnets without routing data are not included.
+func unroutedPublicSubnets(subnets []PrismSubnet) []PrismSubnet {
 	out := []PrismSubnet{}
-
-	for _, subnet := range subnets {
-		if subnet.IsPublic {
+	for _, subnet := range prism.PublicSubnets(subnets) {
+		if subnet.HasInternetGatewayRoute != nil && !*subnet.HasInternetGatewayRoute {
 			out = append(out, subnet)
 		}
 	}
@@ -106,174 +240,1837 @@ func publicSubnets(subnets []PrismSubnet) []PrismSubnet {
 	return out
 }
 
-func privateSubnets(subnets []PrismSubnet) []PrismSubnet {
-	out := []PrismSubnet{}
+// excludeVPCs drops any VPCs whose ID is in 'ids'.
+func excludeVPCs(VPCs []PrismVPC, ids []string) []PrismVPC {
+	out := []PrismVPC{}
+	for _, vpc := range VPCs {
+		if !slices.Contains(ids, vpc.VPCID) {
+			out = append(out, vpc)
+		}
+	}
 
-	for _, subnet := range subnets {
-		if !subnet.IsPublic {
-			out = append(out, subnet)
+	return out
+}
+
+// excludeSharedVPCs drops shared VPCs.
+func excludeSharedVPCs(VPCs []PrismVPC) []PrismVPC {
+	out := []PrismVPC{}
+	for _, vpc := range VPCs {
+		if !vpc.IsShared {
+			out = append(out, vpc)
 		}
 	}
 
 	return out
 }
 
-// Go does not have string interpolation sadly so this is more painful and
-// harder to read than the Scala equivalent.
-func (info AccountInfo) asTypescriptTemplate() string {
-	primaryVPC, ok := findPrimaryVPC(info.VPCs)
+// filterSubnetsByTag returns copies of the VPCs keeping only the subnets with
+// the given tag value, e.g. to ignore service-specific subnets when counting.
+func filterSubnetsByTag(VPCs []PrismVPC, key string, value string) []PrismVPC {
+	out := []PrismVPC{}
+	for _, vpc := range VPCs {
+		subnets := []PrismSubnet{}
+		for _, subnet := range vpc.Subnets {
+			if subnet.Tags[key] == value {
+				subnets = append(subnets, subnet)
+			}
+		}
+
+		vpc.Subnets = subnets
+		out = append(out, vpc)
+	}
 
-	vpc := "// No suitable VPC found."
-	if ok {
-		public := publicSubnets(primaryVPC.Subnets)
-		private := privateSubnets(primaryVPC.Subnets)
+	return out
+}
 
-		vpc = fmt.Sprintf(`vpc: {
-    primary: {
-        privateSubnets: %v
-        publicSubnets: %v
-    }
-}`, subnetsAsTypescriptArray(private), subnetsAsTypescriptArray(public))
+// excludeSubnets returns copies of the VPCs without the subnets whose ID or
+// 'Name' tag starts with one of the prefixes, or (if tagKey is set) which have
+// the given tag value, e.g. to ignore legacy subnets.
+//
+// This happens before selection, so excluded subnets don't count towards the
+// subnet-count strategy's limits: a VPC with 3 public and 3 private subnets
+// plus a legacy one becomes an exact match, but one that relies on legacy
+// subnets to reach the minimum no longer matches.
+func excludeSubnets(VPCs []PrismVPC, prefixes []string, tagKey string, tagValue string) []PrismVPC {
+	excluded := func(subnet PrismSubnet) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(subnet.SubnetID, prefix) || strings.HasPrefix(subnet.Tags["Name"], prefix) {
+				return true
+			}
+		}
+
+		return tagKey != "" && subnet.Tags[tagKey] == tagValue
 	}
 
-	return fmt.Sprintf(`import type { AwsAccountSetupProps } from '../types';
+	out := []PrismVPC{}
+	for _, vpc := range VPCs {
+		subnets := []PrismSubnet{}
+		for _, subnet := range vpc.Subnets {
+			if !excluded(subnet) {
+				subnets = append(subnets, subnet)
+			}
+		}
+
+		vpc.Subnets = subnets
+		out = append(out, vpc)
+	}
 
-export const %sAccount: AwsAccountSetupProps = {
-    accountNumber: '%s',
-    accountName: '%s',
-    stack: '%s',
-    bucketForArtifacts: 'TODO',
-    bucketForPrivateConfig: 'TODO',
-    logging: {
-    streamName: 'TODO',
-    %s
+	return out
 }
-`, camelCase(info.AccountName), info.AccountNumber, info.AccountName, camelCase(info.AccountName), vpc)
+
+// subnetPrefixProblems checks the VPC's public and private subnets have the
+// expected prefix lengths (e.g. 20 for a /20), where non-zero, returning a
+// message for each that doesn't. Subnets without a CIDR are skipped.
+func subnetPrefixProblems(vpc PrismVPC, publicBits int, privateBits int) []string {
+	problems := []string{}
+
+	tiers := []struct {
+		name    string
+		subnets []PrismSubnet
+		bits    int
+	}{
+		{"public", prism.PublicSubnets(vpc.Subnets), publicBits},
+		{"private", prism.PrivateSubnets(vpc.Subnets), privateBits},
+	}
+	for _, tier := range tiers {
+		if tier.bits == 0 {
+			continue
+		}
+
+		for _, subnet := range tier.subnets {
+			if subnet.CIDR == "" {
+				continue
+			}
+
+			// netip.Prefix is a small value type, unlike the older net.IPNet,
+			// so is cheap to pass around and compare.
+			prefix, err := netip.ParsePrefix(subnet.CIDR)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s subnet %s has an invalid CIDR %q", tier.name, subnet.SubnetID, subnet.CIDR))
+				continue
+			}
+
+			if prefix.Bits() != tier.bits {
+				problems = append(problems, fmt.Sprintf("%s subnet %s is %s, expected a /%d", tier.name, subnet.SubnetID, prefix, tier.bits))
+			}
+		}
+	}
+
+	return problems
 }
 
-type AccountID string
+// vpcRegion returns the VPC's region, falling back to the region of its first
+// subnet's AZ (e.g. 'eu-west-1a' is in 'eu-west-1'), or "" if unknown.
+func vpcRegion(vpc PrismVPC) string {
+	if vpc.Region != "" {
+		return vpc.Region
+	}
 
-// A bit like the Scala equivalent trait.
-type PrismLike interface {
-	getAccounts() []PrismAccount
-	getVPCs() map[AccountID][]PrismVPC
+	for _, subnet := range vpc.Subnets {
+		if az := subnet.AvailabilityZone; az != "" {
+			return strings.TrimRight(az, "abcdefghijklmnopqrstuvwxyz")
+		}
+	}
+
+	return ""
 }
 
-type Prism struct{}
+// excludeUnavailableVPCs drops VPCs that Prism says are not yet (or no
+// longer) available, returning them separately so they can be reported.
+func excludeUnavailableVPCs(VPCs []PrismVPC) ([]PrismVPC, []PrismVPC) {
+	available := []PrismVPC{}
+	unavailable := []PrismVPC{}
+	for _, vpc := range VPCs {
+		if vpc.State == "" || vpc.State == "available" {
+			available = append(available, vpc)
+		} else {
+			unavailable = append(unavailable, vpc)
+		}
+	}
 
-// 'Methods' in Go look like this.
-func (p Prism) getAccounts() []PrismAccount {
-	// Use the in-built 'http' library, which you quickly get to know when
-	// writing Go.
-	resp, err := http.Get("https://prism.gutools.co.uk/sources/accounts")
-	check(err, "unable to get prism accounts")
-	defer resp.Body.Close()
+	return available, unavailable
+}
 
-	data, err := io.ReadAll(resp.Body)
-	check(err, "unable to read prism accounts response body")
+// includeVPCs returns only the VPCs whose ID is in 'ids'.
+func includeVPCs(VPCs []PrismVPC, ids []string) []PrismVPC {
+	out := []PrismVPC{}
+	for _, vpc := range VPCs {
+		if slices.Contains(ids, vpc.VPCID) {
+			out = append(out, vpc)
+		}
+	}
 
-	var wrapper PrismResponseAccountsWrapper
+	return out
+}
 
-	// Use the in-build 'json' library here, which you quickly get to know when
-	// writing Go.
-	err = json.Unmarshal(data, &wrapper)
-	check(err, "unable to unmarshal accounts response")
+func subnetsAsTypescriptArray(subnets []PrismSubnet) string {
+	ids := []string{}
+	for _, s := range subnets {
+		ids = append(ids, fmt.Sprintf("'%s'", s.SubnetID))
+	}
 
-	return wrapper.Data
+	return "[" + strings.Join(ids, ", ") + "]"
 }
 
-// Go typically does not provide these kinds of collection functions out of the
-// box so you have to write them yourself or use a library :(.
-func groupBy[A any, B comparable](items []A, f func(item A) B) map[B][]A {
-	m := make(map[B][]A)
+// Like subnetsAsTypescriptArray but places each subnet on its own line with a
+// trailing comment noting whether it is public or private (and its AZ, where
+// known). 'indent' is the indentation of the line the array starts on.
+func subnetsAsAnnotatedTypescriptArray(subnets []PrismSubnet, indent string) string {
+	if len(subnets) == 0 {
+		return "[]"
+	}
 
-	for _, item := range items {
-		key := f(item)
-		existing, ok := m[key]
-		if !ok {
-			m[key] = []A{item}
-		} else {
-			m[key] = append(existing, item)
+	out := "[\n"
+	for _, s := range subnets {
+		comment := string(prism.ClassifySubnet(s))
+		if s.AvailabilityZone != "" {
+			comment += ", " + s.AvailabilityZone
 		}
+
+		out += fmt.Sprintf("%s    '%s', // %s\n", indent, s.SubnetID, comment)
 	}
 
-	return m
+	return out + indent + "]"
 }
 
-func (p Prism) getVPCs() map[AccountID][]PrismVPC {
-	resp, err := http.Get("https://prism.gutools.co.uk/vpcs")
-	check(err, "unable to get prism vpcs")
-	defer resp.Body.Close()
+// The supported values for '-subnet-order'.
+var subnetOrders = []string{"az", "id", "prism"}
 
-	data, err := io.ReadAll(resp.Body)
-	check(err, "unable to read prism vpcs response body")
+// orderSubnets returns a copy of the subnets sorted by ID ('id'), by AZ then ID
+// ('az'), or left in the order Prism returned them ('prism').
+func orderSubnets(subnets []PrismSubnet, order string) []PrismSubnet {
+	out := append([]PrismSubnet{}, subnets...)
 
-	var wrapper PrismResponseVPCsWrapper
-	err = json.Unmarshal(data, &wrapper)
-	check(err, "unable to unmarshal vpcs response")
+	switch order {
+	case "id":
+		sort.SliceStable(out, func(i, j int) bool {
+			return out[i].SubnetID < out[j].SubnetID
+		})
+	case "az":
+		sort.SliceStable(out, func(i, j int) bool {
+			if out[i].AvailabilityZone != out[j].AvailabilityZone {
+				return out[i].AvailabilityZone < out[j].AvailabilityZone
+			}
+			return out[i].SubnetID < out[j].SubnetID
+		})
+	}
 
-	return groupBy(wrapper.Data.VPCs, func(item PrismVPC) AccountID {
-		return AccountID(item.AccountID)
-	})
+	return out
 }
 
-// Another way of denoting a string that is present or not is to use a 'pointer'
-// in Go. Again, Scala is a bit nicer here.
-func stringPtr(s string) *string {
-	return &s
+// Options controlling how templates are rendered. The zero value gives the
+// default output.
+type RenderOptions struct {
+	AnnotateSubnets bool
+	PrettyJSON      bool
+	// Only include one of the subnet tiers in the Typescript 'vpc' block.
+	OnlyPublic  bool
+	OnlyPrivate bool
+	// One of subnetOrders; see orderSubnets.
+	SubnetOrder string
+	// Added around the generated constant name, e.g. 'gen' gives
+	// 'genDeployToolsAccount'.
+	ConstPrefix string
+	ConstSuffix string
+	// Replaces the built-in Typescript template if set; see TemplateData.
+	Template *template.Template
+	// Leave out fields that are still placeholders; see renderCompact.
+	Compact bool
+	// If set, Typescript output starts with a comment saying how it was
+	// generated.
+	Provenance *Provenance
+	// Declare each subnet array as a const above the account object and
+	// refer to it by name; see subnetConstPrefix.
+	SubnetConsts bool
+	// Replaces defaultNoVPCComment if set; see NoVPCCommentData.
+	NoVPCComment *template.Template
+	Runbook      string
+	// From '-var', for '-template-file' and the no-VPC comment. The built-in
+	// Typescript output lists them in a comment; see varsComment.
+	Vars map[string]string
 }
 
-func check(err error, msg string) {
+// The name of the exported Typescript constant for the account.
+func (info AccountInfo) constName(opts RenderOptions) string {
+	return opts.ConstPrefix + camelCase(info.AccountName) + "Account" + opts.ConstSuffix
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// isIdentifier reports whether s is a legal Typescript identifier (ignoring
+// reserved words, which can't occur as our names always end in 'Account').
+func isIdentifier(s string) bool {
+	return identifierPattern.MatchString(s)
+}
+
+// asTypescriptTemplate is a convenience wrapper around Render for when a string
+// is more useful than a writer.
+func (info AccountInfo) asTypescriptTemplate(opts RenderOptions) string {
+	var b strings.Builder
+
+	// Writing to a strings.Builder never fails, so an error can only come
+	// from a custom template.
+	err := info.Render(&b, opts)
 	if err != nil {
-		log.Fatalf("%s: %v", msg, err)
+		warnf(info.AccountName, "unable to render: %v", err)
 	}
+
+	return b.String()
 }
 
-func camelCase(s string) string {
-	parts := strings.Split(s, "-")
+// Render writes the account's Typescript template to w.
+//
+// Go does not have string interpolation sadly so this is more painful and
+// harder to read than the Scala equivalent.
+func (info AccountInfo) Render(w io.Writer, opts RenderOptions) error {
+	if opts.Template != nil {
+		return info.renderTemplate(w, opts)
+	}
 
-	out := ""
-	for _, part := range parts {
-		out += strings.Title(part)
+	if opts.Compact {
+		return info.renderCompact(w, opts)
 	}
 
-	return out
+	consts := ""
+	vpc := ""
+	if len(info.Regions) > 0 {
+		vpc = "vpc: {\n"
+		for _, region := range info.Regions {
+			if region.Selection.Warning != "" {
+				vpc += "        // WARNING: " + region.Selection.Warning + "\n"
+			}
+			tiers, regionConsts := subnetTiers(region.Selection.VPC, opts, "                ", info.subnetConstPrefix(opts, region.Region))
+			consts += regionConsts
+			vpc += fmt.Sprintf(`        '%s': {
+            primary: {
+%s            },
+        },
+`, region.Region, tiers)
+		}
+		vpc += "    },"
+	} else if info.Selection.Found {
+		tiers, primaryConsts := subnetTiers(info.Selection.VPC, opts, "            ", info.subnetConstPrefix(opts, ""))
+		consts += primaryConsts
+		vpc = fmt.Sprintf(`vpc: {
+        primary: {
+%s        },
+    },`, tiers)
+
+		if info.Selection.Warning != "" {
+			vpc = "// WARNING: " + info.Selection.Warning + "\n    " + vpc
+		}
+	} else {
+		comment, err := info.noVPCComment(opts)
+		if err != nil {
+			return err
+		}
+		vpc = strings.ReplaceAll(comment, "\n", "\n    ")
+	}
+
+	// Without a configured stack, fall back to one derived from the account
+	// name.
+	stack := info.Stack
+	if stack == placeholder {
+		stack = camelCase(info.AccountName)
+	}
+
+	if consts != "" {
+		consts += "\n"
+	}
+
+	_, err := fmt.Fprintf(w, `import type { AwsAccountSetupProps } from '../types';
+
+%s%sexport const %s: AwsAccountSetupProps = {
+    accountNumber: '%s',
+    accountName: '%s',
+    stack: '%s',
+    bucketForArtifacts: '%s',
+    bucketForPrivateConfig: '%s',
+    logging: {
+        streamName: '%s',
+    },
+    %s
+};
+`, varsComment(opts.Vars), consts, info.constName(opts), info.AccountNumber, info.AccountName, stack, ptrOr(info.BucketForArtifact, placeholder), ptrOr(info.BucketForPrivateConfig, placeholder), info.Logging.StreamName, vpc)
+
+	return err
 }
 
-// Main is surprisingly similar to the Scala equivalent.
-func main() {
-	// get accounts and vpcs
-	prism := Prism{}
-	accounts := prism.getAccounts()
-	vpcs := prism.getVPCs()
+// The default for '-no-vpc-comment-template'.
+const defaultNoVPCCommentTemplate = "// No suitable VPC found: {{.Reason}}"
 
-	accountsToMigrate := []string{"deploy-tools"}
+var defaultNoVPCComment = template.Must(template.New("no-vpc-comment").Parse(defaultNoVPCCommentTemplate))
 
-	infos := []AccountInfo{}
-	for _, account := range accounts {
-		if !slices.Contains(accountsToMigrate, account.AccountName) {
-			continue
+// NoVPCCommentData is the data available to '-no-vpc-comment-template'.
+type NoVPCCommentData struct {
+	AccountName   string
+	AccountNumber string
+	// Why no VPC was chosen, e.g. 'no non-default VPC with 3 public and 3
+	// private subnets'.
+	Reason string
+	// From '-runbook-url'.
+	Runbook string
+	// From '-var', e.g. '{{.Vars.team}}'.
+	Vars map[string]string
+}
+
+// noVPCComment renders the comment left in place of the 'vpc' block when no
+// primary VPC was found, without a trailing newline.
+func (info AccountInfo) noVPCComment(opts RenderOptions) (string, error) {
+	tmpl := opts.NoVPCComment
+	if tmpl == nil {
+		tmpl = defaultNoVPCComment
+	}
+
+	var b strings.Builder
+	err := tmpl.Execute(&b, NoVPCCommentData{
+		AccountName:   info.AccountName,
+		AccountNumber: info.AccountNumber,
+		Reason:        info.Selection.Reason,
+		Runbook:       opts.Runbook,
+		Vars:          opts.Vars,
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to render no-VPC comment for %s: %w", info.AccountName, err)
+	}
+
+	return strings.TrimRight(b.String(), "\n"), nil
+}
+
+// subnetConstPrefix is the start of the names of the account's subnet consts
+// with '-subnet-consts' (and "" otherwise), e.g. 'deployToolsAccount' for
+// 'deployToolsAccountPrivateSubnets'. It's based on the exported name, which
+// has to be unique anyway, plus the region with '-multi-region'.
+func (info AccountInfo) subnetConstPrefix(opts RenderOptions, region string) string {
+	if !opts.SubnetConsts {
+		return ""
+	}
+
+	name := info.constName(opts) + camelCase(region)
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// subnetTiers renders the VPC's subnet tiers as Typescript object fields, one
+// per line with the given indent. If constPrefix is set, the subnet arrays
+// are instead returned as const declarations, and the fields refer to them.
+func subnetTiers(vpc PrismVPC, opts RenderOptions, indent string, constPrefix string) (tiers string, consts string) {
+	public := orderSubnets(prism.PublicSubnets(vpc.Subnets), opts.SubnetOrder)
+	private := orderSubnets(prism.PrivateSubnets(vpc.Subnets), opts.SubnetOrder)
+
+	asArray := subnetsAsTypescriptArray
+	if opts.AnnotateSubnets {
+		asArray = func(subnets []PrismSubnet) string {
+			// Consts are declared at the top level, so aren't indented.
+			if constPrefix != "" {
+				return subnetsAsAnnotatedTypescriptArray(subnets, "")
+			}
+			return subnetsAsAnnotatedTypescriptArray(subnets, indent)
 		}
+	}
 
-		vpcs, ok := vpcs[AccountID(account.AccountNumber)]
-		if !ok {
-			vpcs = []PrismVPC{}
+	field := func(name string, suffix string, subnets []PrismSubnet) {
+		value := asArray(subnets)
+		if constPrefix != "" {
+			consts += fmt.Sprintf("const %s = %s;\n", constPrefix+suffix, value)
+			value = constPrefix + suffix
+		}
+		tiers += fmt.Sprintf("%s%s: %v,\n", indent, name, value)
+	}
+
+	if !opts.OnlyPublic {
+		field("privateSubnets", "PrivateSubnets", private)
+	}
+	if !opts.OnlyPrivate {
+		field("publicSubnets", "PublicSubnets", public)
+	}
+	// Most VPCs have no reserved tier, so it's left out when empty.
+	reserved := orderSubnets(prism.ReservedSubnets(vpc.Subnets), opts.SubnetOrder)
+	if len(reserved) > 0 && !opts.OnlyPublic && !opts.OnlyPrivate {
+		field("reservedSubnets", "ReservedSubnets", reserved)
+	}
+	// For CDK's 'Vpc.fromVpcAttributes'. Left out if Prism is missing AZs.
+	if azs, ok := knownAvailabilityZones(vpc); ok {
+		tiers += fmt.Sprintf("%savailabilityZones: %s,\n", indent, asTypescriptStringArray(azs))
+	}
+
+	return tiers, consts
+}
+
+// renderCompact is like Render but omits any field still set to the
+// placeholder. As the result may lack required fields, it's typed as a
+// Partial.
+func (info AccountInfo) renderCompact(w io.Writer, opts RenderOptions) error {
+	stack := info.Stack
+	if stack == placeholder {
+		stack = camelCase(info.AccountName)
+	}
+
+	fields := []string{
+		fmt.Sprintf("accountNumber: '%s',", info.AccountNumber),
+		fmt.Sprintf("accountName: '%s',", info.AccountName),
+		fmt.Sprintf("stack: '%s',", stack),
+	}
+
+	if bucket := ptrOr(info.BucketForArtifact, placeholder); bucket != placeholder {
+		fields = append(fields, fmt.Sprintf("bucketForArtifacts: '%s',", bucket))
+	}
+	if bucket := ptrOr(info.BucketForPrivateConfig, placeholder); bucket != placeholder {
+		fields = append(fields, fmt.Sprintf("bucketForPrivateConfig: '%s',", bucket))
+	}
+	if info.Logging.StreamName != placeholder && info.Logging.StreamName != "" {
+		fields = append(fields, fmt.Sprintf("logging: { streamName: '%s' },", info.Logging.StreamName))
+	}
+
+	if info.Selection.Found {
+		public := orderSubnets(prism.PublicSubnets(info.Selection.VPC.Subnets), opts.SubnetOrder)
+		private := orderSubnets(prism.PrivateSubnets(info.Selection.VPC.Subnets), opts.SubnetOrder)
+
+		tiers := []string{}
+		if !opts.OnlyPublic {
+			tiers = append(tiers, fmt.Sprintf("privateSubnets: %v", subnetsAsTypescriptArray(private)))
+		}
+		if !opts.OnlyPrivate {
+			tiers = append(tiers, fmt.Sprintf("publicSubnets: %v", subnetsAsTypescriptArray(public)))
+		}
+		reserved := orderSubnets(prism.ReservedSubnets(info.Selection.VPC.Subnets), opts.SubnetOrder)
+		if len(reserved) > 0 && !opts.OnlyPublic && !opts.OnlyPrivate {
+			tiers = append(tiers, fmt.Sprintf("reservedSubnets: %v", subnetsAsTypescriptArray(reserved)))
+		}
+		if azs, ok := knownAvailabilityZones(info.Selection.VPC); ok {
+			tiers = append(tiers, fmt.Sprintf("availabilityZones: %s", asTypescriptStringArray(azs)))
 		}
 
-		info := AccountInfo{
-			AccountNumber:          account.AccountNumber,
-			AccountName:            account.AccountName,
-			Stack:                  "TODO",
-			BucketForArtifact:      stringPtr("TODO"),
-			BucketForPrivateConfig: stringPtr("TODO"),
-			Logging:                Logging{StreamName: "TODO"},
-			VPCs:                   vpcs,
+		if info.Selection.Warning != "" {
+			fields = append(fields, "// WARNING: "+info.Selection.Warning)
 		}
+		fields = append(fields, fmt.Sprintf("vpc: { primary: { %s } },", strings.Join(tiers, ", ")))
+	} else {
+		comment, err := info.noVPCComment(opts)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, strings.Split(comment, "\n")...)
+	}
 
-		infos = append(infos, info)
+	_, err := fmt.Fprintf(w, `import type { AwsAccountSetupProps } from '../types';
+
+%sexport const %s: Partial<AwsAccountSetupProps> = {
+    %s
+};
+`, varsComment(opts.Vars), info.constName(opts), strings.Join(fields, "\n    "))
+
+	return err
+}
+
+type AccountID string
+
+// A bit like the Scala equivalent trait.
+type PrismLike interface {
+	getAccounts(ctx context.Context) ([]PrismAccount, error)
+	getVPCs(ctx context.Context) (map[AccountID][]PrismVPC, error)
+	getVPCsForAccount(ctx context.Context, id AccountID) ([]PrismVPC, error)
+}
+
+type Prism struct {
+	// BaseURL is the Prism root, e.g. 'https://prism.gutools.co.uk'.
+	BaseURL string
+	Client  *http.Client
+	// Tolerate non-standard JSON (currently trailing commas) in responses.
+	LenientJSON bool
+	// Optional; records request durations when set.
+	Metrics *Metrics
+	// How many times to retry failed requests, waiting according to Backoff.
+	Retries int
+	Backoff *Backoff
+	// Optional full URLs for the accounts and VPCs endpoints, for setups
+	// where they're behind different gateways. By default both are derived
+	// from BaseURL.
+	AccountsURL string
+	VPCsURL     string
+	// Extra headers to send with every request, e.g. 'X-Request-ID'.
+	Headers http.Header
+	// The Prism API version to request, or 0 for Prism's default (version
+	// 1). Only the shape of VPC responses differs between versions.
+	APIVersion int
+	// If set, responses are saved to RecordDir, or read from ReplayDir
+	// rather than the network; see fixtureName.
+	RecordDir string
+	ReplayDir string
+	// If set, responses with an ETag are cached here and revalidated with
+	// 'If-None-Match' next time, reusing the cached body on a 304.
+	CacheDir string
+	// The largest response body to accept, after decompression. Zero means
+	// defaultMaxResponseBytes.
+	MaxResponseBytes int64
+}
+
+// Far bigger than Prism's response for every VPC we have, but small enough
+// that a runaway response can't exhaust memory.
+const defaultMaxResponseBytes = 50 << 20
+
+func (p Prism) accountsURL() string {
+	if p.AccountsURL != "" {
+		return p.AccountsURL
 	}
+	return p.BaseURL + "/sources/accounts"
+}
 
-	for _, info := range infos {
-		fmt.Println(info.asTypescriptTemplate())
+func (p Prism) vpcsURL() string {
+	if p.VPCsURL != "" {
+		return p.VPCsURL
 	}
+	return p.BaseURL + "/vpcs"
+}
+
+// validateURL checks that s is an absolute http(s) URL.
+func validateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must use http or https", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", s)
+	}
+
+	return nil
+}
+
+// Preset Prism base URLs for '-env'.
+var prismEnvironments = map[string]string{
+	"prod":  "https://prism.gutools.co.uk",
+	"code":  "https://prism.code.dev-gutools.co.uk",
+	"local": "http://localhost:9000",
+}
+
+// prismURL resolves the Prism base URL from the '-env' and '-prism-url' flags.
+// An explicit URL always takes precedence over the environment preset.
+func prismURL(env string, override string) (string, error) {
+	if override != "" {
+		return strings.TrimSuffix(override, "/"), nil
+	}
+
+	url, ok := prismEnvironments[env]
+	if !ok {
+		envs := []string{}
+		for name := range prismEnvironments {
+			envs = append(envs, name)
+		}
+		sort.Strings(envs)
+
+		return "", fmt.Errorf("unknown environment %q; valid environments are: %s", env, strings.Join(envs, ", "))
+	}
+
+	return url, nil
+}
+
+// 'Methods' in Go look like this.
+func (p Prism) getAccounts(ctx context.Context) ([]PrismAccount, error) {
+	var wrapper PrismResponseAccountsWrapper
+	err := p.getJSON(ctx, p.accountsURL(), &wrapper)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get prism accounts: %w", err)
+	}
+
+	return wrapper.Data, nil
+}
+
+// dedupeAccountNumbers keeps one account per account number, as VPCs are
+// keyed by number and so can't be told apart between them. The winner is the
+// first by name, rather than by Prism's order, so that it's stable between
+// runs. The duplicates found are returned by number, winner first.
+func dedupeAccountNumbers(accounts []PrismAccount) ([]PrismAccount, map[string][]PrismAccount) {
+	byNumber := groupBy(accounts, func(a PrismAccount) string { return a.AccountNumber })
+
+	out := []PrismAccount{}
+	duplicates := map[string][]PrismAccount{}
+	for _, account := range accounts {
+		sharing := byNumber[account.AccountNumber]
+		if len(sharing) == 1 {
+			out = append(out, account)
+			continue
+		}
+
+		if _, seen := duplicates[account.AccountNumber]; seen {
+			continue
+		}
+
+		sorted := append([]PrismAccount{}, sharing...)
+		slices.SortStableFunc(sorted, func(a, b PrismAccount) int { return strings.Compare(a.AccountName, b.AccountName) })
+		duplicates[account.AccountNumber] = sorted
+		out = append(out, sorted[0])
+	}
+
+	return out, duplicates
+}
+
+// AccountVPCs is an account's VPCs along with its name, which is friendlier
+// than a bare account number when logging.
+type AccountVPCs struct {
+	Name string
+	VPCs []PrismVPC
+}
+
+// withAccountNames joins VPCs grouped by account number with the account
+// names. Accounts Prism doesn't know about keep an empty name.
+func withAccountNames(l prism.AccountLookup, vpcs map[AccountID][]PrismVPC) map[AccountID]AccountVPCs {
+	out := make(map[AccountID]AccountVPCs, len(vpcs))
+
+	for id, accountVPCs := range vpcs {
+		account, _ := l.GetAccountByNumber(string(id))
+		out[id] = AccountVPCs{Name: account.AccountName, VPCs: accountVPCs}
+	}
+
+	return out
+}
+
+// logVPCCounts logs (verbosely) how many VPCs Prism returned for each account, sorted by
+// account name (or number, if the name is unknown).
+func logVPCCounts(named map[AccountID]AccountVPCs) {
+	ids := sortedKeys(named)
+	label := func(id AccountID) string {
+		if named[id].Name == "" {
+			return string(id)
+		}
+		return named[id].Name
+	}
+	slices.SortFunc(ids, func(a, b AccountID) int { return strings.Compare(label(a), label(b)) })
+
+	for _, id := range ids {
+		logVerbose("%s (%s): %d VPCs", label(id), id, len(named[id].VPCs))
+	}
+}
+
+// accountsInOU returns the names of all accounts in the given organisational
+// unit. If Prism has returned no OU data at all, the filter can't be applied so
+// we warn and return false.
+func accountsInOU(accounts []PrismAccount, ou string) ([]string, bool) {
+	names := []string{}
+	hasOUData := false
+
+	for _, account := range accounts {
+		if account.OrganizationalUnit == "" {
+			continue
+		}
+
+		hasOUData = true
+		if account.OrganizationalUnit == ou {
+			names = append(names, account.AccountName)
+		}
+	}
+
+	if !hasOUData {
+		warnf("", "prism returned no organisational unit data; ignoring -ou %s", ou)
+		return nil, false
+	}
+
+	return names, true
+}
+
+// Go typically does not provide these kinds of collection functions out of the
+// box so you have to write them yourself or use a library :(.
+func groupBy[A any, B comparable](items []A, f func(item A) B) map[B][]A {
+	m := make(map[B][]A)
+
+	for _, item := range items {
+		key := f(item)
+		existing, ok := m[key]
+		if !ok {
+			m[key] = []A{item}
+		} else {
+			m[key] = append(existing, item)
+		}
+	}
+
+	return m
+}
+
+// sortedKeys returns the map's keys in order, so that output doesn't depend on
+// Go's (deliberately random) map iteration order.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+	return keys
+}
+
+func (p Prism) getVPCs(ctx context.Context) (map[AccountID][]PrismVPC, error) {
+	vpcs, err := p.getVPCsFrom(ctx, p.vpcsURL())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get prism vpcs: %w", err)
+	}
+
+	return groupBy(vpcs, func(item PrismVPC) AccountID {
+		return AccountID(item.AccountID)
+	}), nil
+}
+
+// getVPCsForAccount fetches a single account's VPCs using Prism's field
+// filtering, which is much smaller than fetching every VPC.
+func (p Prism) getVPCsForAccount(ctx context.Context, id AccountID) ([]PrismVPC, error) {
+	u, err := url.Parse(p.vpcsURL())
+	if err != nil {
+		return nil, fmt.Errorf("invalid vpcs URL: %w", err)
+	}
+
+	query := u.Query()
+	query.Set("accountId", string(id))
+	u.RawQuery = query.Encode()
+
+	vpcs, err := p.getVPCsFrom(ctx, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to get prism vpcs for %s: %w", id, err)
+	}
+
+	return vpcs, nil
+}
+
+// getVPCsFrom fetches VPCs from a VPCs endpoint URL, decoding the response
+// shape for the requested API version.
+func (p Prism) getVPCsFrom(ctx context.Context, url string) ([]PrismVPC, error) {
+	if p.APIVersion == 2 {
+		var wrapper PrismResponseVPCsWrapperV2
+		err := p.getJSON(ctx, url, &wrapper)
+		return wrapper.Data, err
+	}
+
+	var wrapper PrismResponseVPCsWrapper
+	err := p.getJSON(ctx, url, &wrapper)
+	return wrapper.Data.VPCs, err
+}
+
+// getVPCsByAccount fetches VPCs for each account individually, with at most
+// 'limit' requests in flight at once. If 'failFast' is set, the first error
+// cancels any outstanding requests and is returned. Otherwise errors are
+// returned per account and the remaining requests carry on.
+func getVPCsByAccount(ctx context.Context, prism PrismLike, accounts []PrismAccount, limit int, failFast bool) (map[AccountID][]PrismVPC, map[AccountID]error, error) {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(limit)
+
+	var mu sync.Mutex
+	out := make(map[AccountID][]PrismVPC, len(accounts))
+	errs := make(map[AccountID]error)
+
+	for _, account := range accounts {
+		id := AccountID(account.AccountNumber)
+		g.Go(func() error {
+			// Go blocks until there's a free slot, by which time an earlier
+			// failure may have cancelled the rest.
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			vpcs, err := prism.getVPCsForAccount(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if failFast {
+					return err
+				}
+
+				errs[id] = err
+				return nil
+			}
+
+			out[id] = vpcs
+			return nil
+		})
+	}
+
+	err := g.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out, errs, nil
+}
+
+// getJSON fetches url and unmarshals the response body into v. Errors are
+// returned as one of NetworkError, StatusError or ParseError so that callers
+// can tell the failure modes apart.
+//
+// Retryable failures (see isRetryable) are retried up to p.Retries times.
+func (p Prism) getJSON(ctx context.Context, url string, v any) error {
+	for attempt := 0; ; attempt++ {
+		err := p.getJSONOnce(ctx, url, v)
+		if err == nil || attempt >= p.Retries || p.Backoff == nil || !isRetryable(err) {
+			return err
+		}
+
+		delay, ok := retryDelay(ctx, err, p.Backoff, attempt)
+		if !ok {
+			return fmt.Errorf("not retrying as the timeout would be exceeded: %w", err)
+		}
+
+		p.Metrics.observeRetry()
+		warnf("", "retrying %s in %s: %v", url, delay.Round(time.Millisecond), err)
+
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+func (p Prism) getJSONOnce(ctx context.Context, url string, v any) error {
+	var data []byte
+	var err error
+	if p.ReplayDir != "" {
+		data, err = readFixture(p.ReplayDir, url)
+	} else {
+		data, err = p.fetch(ctx, url)
+	}
+	if err != nil {
+		return err
+	}
+
+	if p.RecordDir != "" {
+		err = writeFixture(p.RecordDir, url, data)
+		if err != nil {
+			return fmt.Errorf("unable to record response from %s: %w", url, err)
+		}
+	}
+
+	if p.LenientJSON {
+		var fixed bool
+		data, fixed = stripTrailingCommas(data)
+		if fixed {
+			warnf("", "removed trailing commas from invalid JSON response from %s", url)
+		}
+	}
+
+	// Use the in-build 'json' library here, which you quickly get to know when
+	// writing Go.
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return &ParseError{URL: url, Err: err}
+	}
+
+	return nil
+}
+
+// fetch returns the (decompressed) body of a successful response from url.
+func (p Prism) fetch(ctx context.Context, url string) ([]byte, error) {
+	// Use the in-built 'http' library, which you quickly get to know when
+	// writing Go.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.APIVersion > 0 {
+		req.Header.Set("Accept", fmt.Sprintf("application/vnd.prism.v%d+json", p.APIVersion))
+	}
+
+	for name, values := range p.Headers {
+		req.Header[name] = values
+	}
+
+	var cached cacheEntry
+	var isCached bool
+	if p.CacheDir != "" {
+		cached, isCached, err = readCache(p.CacheDir, url, p.APIVersion)
+		if err != nil {
+			warnf("", "ignoring cached response: %v", err)
+		}
+		if isCached && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+	}
+
+	start := time.Now()
+	resp, err := p.Client.Do(req)
+	p.Metrics.observeRequest(time.Since(start))
+	if err != nil {
+		return nil, &NetworkError{URL: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	// Go's transport transparently decompresses gzip responses only when it
+	// requested them itself, so handle the case where the body arrives still
+	// encoded.
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, &ParseError{URL: url, Err: fmt.Errorf("invalid gzip body: %w", err)}
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	limit := p.MaxResponseBytes
+	if limit <= 0 {
+		limit = defaultMaxResponseBytes
+	}
+
+	// Read one byte more than the limit, to tell a response of exactly the
+	// limit from one that's too big.
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, &NetworkError{URL: url, Err: err}
+	}
+	if int64(len(data)) > limit {
+		return nil, &ResponseTooLargeError{URL: url, Limit: limit}
+	}
+
+	// Prism only answers 304 Not Modified if we sent an ETag, i.e. there's a
+	// cached body to use instead.
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		return []byte(cached.Body), nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retryAfter, _ := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, &StatusError{URL: url, Code: resp.StatusCode, Body: string(data), RetryAfter: retryAfter}
+	}
+
+	if etag := resp.Header.Get("ETag"); p.CacheDir != "" && etag != "" {
+		err = writeCache(p.CacheDir, cacheEntry{URL: url, ETag: etag, Body: string(data)}, p.APIVersion)
+		if err != nil {
+			warnf("", "unable to cache response from %s: %v", url, err)
+		}
+	}
+
+	return data, nil
+}
+
+// Another way of denoting a string that is present or not is to use a 'pointer'
+// in Go. Again, Scala is a bit nicer here.
+func stringPtr(s string) *string {
+	return &s
+}
+
+// ptrOr dereferences p, or returns 'fallback' if p is nil.
+func ptrOr(p *string, fallback string) string {
+	if p == nil {
+		return fallback
+	}
+
+	return *p
+}
+
+// The value used for anything we don't know yet, to be filled in by hand.
+const placeholder = "TODO"
+
+// valueOr returns s, or 'fallback' if s is empty.
+func valueOr(s string, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+
+	return s
+}
+
+func check(err error, msg string) {
+	if err != nil {
+		fatal(fmt.Errorf("%s: %w", msg, err), "")
+	}
+}
+
+func camelCase(s string) string {
+	parts := strings.Split(s, "-")
+
+	out := ""
+	for _, part := range parts {
+		out += strings.Title(part)
+	}
+
+	return out
+}
+
+// streamName renders the logging stream name for an account. The template has
+// access to the account's fields, e.g. '{{.AccountName}}-logging'. With no
+// template, the placeholder 'TODO' is used.
+func streamName(tmpl *template.Template, account PrismAccount) (string, error) {
+	if tmpl == nil {
+		return placeholder, nil
+	}
+
+	var buf strings.Builder
+	err := tmpl.Execute(&buf, account)
+	if err != nil {
+		return "", fmt.Errorf("unable to render stream name for %s: %w", account.AccountName, err)
+	}
+
+	return buf.String(), nil
+}
+
+// readAccountNames reads account names (or numbers), one per line. Blank lines
+// are ignored, and empty input is not an error.
+func readAccountNames(r io.Reader) ([]string, error) {
+	names := []string{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names, scanner.Err()
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	out := []string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
+
+// union returns the distinct items across all lists, in first-seen order.
+func union(lists ...[]string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+
+	for _, list := range lists {
+		for _, item := range list {
+			if !seen[item] {
+				seen[item] = true
+				out = append(out, item)
+			}
+		}
+	}
+
+	return out
+}
+
+// staleVPCs returns any VPCs whose data is older than 'maxAge'. VPCs without a
+// timestamp are not considered stale as there's nothing to compare.
+func staleVPCs(VPCs []PrismVPC, maxAge time.Duration, now time.Time) []PrismVPC {
+	out := []PrismVPC{}
+	for _, vpc := range VPCs {
+		if !vpc.LastUpdated.IsZero() && now.Sub(vpc.LastUpdated) > maxAge {
+			out = append(out, vpc)
+		}
+	}
+
+	return out
+}
+
+// Main is surprisingly similar to the Scala equivalent. The first argument
+// optionally names a subcommand; 'generate' is the default.
+func main() {
+	args := os.Args[1:]
+
+	cmd := "generate"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "generate":
+		generate(args)
+	case "check":
+		checkTypescript(args)
+	case "json-schema":
+		printJSONSchema(args)
+	case "validate-config":
+		validateConfigFile(args)
+	case "list-accounts":
+		listAccounts(args)
+	default:
+		log.Fatalf("unknown command %q; valid commands are: generate, check, json-schema, validate-config, list-accounts", cmd)
+	}
+}
+
+func generate(args []string) {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	ratePerHost := fs.Float64("rate-limit-per-host", 0, "maximum Prism requests per second to each host (0 for no limit)")
+	redact := fs.Bool("redact-account-numbers", false, "mask all but the last 4 digits of account numbers in logs and summaries (not generated files)")
+	errorFormat := fs.String("error-format", "text", "how to report errors on stderr: text, or json ({error, code, account} objects)")
+	logFile := fs.String("log-file", "", "also write the full (verbose) log to this file as JSON lines")
+	failOnEmpty := fs.Bool("fail-on-empty", false, "exit non-zero if no accounts match the filters, rather than successfully doing nothing")
+	count := fs.Bool("count", false, "print the number of accounts that would be processed and exit, without fetching VPCs")
+	preview := fs.Bool("preview", false, "print the VPC and subnet IDs that would be generated for each account, without generating output")
+	validateOnly := fs.Bool("validate-only", false, "only check that each account has a suitable primary VPC, printing PASS or FAIL rather than generating output")
+	apiVersion := fs.Int("prism-api-version", 0, "request this Prism API version (1 or 2) via the Accept header (default: Prism's default, version 1)")
+	var requestHeaders headerFlag
+	fs.Var(&requestHeaders, "request-header", "extra 'Key: Value' header to send with every Prism request (repeatable)")
+	overrideHeaders := fs.Bool("override-protected-headers", false, "allow -request-header to replace the Authorization and User-Agent headers")
+	recordDir := fs.String("record", "", "save the raw Prism responses to this directory, for use with -replay")
+	replayDir := fs.String("replay", "", "read Prism responses saved with -record from this directory instead of the network")
+	maxResponseMB := fs.Int64("max-response-mb", defaultMaxResponseBytes>>20, "largest Prism response to accept, in megabytes (after decompression)")
+	cacheDir := fs.String("cache-dir", "", "cache Prism responses here and revalidate them with their ETag on later runs")
+	trace := fs.Bool("trace", false, "log each Prism HTTP request and response (headers, status and size, but not bodies)")
+	proxy := fs.String("proxy", "", "HTTP proxy URL for Prism requests (default from HTTP_PROXY/HTTPS_PROXY)")
+	header := fs.Bool("header", true, "start generated Typescript with a comment noting the tool version, data source (Prism URL, -replay directory or AWS account) and VPC")
+	noTimestamp := fs.Bool("no-timestamp", false, "leave the generation time out of the -header comment, for deterministic output")
+	noVPCCommentTemplate := fs.String("no-vpc-comment-template", defaultNoVPCCommentTemplate, "Go template for the comment written when no suitable VPC is found; has .AccountName, .AccountNumber, .Reason, .Runbook and .Vars")
+	runbookURL := fs.String("runbook-url", "", "link to docs on fixing accounts without a suitable VPC, for -no-vpc-comment-template's .Runbook")
+	subnetConsts := fs.Bool("subnet-consts", false, "declare each subnet array as a const above the account object and reference it by name")
+	compact := fs.Bool("compact", false, "omit Typescript fields that would only contain the 'TODO' placeholder")
+	annotateSubnets := fs.Bool("annotate-subnets", false, "render each subnet on its own line with a public/private and AZ comment")
+	ou := fs.String("ou", "", "only process accounts in this organisational unit")
+	format := fs.String("format", "typescript", "comma-separated output formats: "+strings.Join(outputFormats, ", "))
+	listFormats := fs.Bool("list-formats", false, "print the supported output formats and exit")
+	subnetPrefixes := fs.String("subnet-id-prefix-filter", "", "comma-separated prefixes of subnet IDs or Name tags to ignore, e.g. 'legacy-'; ignored subnets aren't counted or rendered")
+	excludeSubnetTag := fs.String("exclude-subnet-tag", "", "ignore subnets with this tag, as key=value (e.g. lifecycle=legacy)")
+	publicPrefix := fs.Int("expect-public-prefix", 0, "warn if public subnets' CIDRs aren't this size, e.g. 20 for /20 (0 disables the check; fail with -strict)")
+	privatePrefix := fs.Int("expect-private-prefix", 0, "warn if private subnets' CIDRs aren't this size, e.g. 24 for /24 (0 disables the check; fail with -strict)")
+	subnetTag := fs.String("subnet-tag", "", "only count and render subnets with this tag, as key=value (e.g. cdk:subnet-group=primary)")
+	multiRegion := fs.Bool("multi-region", false, "choose a primary VPC in each region, rendering the Typescript 'vpc' block keyed by region")
+	allowPrivateOnly := fs.Bool("allow-private-only", false, "if no VPC has the expected subnets, accept one with only private subnets (rendering an empty public array)")
+	lenientTopology := fs.Bool("lenient-topology", false, "if no VPC has the expected subnets, accept one spanning only two AZs (2 public, 2 private) with a warning comment")
+	allowExtraSubnets := fs.Bool("allow-extra-subnets", false, "accept VPCs with at least (rather than exactly) the minimum subnet counts; same as -max-public=-1 -max-private=-1")
+	strategy := fs.String("strategy", "subnet-count", "comma-separated VPC selection strategies, tried in order: "+strings.Join(selectionStrategies, ", "))
+	vpcName := fs.String("vpc-name", "", "prefer the VPC with this Name tag (e.g. main), falling back to the other -strategy options if none matches")
+	selectTag := fs.String("select-tag", "", "tag (key=value) identifying the primary VPC for the tag strategy")
+	minPublic := fs.Int("min-public", idealSubnetCount, "minimum public subnets in the primary VPC")
+	maxPublic := fs.Int("max-public", idealSubnetCount, "maximum public subnets in the primary VPC (-1 for no limit)")
+	minPrivate := fs.Int("min-private", idealSubnetCount, "minimum private subnets in the primary VPC")
+	maxPrivate := fs.Int("max-private", idealSubnetCount, "maximum private subnets in the primary VPC (-1 for no limit)")
+	pretty := fs.Bool("pretty", true, "indent JSON output (ignored for ndjson, which is always compact)")
+	streamNameTemplate := fs.String("stream-name-template", "", "Go template for the logging stream name, e.g. '{{.AccountName}}-logging' (default 'TODO')")
+	env := fs.String("env", "prod", "Prism environment: code, local or prod")
+	sourceFlag := fs.String("source", "prism", "where to read accounts and VPCs from: prism, or aws (the EC2 API, for the current AWS credentials' account only)")
+	awsRegion := fs.String("aws-region", "", "region to read VPCs from with -source aws (default from the AWS config)")
+	awsAccountName := fs.String("aws-account-name", "", "name to give the account with -source aws (default its account number)")
+	prismURLOverride := fs.String("prism-url", "", "Prism base URL; overrides -env")
+	accountsURL := fs.String("accounts-url", "", "full URL of the accounts endpoint (default: derived from the Prism base URL)")
+	vpcsURL := fs.String("vpcs-url", "", "full URL of the VPCs endpoint (default: derived from the Prism base URL)")
+	accountsFlag := fs.String("accounts", "", "comma-separated account names or numbers to process (default deploy-tools)")
+	all := fs.Bool("all", false, "process every account in Prism")
+	excludeAccountsFlag := fs.String("exclude-accounts", "", "comma-separated account names or numbers to skip, applied after the other account filters")
+	nameRegexFlag := fs.String("account-name-regex", "", "also select accounts whose name matches this regular expression, e.g. '-prod$'")
+	nameRegexMode := fs.String("account-name-regex-mode", "union", "how -account-name-regex combines with the other account filters: union or intersect")
+	includeInactive := fs.Bool("include-inactive-accounts", false, "process accounts that Prism reports as suspended or closed")
+	interactive := fs.Bool("interactive", false, "ask before overwriting existing files in -output-dir (ignored with -force or if stdin isn't a terminal)")
+	accountsStdin := fs.Bool("accounts-stdin", false, "read account names or numbers from stdin, one per line")
+	outputDir := fs.String("output-dir", "", "write one file per account to this directory rather than stdout")
+	outputZip := fs.String("output-zip", "", "write one file per account into this zip archive rather than stdout")
+	force := fs.Bool("force", false, "overwrite existing files in -output-dir, or an existing -output-zip")
+	lineEnding := fs.String("line-ending", "lf", "line endings for generated output: lf, or crlf")
+	groupByFlag := fs.String("group-by", "none", "organise -output-dir files into subdirectories: none, or stack")
+	normalizeNames := fs.Bool("normalize-names", false, "lowercase account names and replace characters that are unsafe in filenames with '-' (filenames only)")
+	filenameTemplate := fs.String("filename-template", defaultFilenameTemplate, "Go template for -output-dir filenames; has .AccountName, .AccountNumber, .Format, .Ext and 'camel'")
+	postHookFlag := fs.String("post-hook", "", "command to run on each file written to -output-dir, e.g. 'prettier --write {{.File}}'")
+	postHookFatal := fs.Bool("post-hook-fatal", false, "treat -post-hook failures as errors rather than warnings")
+	sidecar := fs.Bool("sidecar", false, "also write a <name>.meta.json per account with the VPCs considered and the chosen VPC's details (requires -output-dir)")
+	writeIndex := fs.Bool("write-index", false, "also write an index.ts re-exporting every account (requires -output-dir)")
+	includeVPCIDs := fs.String("include-vpc-ids", "", "comma-separated VPC IDs to prefer as the primary VPC when suitable")
+	excludeVPCIDs := fs.String("exclude-vpc-ids", "", "comma-separated VPC IDs to never select")
+	maxAge := fs.Duration("max-age", 0, "warn if Prism VPC data is older than this, e.g. 24h (0 disables the check)")
+	strict := fs.Bool("strict", false, "treat warnings about data quality as fatal errors")
+	fs.BoolVar(&warnAsError, "warn-as-error", false, "report every warning as an error in the summary and exit non-zero, without stopping the run")
+	templateFile := fs.String("template-file", "", "Go text/template file to use instead of the built-in Typescript template")
+	var templateVars varsFlag
+	fs.Var(&templateVars, "var", "'key=value' for -template-file and -no-vpc-comment-template to use as {{.Vars.key}}, and listed in a comment in the built-in Typescript output (repeatable)")
+	constPrefix := fs.String("const-prefix", "", "prefix for generated Typescript constant names")
+	constSuffix := fs.String("const-suffix", "", "suffix for generated Typescript constant names, after 'Account'")
+	includeUnavailable := fs.Bool("include-unavailable-vpcs", false, "consider VPCs that Prism reports as not 'available' (e.g. pending)")
+	includeShared := fs.Bool("include-shared-vpcs", false, "consider shared/transit VPCs as primary VPC candidates")
+	subnetOrder := fs.String("subnet-order", "id", "order of subnets in generated arrays: "+strings.Join(subnetOrders, ", "))
+	lenientJSON := fs.Bool("lenient-json", false, "tolerate trailing commas in Prism responses")
+	onlyPublic := fs.Bool("only-public", false, "only include public subnets in the generated vpc block")
+	onlyPrivate := fs.Bool("only-private", false, "only include private subnets in the generated vpc block")
+	showSkipped := fs.Bool("show-skipped", false, "list accounts that were considered but skipped, and why")
+	verbose := fs.Bool("verbose", false, "log extra detail, such as the number of VPCs found per account")
+	timeout := fs.Duration("timeout", 0, "overall time limit for the run, e.g. 5m (0 for none)")
+	retries := fs.Int("retries", 2, "times to retry Prism requests that fail with network or 5xx errors")
+	retryJitter := fs.Float64("retry-jitter", 0.2, "fraction (0-1) by which retry delays are randomly varied")
+	maxRetryAfter := fs.Duration("max-retry-after", defaultMaxRetryAfter, "longest to wait before a retry when Prism's Retry-After header asks for longer (0 for no limit)")
+	retrySeed := fs.Int64("retry-seed", 0, "seed for retry jitter, for repeatable delays (default random)")
+	metricsPath := fs.String("metrics", "", "write Prometheus textfile-format metrics to this file after the run")
+	configPath := fs.String("config", "", "YAML config file, e.g. for account aliases")
+	configDir := fs.String("config-dir", "", "directory of per-environment YAML config files, named <env>.yaml")
+	stack := fs.String("stack", "", "stack for every account (overrides config)")
+	bucketForArtifacts := fs.String("bucket-for-artifacts", "", "artifact bucket for every account (overrides config)")
+	bucketForPrivateConfig := fs.String("bucket-for-private-config", "", "private config bucket for every account (overrides config)")
+	baselinePath := fs.String("baseline", "", "compare results against a report previously written with -format json")
+	failOnBaselineChange := fs.Bool("fail-on-baseline-change", false, "exit non-zero if anything changed since -baseline, e.g. to catch drift in CI")
+	continueOnError := fs.Bool("continue-on-error", true, "carry on processing other accounts when one fails, reporting failures at the end")
+	failFast := fs.Bool("fail-fast", false, "stop at the first account that fails (same as -continue-on-error=false)")
+	perAccountVPCs := fs.Bool("per-account-vpcs", false, "fetch VPCs separately for each account rather than all at once")
+	concurrency := fs.Int("concurrency", 4, "maximum concurrent Prism requests with -per-account-vpcs")
+	fs.Parse(args)
+
+	if *listFormats {
+		for _, f := range outputFormats {
+			fmt.Println(f)
+		}
+		return
+	}
+
+	verboseToConsole = *verbose
+	switch *errorFormat {
+	case "text":
+	case "json":
+		jsonErrors = true
+	default:
+		usagef("invalid -error-format %q; valid values are: text, json", *errorFormat)
+	}
+
+	if *logFile != "" {
+		closeLog, err := openRunLog(*logFile, *redact)
+		check(err, "unable to open -log-file")
+		defer closeLog()
+	}
+
+	if *redact {
+		log.SetOutput(redactingWriter{w: log.Writer()})
+		stderr = redactingWriter{w: os.Stderr}
+	}
+
+	if !slices.Contains(lineEndings, *lineEnding) {
+		usagef("invalid -line-ending %q; valid values are: %s", *lineEnding, strings.Join(lineEndings, ", "))
+	}
+
+	if !slices.Contains(groupings, *groupByFlag) {
+		usagef("invalid -group-by %q; valid values are: %s", *groupByFlag, strings.Join(groupings, ", "))
+	}
+
+	if *onlyPublic && *onlyPrivate {
+		usagef("-only-public and -only-private can't both be set")
+	}
+
+	if *compact && (*templateFile != "" || *annotateSubnets) {
+		usagef("-compact can't be used with -template-file or -annotate-subnets")
+	}
+
+	if !slices.Contains(subnetOrders, *subnetOrder) {
+		usagef("invalid -subnet-order %q; valid values are: %s", *subnetOrder, strings.Join(subnetOrders, ", "))
+	}
+
+	subnetRange := SubnetRange{MinPublic: *minPublic, MaxPublic: *maxPublic, MinPrivate: *minPrivate, MaxPrivate: *maxPrivate}
+	if *allowExtraSubnets {
+		subnetRange.MaxPublic, subnetRange.MaxPrivate = -1, -1
+	}
+
+	if (subnetRange.MaxPublic != -1 && subnetRange.MaxPublic < subnetRange.MinPublic) || (subnetRange.MaxPrivate != -1 && subnetRange.MaxPrivate < subnetRange.MinPrivate) {
+		usagef("invalid subnet range: %s", subnetRange)
+	}
+
+	if !isIdentifier(*constPrefix + "Account" + *constSuffix) {
+		usagef("-const-prefix %q and -const-suffix %q don't give a valid Typescript identifier", *constPrefix, *constSuffix)
+	}
+
+	var subnetTagKey, subnetTagValue string
+	if *subnetTag != "" {
+		var ok bool
+		subnetTagKey, subnetTagValue, ok = strings.Cut(*subnetTag, "=")
+		if !ok || subnetTagKey == "" {
+			usagef("invalid -subnet-tag %q; expected key=value", *subnetTag)
+		}
+	}
+
+	for _, p := range []struct {
+		name string
+		bits int
+	}{{"-expect-public-prefix", *publicPrefix}, {"-expect-private-prefix", *privatePrefix}} {
+		if p.bits < 0 || p.bits > 32 {
+			usagef("%s must be between 0 and 32", p.name)
+		}
+	}
+
+	var excludeSubnetTagKey, excludeSubnetTagValue string
+	if *excludeSubnetTag != "" {
+		var ok bool
+		excludeSubnetTagKey, excludeSubnetTagValue, ok = strings.Cut(*excludeSubnetTag, "=")
+		if !ok || excludeSubnetTagKey == "" {
+			usagef("invalid -exclude-subnet-tag %q; expected key=value", *excludeSubnetTag)
+		}
+	}
+
+	selector, err := newSelector(*strategy, subnetRange, *selectTag, *vpcName, *lenientTopology, *allowPrivateOnly)
+	check(err, "invalid -strategy")
+
+	if *outputDir != "" && *outputZip != "" {
+		usagef("-output-dir and -output-zip can't both be set")
+	}
+
+	var nameRegex *regexp.Regexp
+	if *nameRegexFlag != "" {
+		nameRegex, err = regexp.Compile(*nameRegexFlag)
+		if err != nil {
+			usagef("invalid -account-name-regex %q: %v", *nameRegexFlag, err)
+		}
+	}
+
+	if *nameRegexMode != "union" && *nameRegexMode != "intersect" {
+		usagef("invalid -account-name-regex-mode %q; valid values are: union, intersect", *nameRegexMode)
+	}
+
+	if (*validateOnly || *preview) && (*outputDir != "" || *outputZip != "") {
+		usagef("-validate-only and -preview don't write output, so can't be used with -output-dir or -output-zip")
+	}
+
+	if *validateOnly && *preview {
+		usagef("-validate-only and -preview can't both be set")
+	}
+
+	if *interactive && (*outputDir == "" || *accountsStdin) {
+		usagef("-interactive requires -output-dir, and can't be used with -accounts-stdin")
+	}
+
+	toFiles := *outputDir != "" || *outputZip != ""
+
+	formats, err := parseFormats(*format, !toFiles)
+	check(err, "invalid -format")
+
+	if *multiRegion && (*compact || *templateFile != "" || slices.Contains(formats, "cdk-attributes")) {
+		usagef("-multi-region is only supported by the built-in Typescript template")
+	}
+
+	if *subnetConsts && (*compact || *templateFile != "") {
+		usagef("-subnet-consts is only supported by the built-in Typescript template")
+	}
+
+	if *sidecar && !toFiles {
+		usagef("-sidecar requires -output-dir or -output-zip")
+	}
+
+	if *writeIndex && (!toFiles || !slices.Contains(formats, "typescript")) {
+		usagef("-write-index requires -output-dir or -output-zip, and -format typescript")
+	}
+
+	// Settings come from (in increasing precedence) the environment's config,
+	// the '-config' file, and flags.
+	var envConfig Config
+	if *configDir != "" {
+		envConfig, err = loadEnvironmentConfig(*configDir, *env)
+		check(err, "unable to load environment config")
+	}
+
+	var config Config
+	if *configPath != "" {
+		config, err = loadConfig(*configPath)
+		check(err, "unable to load config")
+	}
+
+	defaults := envConfig.Defaults.merge(config.Defaults).merge(AccountDefaults{
+		Stack:                  *stack,
+		BucketForArtifacts:     *bucketForArtifacts,
+		BucketForPrivateConfig: *bucketForPrivateConfig,
+		StreamNameTemplate:     *streamNameTemplate,
+	})
+
+	aliases := mergeMaps(envConfig.Aliases, config.Aliases)
+	overrides := mergeMaps(envConfig.Accounts, config.Accounts)
+
+	var streamNameTmpl *template.Template
+	if defaults.StreamNameTemplate != "" {
+		streamNameTmpl, err = template.New("stream-name").Option("missingkey=error").Parse(defaults.StreamNameTemplate)
+		check(err, "invalid stream name template")
+	}
+
+	if *normalizeNames && *filenameTemplate == defaultFilenameTemplate {
+		*filenameTemplate = normalizedFilenameTemplate
+	}
+
+	noVPCComment, err := template.New("no-vpc-comment").Option("missingkey=error").Parse(*noVPCCommentTemplate)
+	check(err, "invalid -no-vpc-comment-template")
+
+	filenameTmpl, err := parseFilenameTemplate(*filenameTemplate)
+	check(err, "invalid -filename-template")
+
+	out := OutputOptions{FilenameTemplate: filenameTmpl, NormalizeNames: *normalizeNames, GroupBy: *groupByFlag, Sidecar: *sidecar}
+
+	if *failOnBaselineChange && *baselinePath == "" {
+		usagef("-fail-on-baseline-change requires -baseline")
+	}
+
+	var baseline []AccountReport
+	if *baselinePath != "" {
+		baseline, err = loadBaseline(*baselinePath)
+		check(err, "unable to load baseline")
+	}
+
+	var customTemplate *template.Template
+	if *templateFile != "" {
+		customTemplate, err = loadTemplateFile(*templateFile)
+		check(err, "invalid -template-file")
+	}
+
+	opts := RenderOptions{
+		AnnotateSubnets: *annotateSubnets,
+		PrettyJSON:      *pretty,
+		OnlyPublic:      *onlyPublic,
+		OnlyPrivate:     *onlyPrivate,
+		SubnetOrder:     *subnetOrder,
+		ConstPrefix:     *constPrefix,
+		ConstSuffix:     *constSuffix,
+		Template:        customTemplate,
+		Compact:         *compact,
+		SubnetConsts:    *subnetConsts,
+		NoVPCComment:    noVPCComment,
+		Runbook:         *runbookURL,
+		Vars:            templateVars.vars,
+	}
+
+	// get accounts and vpcs
+	urlOverride := *prismURLOverride
+	for _, c := range []Config{config, envConfig} {
+		if urlOverride == "" {
+			urlOverride = c.PrismURL
+		}
+	}
+
+	baseURL, err := prismURL(*env, urlOverride)
+	check(err, "invalid prism environment")
+
+	if *header {
+		opts.Provenance = &Provenance{Version: toolVersion()}
+		if !*noTimestamp {
+			opts.Provenance.Generated = time.Now().UTC()
+		}
+	}
+
+	for _, name := range protectedHeaders {
+		if requestHeaders.header.Get(name) != "" && !*overrideHeaders {
+			usagef("-request-header would replace the %s header; set -override-protected-headers if that's intended", name)
+		}
+	}
+
+	if *apiVersion < 0 || *apiVersion > 2 {
+		usagef("unsupported -prism-api-version %d; supported versions are 1 and 2", *apiVersion)
+	}
+
+	var postHook *PostHook
+	if *postHookFlag != "" {
+		if *outputDir == "" {
+			usagef("-post-hook requires -output-dir")
+		}
+
+		postHook, err = parsePostHook(*postHookFlag)
+		check(err, "invalid -post-hook")
+	}
+
+	if !slices.Contains(sources, *sourceFlag) {
+		usagef("invalid -source %q; valid values are: %s", *sourceFlag, strings.Join(sources, ", "))
+	}
+
+	if *sourceFlag == "aws" && (*recordDir != "" || *replayDir != "" || *cacheDir != "") {
+		usagef("-record, -replay and -cache-dir only apply to -source prism")
+	}
+
+	if *recordDir != "" && *replayDir != "" {
+		usagef("-record and -replay can't both be set")
+	}
+
+	if *recordDir != "" {
+		err := os.MkdirAll(*recordDir, 0o755)
+		check(err, "unable to create -record directory")
+	}
+
+	if *maxResponseMB <= 0 {
+		usagef("-max-response-mb must be positive")
+	}
+
+	if *ratePerHost < 0 {
+		usagef("-rate-limit-per-host can't be negative")
+	}
+
+	// errgroup treats a limit of 0 as no goroutines at all, so the fetch
+	// would block forever.
+	if *concurrency < 1 {
+		usagef("-concurrency must be at least 1")
+	}
+
+	client, err := newHTTPClient(ClientOptions{Proxy: *proxy, Trace: *trace, RatePerHost: *ratePerHost})
+	check(err, "invalid -proxy")
+
+	// On SIGINT/SIGTERM, stop fetching and processing accounts but still write
+	// out whatever has been generated so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	var metrics *Metrics
+	if *metricsPath != "" {
+		metrics = &Metrics{}
+	}
+
+	if *retryJitter < 0 || *retryJitter > 1 {
+		usagef("-retry-jitter must be between 0 and 1")
+	}
+	if *maxRetryAfter < 0 {
+		usagef("-max-retry-after must not be negative")
+	}
+
+	seed := *retrySeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	for _, u := range []struct{ name, url string }{{"Prism URL", baseURL}, {"-accounts-url", *accountsURL}, {"-vpcs-url", *vpcsURL}} {
+		if u.url == "" {
+			continue
+		}
+		if err := validateURL(u.url); err != nil {
+			usagef("invalid %s: %v", u.name, err)
+		}
+	}
+
+	backoff := newBackoff(500*time.Millisecond, 10*time.Second, *retryJitter, seed)
+	backoff.MaxRetryAfter = *maxRetryAfter
+
+	// Everything downstream only needs a PrismLike, so doesn't care where
+	// the data comes from.
+	var source PrismLike = Prism{
+		BaseURL:          baseURL,
+		AccountsURL:      *accountsURL,
+		VPCsURL:          *vpcsURL,
+		Headers:          requestHeaders.header,
+		APIVersion:       *apiVersion,
+		RecordDir:        *recordDir,
+		ReplayDir:        *replayDir,
+		CacheDir:         *cacheDir,
+		MaxResponseBytes: *maxResponseMB << 20,
+		Client:           client,
+		LenientJSON:      *lenientJSON,
+		Metrics:          metrics,
+		Retries:          *retries,
+		Backoff:          backoff,
+	}
+	if *sourceFlag == "aws" {
+		source, err = newAWSPrism(ctx, *awsRegion, *awsAccountName)
+		check(err, "unable to use -source aws")
+	}
+
+	accounts, err := source.getAccounts(ctx)
+	exitIfInterrupted(ctx, RunSummary{})
+	check(err, "unable to fetch accounts")
+	if opts.Provenance != nil {
+		opts.Provenance.Source = describeSource(source, accounts)
+	}
+
+	accounts, duplicates := dedupeAccountNumbers(accounts)
+	duplicateNumbers := sortedKeys(duplicates)
+	for _, number := range duplicateNumbers {
+		names := []string{}
+		for _, account := range duplicates[number] {
+			names = append(names, account.AccountName)
+		}
+
+		msg := fmt.Sprintf("%d accounts share the number %s (%s); using %s", len(names), number, strings.Join(names, ", "), names[0])
+		if *strict {
+			fatal(errors.New(msg), number)
+		}
+		warnf("", "%s", msg)
+	}
+
+	request := AccountRequest{Names: splitList(*accountsFlag), OU: *ou, All: *all, Aliases: aliases, Strict: *strict}
+	if *accountsStdin {
+		names, err := readAccountNames(os.Stdin)
+		check(err, "unable to read accounts from stdin")
+		request.Names = union(request.Names, names)
+	}
+
+	// -account-name-regex adds to the other sources, unless it's in
+	// intersect mode (and there are some), in which case it narrows them
+	// down.
+	otherSources := *accountsFlag != "" || *ou != "" || *accountsStdin || *all
+	filter := AccountFilter{IncludeInactive: *includeInactive, Exclude: splitList(*excludeAccountsFlag)}
+	if nameRegex != nil && (*nameRegexMode == "union" || !otherSources) {
+		request.NameRegex = nameRegex
+	}
+	if nameRegex != nil && *nameRegexMode == "intersect" {
+		filter.NameRegex = nameRegex
+	}
+
+	// With -source aws there's only the one account to choose.
+	if !otherSources && nameRegex == nil {
+		request.Names = []string{"deploy-tools"}
+		if *sourceFlag == "aws" {
+			if len(accounts) == 0 {
+				fatal(errors.New("-source aws found no account for the current AWS credentials"), "")
+			}
+			request.Names = []string{accounts[0].AccountNumber}
+		}
+	}
+
+	selected, skipped, err := selectAccounts(accounts, request, filter)
+	var ambiguous *AmbiguousAccountError
+	if errors.As(err, &ambiguous) {
+		fatal(err, ambiguous.Name)
+	}
+	check(err, "unable to select accounts")
+
+	if *showSkipped {
+		printSkipped(stderr, skipped)
+	}
+
+	if *failOnEmpty && len(selected) == 0 {
+		fatal(errors.New("no accounts matched the filters (-fail-on-empty)"), "")
+	}
+
+	if *count {
+		fmt.Println(len(selected))
+		return
+	}
+
+	stopOnError := *failFast || !*continueOnError
+
+	var vpcs map[AccountID][]PrismVPC
+	fetchErrs := map[AccountID]error{}
+	if *perAccountVPCs {
+		vpcs, fetchErrs, err = getVPCsByAccount(ctx, source, selected, *concurrency, stopOnError)
+	} else {
+		vpcs, err = source.getVPCs(ctx)
+	}
+	exitIfInterrupted(ctx, RunSummary{})
+	check(err, "unable to fetch vpcs")
+
+	if *verbose || runLog != nil {
+		logVPCCounts(withAccountNames(prism.NewAccountLookup(accounts), vpcs))
+	}
+
+	infos, summary := buildAccountInfos(ctx, selected, vpcs, fetchErrs, BuildOptions{
+		Defaults:              defaults,
+		StreamNameTemplate:    streamNameTmpl,
+		Overrides:             overrides,
+		Selector:              selector,
+		SubnetRange:           subnetRange,
+		Lenient:               *lenientTopology,
+		IncludeVPCIDs:         splitList(*includeVPCIDs),
+		ExcludeVPCIDs:         splitList(*excludeVPCIDs),
+		IncludeShared:         *includeShared,
+		IncludeUnavailable:    *includeUnavailable,
+		SubnetTagKey:          subnetTagKey,
+		SubnetTagValue:        subnetTagValue,
+		ExcludeSubnetPrefixes: splitList(*subnetPrefixes),
+		ExcludeSubnetTagKey:   excludeSubnetTagKey,
+		ExcludeSubnetTagValue: excludeSubnetTagValue,
+		MultiRegion:           *multiRegion,
+		MaxAge:                *maxAge,
+		PublicPrefix:          *publicPrefix,
+		PrivatePrefix:         *privatePrefix,
+		Strict:                *strict,
+		StopOnError:           stopOnError,
+		Render:                opts,
+	})
+
+	if stopOnError && len(summary.Failures) > 0 {
+		summary.Failures = append(promotedWarnings(), summary.Failures...)
+		summary.print(stderr)
+		os.Exit(1)
+	}
+
+	// Validation and preview output are summaries rather than generated
+	// files, so are redacted too.
+	var summaryOut io.Writer = os.Stdout
+	if *redact {
+		summaryOut = redactingWriter{w: os.Stdout}
+	}
+
+	invalid := 0
+	if *validateOnly {
+		invalid = printValidation(summaryOut, infos)
+	} else if *preview {
+		printPreview(summaryOut, infos, opts)
+	} else if toFiles {
+		var confirm func(path string) bool
+		if *interactive && isTerminal(os.Stdin) {
+			confirm = newPrompter(os.Stdin, os.Stderr)
+		}
+
+		sink, err := newFileSink(*outputDir, *outputZip, *force, confirm)
+		check(err, "unable to create output")
+
+		recording := &recordingSink{FileSink: lineEndingSink{FileSink: sink, ending: *lineEnding}}
+		out.Sink = recording
+
+		err = writeAccountFiles(out, formats, infos, opts)
+		check(err, "unable to write output files")
+
+		if *writeIndex {
+			index, err := typescriptIndex(infos, out, opts)
+			check(err, "unable to render index")
+
+			err = out.Sink.WriteFile("index.ts", []byte(index))
+			check(err, "unable to write index")
+		}
+
+		err = out.Sink.Close()
+		check(err, "unable to finish writing output")
+
+		if postHook != nil {
+			for _, name := range recording.names {
+				file := filepath.Join(*outputDir, name)
+
+				output, err := postHook.run(file)
+				if err == nil {
+					continue
+				}
+
+				err = fmt.Errorf("post hook failed on %s: %w\n%s", file, err, strings.TrimSpace(output))
+				if *postHookFatal {
+					summary.fail(name, err)
+				} else {
+					warnf(name, "%v", err)
+				}
+			}
+		}
+	} else {
+		for _, format := range formats {
+			var buf bytes.Buffer
+			err := RenderAll(&buf, format, infos, opts)
+			check(err, "unable to render "+format+" output")
+
+			_, err = os.Stdout.Write(convertLineEndings(buf.Bytes(), *lineEnding))
+			check(err, "unable to write "+format+" output")
+		}
+	}
+
+	baselineChanges := 0
+	if *baselinePath != "" {
+		baselineChanges = printBaselineDiff(stderr, baseline, infos)
+	}
+
+	if metrics != nil {
+		metrics.AccountsProcessed = summary.Processed
+		for _, info := range infos {
+			if info.Selection.Found {
+				metrics.AccountsMatched++
+			} else {
+				metrics.AccountsNoVPC++
+			}
+		}
+
+		err := metrics.write(*metricsPath)
+		check(err, "unable to write metrics")
+	}
+
+	summary.Failures = append(promotedWarnings(), summary.Failures...)
+	summary.print(stderr)
+	if summary.Interrupted {
+		os.Exit(130)
+	}
+	if len(summary.Failures) > 0 || invalid > 0 || (*failOnBaselineChange && baselineChanges > 0) {
+		os.Exit(1)
+	}
+}
+
+// exitIfInterrupted prints the (partial) summary and exits with the
+// conventional status for SIGINT if the run has been cancelled by a signal.
+// Reaching the '-timeout' deadline isn't an interruption: it's reported as a
+// (timeout) error by whatever it cut short.
+func exitIfInterrupted(ctx context.Context, summary RunSummary) {
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+
+	summary.Interrupted = true
+	summary.print(stderr)
+	os.Exit(130)
 }
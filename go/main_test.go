@@ -0,0 +1,1027 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// Helpers for building test data. Go has no default arguments, so small
+// constructor functions like these keep test cases short.
+
+func testSubnet(id string, public bool, az string) PrismSubnet {
+	return PrismSubnet{SubnetID: id, IsPublic: &public, AvailabilityZone: az}
+}
+
+// testVPC returns a non-default VPC with the given number of public and
+// private subnets, spread across three AZs.
+func testVPC(id string, public int, private int) PrismVPC {
+	vpc := PrismVPC{VPCID: id, AccountID: "111"}
+	for i := 0; i < public; i++ {
+		vpc.Subnets = append(vpc.Subnets, testSubnet(fmt.Sprintf("%s-public-%d", id, i), true, "eu-west-1"+string(rune('a'+i%3))))
+	}
+	for i := 0; i < private; i++ {
+		vpc.Subnets = append(vpc.Subnets, testSubnet(fmt.Sprintf("%s-private-%d", id, i), false, "eu-west-1"+string(rune('a'+i%3))))
+	}
+
+	return vpc
+}
+
+// captureLog collects what's logged (e.g. warnings) during the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	return &buf
+}
+
+func TestFindPrimaryVPCExcludesUnknownSubnets(t *testing.T) {
+	logged := captureLog(t)
+
+	// Counting the unknown subnet as private would make this 3+4.
+	vpc := testVPC("vpc-a", 3, 3)
+	vpc.Subnets = append(vpc.Subnets, PrismSubnet{SubnetID: "subnet-unknown"})
+
+	if _, found, reason := findPrimaryVPC([]PrismVPC{vpc}, standardSubnetRange); !found {
+		t.Errorf("expected vpc-a to match, got %q", reason)
+	}
+	// Selectors call findPrimaryVPC repeatedly, so it leaves warning to
+	// buildAccountInfos.
+	if got := logged.String(); got != "" {
+		t.Errorf("expected no warnings, got %q", got)
+	}
+	short := testVPC("vpc-b", 3, 2)
+	short.Subnets = append(short.Subnets, PrismSubnet{SubnetID: "subnet-other"})
+	if got := unknownSubnets([]PrismVPC{vpc, short}); !slices.Equal(got, []string{"subnet-unknown (vpc-a)", "subnet-other (vpc-b)"}) {
+		t.Errorf("unknownSubnets = %v", got)
+	}
+
+	if got := len(prism.PublicSubnets(vpc.Subnets)) + len(prism.PrivateSubnets(vpc.Subnets)); got != 6 {
+		t.Errorf("got %d public and private subnets, want 6", got)
+	}
+}
+
+func TestFindPrimaryVPC(t *testing.T) {
+	defaultVPC := testVPC("vpc-default", 3, 3)
+	defaultVPC.IsDefault = true
+
+	atLeast := SubnetRange{MinPublic: 3, MaxPublic: -1, MinPrivate: 3, MaxPrivate: -1}
+	wide := SubnetRange{MinPublic: 2, MaxPublic: 4, MinPrivate: 2, MaxPrivate: 4}
+
+	tests := []struct {
+		name   string
+		vpcs   []PrismVPC
+		r      SubnetRange
+		want   string
+		reason string
+	}{
+		{"exact match", []PrismVPC{testVPC("vpc-a", 3, 3)}, standardSubnetRange, "vpc-a", ""},
+		{"no VPCs", nil, standardSubnetRange, "", "no VPCs found"},
+		{"only the default VPC", []PrismVPC{defaultVPC}, standardSubnetRange, "", "no non-default VPC with 3 public and 3 private subnets"},
+		{"too few subnets", []PrismVPC{testVPC("vpc-a", 2, 3)}, standardSubnetRange, "", "no non-default VPC with 3 public and 3 private subnets"},
+		{"too many subnets", []PrismVPC{testVPC("vpc-a", 4, 4)}, standardSubnetRange, "", "VPC vpc-a has more subnets than expected (4 public, 4 private)"},
+		{"no upper limit", []PrismVPC{testVPC("vpc-a", 4, 4)}, atLeast, "vpc-a", ""},
+		{"exact match preferred in order", []PrismVPC{testVPC("vpc-a", 4, 3), testVPC("vpc-b", 3, 3)}, standardSubnetRange, "vpc-b", ""},
+		{"within a range", []PrismVPC{testVPC("vpc-a", 2, 4)}, wide, "vpc-a", ""},
+		{"below a range", []PrismVPC{testVPC("vpc-a", 1, 3)}, wide, "", "no non-default VPC with 2-4 public and 2-4 private subnets"},
+		{"above a range", []PrismVPC{testVPC("vpc-a", 5, 3)}, wide, "", "VPC vpc-a has more subnets than expected (5 public, 3 private)"},
+		{"closest to ideal wins", []PrismVPC{testVPC("vpc-a", 4, 4), testVPC("vpc-b", 3, 4), testVPC("vpc-c", 2, 2)}, wide, "vpc-b", ""},
+		{"ideal wins over earlier", []PrismVPC{testVPC("vpc-a", 2, 4), testVPC("vpc-b", 3, 3)}, wide, "vpc-b", ""},
+		{"ties go to the first", []PrismVPC{testVPC("vpc-a", 4, 3), testVPC("vpc-b", 2, 3), testVPC("vpc-c", 3, 4)}, wide, "vpc-a", ""},
+		{"tie with the default VPC skipped", []PrismVPC{defaultVPC, testVPC("vpc-a", 3, 3)}, wide, "vpc-a", ""},
+		{"no upper limit prefers fewer extras", []PrismVPC{testVPC("vpc-a", 6, 6), testVPC("vpc-b", 4, 4)}, atLeast, "vpc-b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpc, found, reason := findPrimaryVPC(tt.vpcs, tt.r)
+			if found != (tt.want != "") || vpc.VPCID != tt.want || reason != tt.reason {
+				t.Errorf("got %q, %v, %q; want %q, %q", vpc.VPCID, found, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSubnetRangeString(t *testing.T) {
+	r := SubnetRange{MinPublic: 2, MaxPublic: 4, MinPrivate: 3, MaxPrivate: -1}
+	if got := r.String(); got != "2-4 public and at least 3 private subnets" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestInvalidSubnetRange(t *testing.T) {
+	out, err := runMain(t, "-min-public", "4", "-max-public", "2")
+	if err == nil || !strings.Contains(out, "invalid subnet range: 4-2 public and 3 private subnets") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+// runMain runs main with the given arguments in a child test process, so that
+// paths ending in log.Fatal or os.Exit can be tested. It returns the combined
+// output and the exit error, if any.
+func runMain(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	out, err := mainCommand(args...).CombinedOutput()
+
+	return string(out), err
+}
+
+// mainCommand returns the command runMain uses, for tests that need to
+// interact with the process while it runs.
+func mainCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestRunMainHelper$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "RUN_MAIN=1")
+
+	return cmd
+}
+
+// TestRunMainHelper isn't a real test: it's the child process started by
+// runMain.
+func TestRunMainHelper(t *testing.T) {
+	if os.Getenv("RUN_MAIN") == "" {
+		t.Skip("only runs as a child of runMain")
+	}
+
+	args := flag.Args()
+	flag.CommandLine = flag.NewFlagSet("vpc-examples", flag.ExitOnError)
+	os.Args = append([]string{"vpc-examples"}, args...)
+	main()
+	os.Exit(0)
+}
+
+func TestInvalidFormat(t *testing.T) {
+	out, err := runMain(t, "-format", "xyz")
+	if err == nil {
+		t.Fatal("expected a non-zero exit")
+	}
+	if !strings.Contains(out, `invalid format "xyz"; valid formats are: `+strings.Join(outputFormats, ", ")) {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestInvalidConstPrefix(t *testing.T) {
+	out, err := runMain(t, "-const-prefix", "2-")
+	if err == nil {
+		t.Fatal("expected a non-zero exit")
+	}
+	if !strings.Contains(out, "don't give a valid Typescript identifier") {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestListFormats(t *testing.T) {
+	out, err := runMain(t, "-list-formats")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if want := strings.Join(outputFormats, "\n") + "\n"; out != want {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestStreamName(t *testing.T) {
+	account := PrismAccount{AccountNumber: "123456789012", AccountName: "deploy-tools"}
+
+	if got, err := streamName(nil, account); err != nil || got != "TODO" {
+		t.Errorf("without a template got %q, %v; want TODO", got, err)
+	}
+
+	tmpl := template.Must(template.New("stream-name").Option("missingkey=error").Parse("{{.AccountName}}-{{.AccountNumber}}-logging"))
+	if got, err := streamName(tmpl, account); err != nil || got != "deploy-tools-123456789012-logging" {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	// Unknown fields fail when the template is executed.
+	tmpl = template.Must(template.New("stream-name").Parse("{{.Missing}}"))
+	if _, err := streamName(tmpl, account); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+// cannedPrismServer serves the given JSON for Prism's accounts and VPCs.
+func cannedPrismServer(t *testing.T, accounts string, vpcs string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sources/accounts":
+			fmt.Fprintf(w, `{"data": %s}`, accounts)
+		case "/vpcs":
+			fmt.Fprintf(w, `{"data": {"vpcs": %s}}`, vpcs)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestIncludeAndExcludeVPCs(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 3, 3), testVPC("vpc-b", 3, 3), testVPC("vpc-small", 1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	tests := []struct {
+		name             string
+		include, exclude string
+		want             string
+	}{
+		{"heuristic order", "", "", "vpc-a"},
+		{"include wins", "vpc-b", "", "vpc-b"},
+		{"unsuitable include is passed over", "vpc-small", "", "vpc-a"},
+		{"exclude removes", "", "vpc-a", "vpc-b"},
+		{"exclude beats include", "vpc-b", "vpc-b", "vpc-a"},
+		{"everything excluded", "", "vpc-a,vpc-b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-include-vpc-ids", tt.include, "-exclude-vpc-ids", tt.exclude)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+
+			want := `"status":"no-suitable-vpc"`
+			if tt.want != "" {
+				want = `"vpcId":"` + tt.want + `"`
+			}
+			if !strings.Contains(out, want) {
+				t.Errorf("expected %s in the output:\n%s", want, out)
+			}
+		})
+	}
+}
+
+func TestIncludeVPCs(t *testing.T) {
+	vpcs := []PrismVPC{testVPC("vpc-a", 3, 3), testVPC("vpc-b", 3, 3), testVPC("vpc-c", 3, 3)}
+
+	if got := includeVPCs(vpcs, []string{"vpc-c", "vpc-a", "vpc-missing"}); len(got) != 2 || got[0].VPCID != "vpc-a" || got[1].VPCID != "vpc-c" {
+		t.Errorf("includeVPCs got %v", got)
+	}
+	if got := excludeVPCs(vpcs, []string{"vpc-b"}); len(got) != 2 || got[0].VPCID != "vpc-a" || got[1].VPCID != "vpc-c" {
+		t.Errorf("excludeVPCs got %v", got)
+	}
+}
+
+func TestSharedVPCs(t *testing.T) {
+	shared := testVPC("vpc-transit", 3, 3)
+	shared.IsShared = true
+	vpcs, err := json.Marshal([]PrismVPC{shared, testVPC("vpc-small", 1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"excluded by default", nil, `"status":"no-suitable-vpc"`},
+		{"included with the flag", []string{"-include-shared-vpcs"}, `"vpcId":"vpc-transit"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-prism-url", server.URL, "-format", "ndjson"}, tt.args...)
+			out, err := runMain(t, args...)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("expected %s in the output:\n%s", tt.want, out)
+			}
+		})
+	}
+}
+
+func TestAllVPCsExcludedReason(t *testing.T) {
+	shared := testVPC("vpc-transit", 3, 3)
+	shared.IsShared = true
+	vpcs, err := json.Marshal([]PrismVPC{shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	out, err := runMain(t, "-prism-url", server.URL, "-format", "ndjson")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if want := "all 1 VPCs were excluded"; !strings.Contains(out, want) {
+		t.Errorf("expected %q in the output:\n%s", want, out)
+	}
+}
+
+func TestExcludeSharedVPCs(t *testing.T) {
+	shared := testVPC("vpc-transit", 3, 3)
+	shared.IsShared = true
+	vpcs := []PrismVPC{testVPC("vpc-a", 3, 3), shared}
+
+	if got := excludeSharedVPCs(vpcs); len(got) != 1 || got[0].VPCID != "vpc-a" {
+		t.Errorf("excludeSharedVPCs got %v", got)
+	}
+}
+
+func TestExcludeUnavailableVPCs(t *testing.T) {
+	pending := testVPC("vpc-pending", 3, 3)
+	pending.State = "pending"
+	available := testVPC("vpc-available", 3, 3)
+	available.State = "available"
+	unknown := testVPC("vpc-unknown", 3, 3)
+
+	got, excluded := excludeUnavailableVPCs([]PrismVPC{pending, available, unknown})
+	if len(got) != 2 || got[0].VPCID != "vpc-available" || got[1].VPCID != "vpc-unknown" {
+		t.Errorf("got %v, want the available VPC and the one with no state", got)
+	}
+	if len(excluded) != 1 || excluded[0].VPCID != "vpc-pending" {
+		t.Errorf("got excluded %v, want vpc-pending", excluded)
+	}
+}
+
+func TestUnavailableVPCs(t *testing.T) {
+	pending := testVPC("vpc-pending", 3, 3)
+	pending.State = "pending"
+	vpcs, err := json.Marshal([]PrismVPC{pending, testVPC("vpc-small", 1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"excluded by default", nil, "ignored VPCs that are not available: vpc-pending (pending)"},
+		{"included with the flag", []string{"-include-unavailable-vpcs"}, `"vpcId":"vpc-pending"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-prism-url", server.URL, "-format", "ndjson"}, tt.args...)
+			out, err := runMain(t, args...)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("expected %s in the output:\n%s", tt.want, out)
+			}
+		})
+	}
+}
+
+func TestLenientTopology(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-two-az", 2, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	out, err := runMain(t, "-prism-url", server.URL, "-format", "ndjson")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, `"status":"no-suitable-vpc"`) {
+		t.Errorf("expected no VPC without -lenient-topology:\n%s", out)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-lenient-topology")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	for _, want := range []string{
+		"warning: deploy-tools: accepted vpc-two-az with only 2 AZs",
+		`"vpcId":"vpc-two-az"`,
+		`"warning":"only 2 AZs"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in the output:\n%s", want, out)
+		}
+	}
+}
+
+func TestHeaderFlags(t *testing.T) {
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, "[]")
+
+	tests := []struct {
+		args      []string
+		header    bool
+		timestamp bool
+	}{
+		{nil, true, true},
+		{[]string{"-no-timestamp"}, true, false},
+		{[]string{"-header=false"}, false, false},
+	}
+
+	for _, tt := range tests {
+		out, err := runMain(t, append([]string{"-prism-url", server.URL}, tt.args...)...)
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+
+		if got := strings.Contains(out, "// Prism: "+server.URL+"\n"); got != tt.header {
+			t.Errorf("%v: got header %t, want %t:\n%s", tt.args, got, tt.header, out)
+		}
+		if got := strings.Contains(out, "// Generated at: "); got != tt.timestamp {
+			t.Errorf("%v: got timestamp %t, want %t:\n%s", tt.args, got, tt.timestamp, out)
+		}
+	}
+}
+
+func TestFilterSubnetsByTag(t *testing.T) {
+	// Three public and private subnets in the primary group, plus a
+	// service-specific one that breaks the standard topology.
+	vpc := testVPC("vpc-a", 3, 3)
+	for i := range vpc.Subnets {
+		vpc.Subnets[i].Tags = map[string]string{"cdk:subnet-group": "primary"}
+	}
+	extra := testSubnet("subnet-service", true, "eu-west-1a")
+	extra.Tags = map[string]string{"cdk:subnet-group": "service"}
+	vpc.Subnets = append(vpc.Subnets, extra)
+	vpc.Subnets = append(vpc.Subnets, testSubnet("subnet-untagged", false, "eu-west-1b"))
+
+	if _, found, _ := findPrimaryVPC([]PrismVPC{vpc}, standardSubnetRange); found {
+		t.Errorf("unfiltered VPC with %d subnets unexpectedly selected", len(vpc.Subnets))
+	}
+
+	filtered := filterSubnetsByTag([]PrismVPC{vpc}, "cdk:subnet-group", "primary")
+	if len(filtered) != 1 || len(filtered[0].Subnets) != 6 {
+		t.Fatalf("got %+v, want 6 subnets", filtered)
+	}
+	if _, found, reason := findPrimaryVPC(filtered, standardSubnetRange); !found {
+		t.Errorf("filtered VPC not selected: %s", reason)
+	}
+
+	// Filtering copies, rather than modifying the caller's VPCs.
+	if len(vpc.Subnets) != 8 {
+		t.Errorf("original VPC modified: %d subnets", len(vpc.Subnets))
+	}
+
+	if got := filterSubnetsByTag([]PrismVPC{vpc}, "cdk:subnet-group", "other"); len(got[0].Subnets) != 0 {
+		t.Errorf("got %d subnets for an unused tag value, want 0", len(got[0].Subnets))
+	}
+}
+
+func TestSubnetTagFlag(t *testing.T) {
+	vpc := testVPC("vpc-a", 3, 3)
+	for i := range vpc.Subnets {
+		vpc.Subnets[i].Tags = map[string]string{"group": "primary"}
+	}
+	vpc.Subnets = append(vpc.Subnets, testSubnet("subnet-service", true, "eu-west-1a"))
+	vpcs, err := json.Marshal([]PrismVPC{vpc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	out, err := runMain(t, "-prism-url", server.URL, "-format", "json")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if strings.Contains(out, `"status": "matched"`) {
+		t.Errorf("expected no selection without -subnet-tag:\n%s", out)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-format", "json", "-subnet-tag", "group=primary")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, `"status": "matched"`) || strings.Contains(out, "subnet-service") {
+		t.Errorf("expected vpc-a selected without subnet-service:\n%s", out)
+	}
+
+	out, err = runMain(t, "-subnet-tag", "primary")
+	if err == nil || !strings.Contains(out, "expected key=value") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestExcludeSubnets(t *testing.T) {
+	legacy := func(id string, public bool) PrismSubnet {
+		subnet := testSubnet(id, public, "eu-west-1a")
+		subnet.Tags = map[string]string{"Name": "legacy-" + id, "lifecycle": "legacy"}
+		return subnet
+	}
+
+	// A standard VPC plus a legacy subnet only matches once it's excluded.
+	extra := testVPC("vpc-a", 3, 3)
+	extra.Subnets = append(extra.Subnets, legacy("subnet-old", true))
+
+	// One that relies on a legacy subnet to reach the minimum stops matching.
+	short := testVPC("vpc-b", 2, 3)
+	short.Subnets = append(short.Subnets, legacy("subnet-old", true))
+
+	tests := []struct {
+		name     string
+		prefixes []string
+		tagKey   string
+		tagValue string
+	}{
+		{"by ID prefix", []string{"subnet-old"}, "", ""},
+		{"by Name prefix", []string{"other-", "legacy-"}, "", ""},
+		{"by tag", nil, "lifecycle", "legacy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, found, _ := findPrimaryVPC([]PrismVPC{extra}, standardSubnetRange); found {
+				t.Errorf("unfiltered vpc-a unexpectedly selected")
+			}
+			filtered := excludeSubnets([]PrismVPC{extra}, tt.prefixes, tt.tagKey, tt.tagValue)
+			if len(filtered[0].Subnets) != 6 {
+				t.Fatalf("got %d subnets, want 6", len(filtered[0].Subnets))
+			}
+			if _, found, reason := findPrimaryVPC(filtered, standardSubnetRange); !found {
+				t.Errorf("filtered vpc-a not selected: %s", reason)
+			}
+
+			if _, found, reason := findPrimaryVPC([]PrismVPC{short}, standardSubnetRange); !found {
+				t.Errorf("unfiltered vpc-b not selected: %s", reason)
+			}
+			filtered = excludeSubnets([]PrismVPC{short}, tt.prefixes, tt.tagKey, tt.tagValue)
+			if _, found, _ := findPrimaryVPC(filtered, standardSubnetRange); found {
+				t.Errorf("filtered vpc-b unexpectedly selected")
+			}
+		})
+	}
+
+	// Excluding copies, rather than modifying the caller's VPCs.
+	if len(extra.Subnets) != 7 {
+		t.Errorf("original VPC modified: %d subnets", len(extra.Subnets))
+	}
+
+	// Nothing matching the filters is left alone.
+	if got := excludeSubnets([]PrismVPC{extra}, []string{"nope-"}, "lifecycle", "current"); len(got[0].Subnets) != 7 {
+		t.Errorf("got %d subnets, want 7", len(got[0].Subnets))
+	}
+}
+
+func TestExcludeSubnetFlags(t *testing.T) {
+	vpc := testVPC("vpc-a", 3, 3)
+	old := testSubnet("subnet-old", true, "eu-west-1a")
+	old.Tags = map[string]string{"lifecycle": "legacy"}
+	vpc.Subnets = append(vpc.Subnets, old)
+	vpcs, err := json.Marshal([]PrismVPC{vpc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	for _, args := range [][]string{
+		{"-subnet-id-prefix-filter", "subnet-old"},
+		{"-exclude-subnet-tag", "lifecycle=legacy"},
+	} {
+		out, err := runMain(t, append([]string{"-prism-url", server.URL, "-format", "json"}, args...)...)
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !strings.Contains(out, `"status": "matched"`) || strings.Contains(out, "subnet-old") {
+			t.Errorf("%v: expected vpc-a selected without subnet-old:\n%s", args, out)
+		}
+	}
+
+	out, err := runMain(t, "-exclude-subnet-tag", "legacy")
+	if err == nil || !strings.Contains(out, "invalid -exclude-subnet-tag") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestSubnetPrefixProblems(t *testing.T) {
+	withCIDRs := func(public []string, private []string) PrismVPC {
+		vpc := testVPC("vpc-a", len(public), len(private))
+		for i, cidr := range append(public, private...) {
+			vpc.Subnets[i].CIDR = cidr
+		}
+		return vpc
+	}
+
+	tests := []struct {
+		name        string
+		vpc         PrismVPC
+		public      int
+		private     int
+		wantProblem []string
+	}{
+		{"conforming", withCIDRs([]string{"10.0.0.0/20", "10.0.16.0/20"}, []string{"10.1.0.0/24", "10.1.1.0/24"}), 20, 24, []string{}},
+		{"deviating", withCIDRs([]string{"10.0.0.0/20", "10.0.16.0/22"}, []string{"10.1.0.0/24", "10.1.1.0/20"}), 20, 24, []string{
+			"public subnet vpc-a-public-1 is 10.0.16.0/22, expected a /20",
+			"private subnet vpc-a-private-1 is 10.1.1.0/20, expected a /24",
+		}},
+		{"only public checked", withCIDRs([]string{"10.0.0.0/20"}, []string{"10.1.1.0/20"}), 20, 0, []string{}},
+		{"only private checked", withCIDRs([]string{"10.0.0.0/24"}, []string{"10.1.1.0/20"}), 0, 24, []string{
+			"private subnet vpc-a-private-0 is 10.1.1.0/20, expected a /24",
+		}},
+		{"missing CIDRs skipped", testVPC("vpc-a", 3, 3), 20, 24, []string{}},
+		{"invalid CIDR", withCIDRs([]string{"10.0.0.0"}, nil), 20, 24, []string{
+			`public subnet vpc-a-public-0 has an invalid CIDR "10.0.0.0"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := subnetPrefixProblems(tt.vpc, tt.public, tt.private)
+			if !slices.Equal(got, tt.wantProblem) {
+				t.Errorf("got %q, want %q", got, tt.wantProblem)
+			}
+		})
+	}
+}
+
+func TestExpectPrefixFlags(t *testing.T) {
+	vpc := testVPC("vpc-a", 3, 3)
+	for i := range vpc.Subnets {
+		vpc.Subnets[i].CIDR = fmt.Sprintf("10.0.%d.0/24", i)
+	}
+	vpcs, err := json.Marshal([]PrismVPC{vpc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+	want := "public subnet vpc-a-public-0 is 10.0.0.0/24, expected a /20"
+
+	out, err := runMain(t, "-prism-url", server.URL, "-expect-public-prefix", "24", "-expect-private-prefix", "24")
+	if err != nil || strings.Contains(out, "warning") {
+		t.Errorf("expected conforming subnets to pass quietly, got %v: %s", err, out)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-expect-public-prefix", "20", "-expect-private-prefix", "24")
+	if err != nil || !strings.Contains(out, want) {
+		t.Errorf("expected a warning %q, got %v: %s", want, err, out)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-expect-public-prefix", "20", "-strict")
+	if err == nil || !strings.Contains(out, want) {
+		t.Errorf("expected -strict to fail with %q, got %v: %s", want, err, out)
+	}
+
+	out, err = runMain(t, "-expect-private-prefix", "33")
+	if err == nil || !strings.Contains(out, "-expect-private-prefix must be between 0 and 32") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestVPCRegion(t *testing.T) {
+	tests := []struct {
+		vpc  PrismVPC
+		want string
+	}{
+		{PrismVPC{Region: "us-east-1", Subnets: []PrismSubnet{testSubnet("a", true, "eu-west-1a")}}, "us-east-1"},
+		{testVPC("vpc-a", 3, 3), "eu-west-1"},
+		{PrismVPC{Subnets: []PrismSubnet{testSubnet("a", true, ""), testSubnet("b", true, "ap-southeast-2c")}}, "ap-southeast-2"},
+		{PrismVPC{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := vpcRegion(tt.vpc); got != tt.want {
+			t.Errorf("vpcRegion(%+v) = %q, want %q", tt.vpc, got, tt.want)
+		}
+	}
+}
+
+func TestMultiRegion(t *testing.T) {
+	us := testVPC("vpc-us", 3, 3)
+	us.Region = "us-east-1"
+	small := testVPC("vpc-ap", 1, 1)
+	small.Region = "ap-southeast-2"
+	vpcs, err := json.Marshal([]PrismVPC{us, testVPC("vpc-eu", 3, 3), small})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	out, err := runMain(t, "-prism-url", server.URL, "-header=false", "-multi-region")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	// Regions are sorted, and those without a suitable VPC left out.
+	eu, us1 := strings.Index(out, "'eu-west-1': {"), strings.Index(out, "'us-east-1': {")
+	if eu == -1 || us1 == -1 || eu > us1 || strings.Contains(out, "ap-southeast-2") {
+		t.Errorf("unexpected regions:\n%s", out)
+	}
+
+	// Without the flag, output stays flat.
+	out, err = runMain(t, "-prism-url", server.URL, "-header=false")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if strings.Contains(out, "'eu-west-1': {") {
+		t.Errorf("got regions without -multi-region:\n%s", out)
+	}
+
+	out, err = runMain(t, "-multi-region", "-compact")
+	if err == nil || !strings.Contains(out, "-multi-region is only supported by the built-in Typescript template") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestValidateOnly(t *testing.T) {
+	small := testVPC("vpc-b", 1, 1)
+	small.AccountID = "222"
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 3, 3), small})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("all pass", func(t *testing.T) {
+		server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+		out, err := runMain(t, "-prism-url", server.URL, "-validate-only")
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !strings.Contains(out, "PASS deploy-tools: vpc-a") || strings.Contains(out, "export const") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+	})
+
+	t.Run("mixed", func(t *testing.T) {
+		server := cannedPrismServer(t, `[
+			{"accountNumber": "111", "accountName": "deploy-tools"},
+			{"accountNumber": "222", "accountName": "frontend"}
+		]`, string(vpcs))
+
+		out, err := runMain(t, "-prism-url", server.URL, "-all", "-validate-only")
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			t.Fatalf("got %v, want exit status 1: %s", err, out)
+		}
+		if !strings.Contains(out, "PASS deploy-tools: vpc-a") || !strings.Contains(out, "FAIL frontend: ") {
+			t.Errorf("unexpected output:\n%s", out)
+		}
+	})
+
+	out, err := runMain(t, "-validate-only", "-output-dir", t.TempDir())
+	if err == nil || !strings.Contains(out, "-validate-only and -preview don't write output") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 3, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	out, err := runMain(t, "-prism-url", server.URL, "-preview")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if !strings.Contains(out, "deploy-tools (111): vpc-a\n  public:   vpc-a-public-0") || strings.Contains(out, "export const") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	out, err = runMain(t, "-preview", "-validate-only")
+	if err == nil || !strings.Contains(out, "-validate-only and -preview can't both be set") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+// concurrencyRecordingPrism is a PrismLike whose per-account requests take a
+// little while, recording the most that were ever in flight at once.
+type concurrencyRecordingPrism struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	// How many requests were started.
+	calls int
+	// Accounts whose request fails.
+	failing map[AccountID]bool
+}
+
+func (p *concurrencyRecordingPrism) getAccounts(ctx context.Context) ([]PrismAccount, error) {
+	return nil, nil
+}
+
+func (p *concurrencyRecordingPrism) getVPCs(ctx context.Context) (map[AccountID][]PrismVPC, error) {
+	return nil, nil
+}
+
+func (p *concurrencyRecordingPrism) getVPCsForAccount(ctx context.Context, id AccountID) ([]PrismVPC, error) {
+	p.mu.Lock()
+	p.calls++
+	p.inFlight++
+	if p.inFlight > p.max {
+		p.max = p.inFlight
+	}
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.inFlight--
+		p.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(10 * time.Millisecond):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if p.failing[id] {
+		return nil, fmt.Errorf("no VPCs for %s", id)
+	}
+
+	return []PrismVPC{{VPCID: "vpc-" + string(id), AccountID: string(id)}}, nil
+}
+
+func TestGetVPCsByAccountRespectsLimit(t *testing.T) {
+	for _, limit := range []int{1, 3, 8} {
+		prism := &concurrencyRecordingPrism{}
+		vpcs, errs, err := getVPCsByAccount(context.Background(), prism, testAccounts(20), limit, false)
+		if err != nil || len(errs) > 0 {
+			t.Fatalf("limit %d: unexpected errors %v, %v", limit, err, errs)
+		}
+
+		if len(vpcs) != 20 {
+			t.Errorf("limit %d: got VPCs for %d accounts, want 20", limit, len(vpcs))
+		}
+		if prism.max > limit {
+			t.Errorf("limit %d: %d requests were in flight at once", limit, prism.max)
+		}
+	}
+}
+
+func TestGetVPCsByAccountErrors(t *testing.T) {
+	accounts := testAccounts(20)
+
+	t.Run("carry on", func(t *testing.T) {
+		prism := &concurrencyRecordingPrism{failing: map[AccountID]bool{"105": true}}
+		vpcs, errs, err := getVPCsByAccount(context.Background(), prism, accounts, 4, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(vpcs) != 19 || errs["105"] == nil || len(errs) != 1 {
+			t.Errorf("got %d accounts with VPCs and errors %v; want 19 and just 105", len(vpcs), errs)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		prism := &concurrencyRecordingPrism{failing: map[AccountID]bool{"100": true}}
+		_, _, err := getVPCsByAccount(context.Background(), prism, accounts, 1, true)
+
+		// The requests cancelled by the failure return context.Canceled, but
+		// errgroup keeps the error that caused it.
+		if err == nil || err.Error() != "no VPCs for 100" {
+			t.Errorf("got %v, want the first account's error", err)
+		}
+
+		// With one at a time, the rest were waiting for a slot when the
+		// first failed, so none of them should have been requested.
+		if prism.calls != 1 {
+			t.Errorf("got %d requests, want just the failing one", prism.calls)
+		}
+	})
+}
+
+func TestConcurrencyFlag(t *testing.T) {
+	for _, value := range []string{"0", "-1"} {
+		out, err := runMain(t, "-per-account-vpcs", "-concurrency", value)
+		if err == nil || !strings.Contains(out, "-concurrency must be at least 1") {
+			t.Errorf("-concurrency %s: got %v: %s", value, err, out)
+		}
+	}
+}
+
+func TestStaleVPCs(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	fresh := testVPC("vpc-fresh", 3, 3)
+	fresh.LastUpdated = now.Add(-time.Hour)
+	stale := testVPC("vpc-stale", 3, 3)
+	stale.LastUpdated = now.Add(-48 * time.Hour)
+	edge := testVPC("vpc-edge", 3, 3)
+	edge.LastUpdated = now.Add(-24 * time.Hour)
+	unknown := testVPC("vpc-unknown", 3, 3)
+
+	got := staleVPCs([]PrismVPC{fresh, stale, edge, unknown}, 24*time.Hour, now)
+	if len(got) != 1 || got[0].VPCID != "vpc-stale" {
+		t.Errorf("got %v, want just vpc-stale", got)
+	}
+}
+
+func TestUnroutedPublicSubnets(t *testing.T) {
+	routed, unrouted := true, false
+
+	// Private subnets don't need a route, and subnets without routing data
+	// aren't flagged.
+	private := testSubnet("subnet-private", false, "")
+	private.HasInternetGatewayRoute = &unrouted
+	withRoute := testSubnet("subnet-routed", true, "")
+	withRoute.HasInternetGatewayRoute = &routed
+	withoutRoute := testSubnet("subnet-unrouted", true, "")
+	withoutRoute.HasInternetGatewayRoute = &unrouted
+	vpc := PrismVPC{VPCID: "vpc-a", Subnets: []PrismSubnet{private, withRoute, withoutRoute, testSubnet("subnet-unknown", true, "")}}
+
+	got := subnetIDs(unroutedPublicSubnets(vpc.Subnets))
+	if !slices.Equal(got, []string{"subnet-unrouted"}) {
+		t.Errorf("got %v, want just subnet-unrouted", got)
+	}
+
+	// The report lists them so the consumer can see them.
+	info := AccountInfo{Selection: VPCSelection{VPC: vpc, Found: true}}
+	if report := info.asReport(); !slices.Equal(report.UnroutedPublicSubnets, got) {
+		t.Errorf("report lists %v", report.UnroutedPublicSubnets)
+	}
+}
+
+func TestOnlyPublicAndOnlyPrivateConflict(t *testing.T) {
+	out, err := runMain(t, "-only-public", "-only-private")
+	if err == nil || !strings.Contains(out, "-only-public and -only-private can't both be set") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestOrderSubnets(t *testing.T) {
+	subnets := []PrismSubnet{
+		testSubnet("subnet-c", true, "eu-west-1a"),
+		testSubnet("subnet-a", true, "eu-west-1b"),
+		testSubnet("subnet-d", true, "eu-west-1a"),
+		testSubnet("subnet-b", true, "eu-west-1a"),
+	}
+
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"id", []string{"subnet-a", "subnet-b", "subnet-c", "subnet-d"}},
+		// Within an AZ, subnets fall back to ID order.
+		{"az", []string{"subnet-b", "subnet-c", "subnet-d", "subnet-a"}},
+		{"prism", []string{"subnet-c", "subnet-a", "subnet-d", "subnet-b"}},
+	}
+
+	for _, tt := range tests {
+		if got := subnetIDs(orderSubnets(subnets, tt.order)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.order, got, tt.want)
+		}
+	}
+
+	// The input is left as it was.
+	if subnets[0].SubnetID != "subnet-c" {
+		t.Error("orderSubnets modified its input")
+	}
+}
+
+func TestInvalidSubnetOrder(t *testing.T) {
+	out, err := runMain(t, "-subnet-order", "random")
+	if err == nil || !strings.Contains(out, `invalid -subnet-order "random"; valid values are: az, id, prism`) {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestSortedKeys(t *testing.T) {
+	if got := sortedKeys(map[string]int{"b": 2, "c": 3, "a": 1}); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("got %v, want [a b c]", got)
+	}
+
+	// Named string types such as AccountID work too.
+	if got := sortedKeys(map[AccountID]bool{"222": true, "111": false}); !slices.Equal(got, []AccountID{"111", "222"}) {
+		t.Errorf("got %v, want [111 222]", got)
+	}
+
+	// An empty (or nil) map gives an empty slice rather than nil.
+	if got := sortedKeys(map[string]int(nil)); got == nil || len(got) != 0 {
+		t.Errorf("got %#v, want an empty slice", got)
+	}
+}
+
+func TestTimeoutExit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	out, err := runMain(t, "-prism-url", server.URL, "-timeout", "100ms", "-retries", "0", "-error-format", "json")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("got %v, want exit status 1: %s", err, out)
+	}
+	if strings.Contains(out, "interrupted") || !strings.Contains(out, `"code":"timeout"`) {
+		t.Errorf("expected a timeout error rather than an interruption:\n%s", out)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics collects counts for '-metrics', written in the Prometheus text
+// format for the node_exporter textfile collector. A nil *Metrics is valid and
+// records nothing, so there is no overhead when metrics are disabled.
+type Metrics struct {
+	mu sync.Mutex
+
+	AccountsProcessed int
+	AccountsMatched   int
+	AccountsNoVPC     int
+
+	requestCount    int
+	requestDuration time.Duration
+	retries         int
+}
+
+func (m *Metrics) observeRequest(d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requestCount++
+	m.requestDuration += d
+}
+
+func (m *Metrics) observeRetry() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retries++
+}
+
+func (m *Metrics) format() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	gauge := func(name string, help string, value int) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+	}
+
+	gauge("accounts_processed", "Accounts processed in the last run.", m.AccountsProcessed)
+	gauge("accounts_matched", "Accounts with a suitable primary VPC in the last run.", m.AccountsMatched)
+	gauge("accounts_no_vpc", "Accounts without a suitable primary VPC in the last run.", m.AccountsNoVPC)
+
+	fmt.Fprintf(&b, "# HELP prism_request_duration_seconds Duration of Prism requests in the last run.\n")
+	fmt.Fprintf(&b, "# TYPE prism_request_duration_seconds summary\n")
+	fmt.Fprintf(&b, "prism_request_duration_seconds_sum %g\n", m.requestDuration.Seconds())
+	fmt.Fprintf(&b, "prism_request_duration_seconds_count %d\n", m.requestCount)
+
+	fmt.Fprintf(&b, "# HELP prism_request_retries_total Prism requests retried in the last run.\n")
+	fmt.Fprintf(&b, "# TYPE prism_request_retries_total counter\n")
+	fmt.Fprintf(&b, "prism_request_retries_total %d\n", m.retries)
+
+	return b.String()
+}
+
+// write writes the metrics file via a temporary file and rename, so that
+// the textfile collector never reads a partially written file.
+func (m *Metrics) write(path string) error {
+	return writeFileAtomic(path, []byte(m.format()))
+}
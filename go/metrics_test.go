@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseTextfile reads the samples from a Prometheus text format file,
+// checking each one has HELP and TYPE lines.
+func parseTextfile(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	samples := map[string]string{}
+	described := map[string]int{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) >= 3 && fields[0] == "#" && (fields[1] == "HELP" || fields[1] == "TYPE"):
+			described[fields[2]]++
+		case len(fields) == 2:
+			samples[fields[0]] = fields[1]
+		default:
+			t.Errorf("unexpected line %q", scanner.Text())
+		}
+	}
+
+	for name := range samples {
+		family := name
+		if strings.HasSuffix(name, "_sum") || strings.HasSuffix(name, "_count") {
+			family = name[:strings.LastIndex(name, "_")]
+		}
+		if described[family] != 2 {
+			t.Errorf("%s is missing its HELP or TYPE line", name)
+		}
+	}
+
+	return samples
+}
+
+func TestMetricsWrite(t *testing.T) {
+	metrics := &Metrics{AccountsProcessed: 3, AccountsMatched: 2, AccountsNoVPC: 1}
+	metrics.observeRequest(1500 * time.Millisecond)
+	metrics.observeRequest(500 * time.Millisecond)
+	metrics.observeRetry()
+
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := metrics.write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"accounts_processed":                   "3",
+		"accounts_matched":                     "2",
+		"accounts_no_vpc":                      "1",
+		"prism_request_duration_seconds_sum":   "2",
+		"prism_request_duration_seconds_count": "2",
+		"prism_request_retries_total":          "1",
+	}
+	got := parseTextfile(t, path)
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %q, want %q", name, got[name], value)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got samples %v", got)
+	}
+
+	// No temporary files are left behind.
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("got %d files, want just the metrics", len(entries))
+	}
+}
+
+func TestNilMetricsRecordsNothing(t *testing.T) {
+	var metrics *Metrics
+
+	// This would panic if the nil check were missing.
+	metrics.observeRequest(time.Second)
+	metrics.observeRetry()
+}
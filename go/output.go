@@ -0,0 +1,405 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// Options controlling how per-account files are written to '-output-dir' or
+// '-output-zip'.
+type OutputOptions struct {
+	Sink             FileSink
+	FilenameTemplate *template.Template
+	// Whether to make account names safe for use in filenames (see
+	// normalizeName) before they reach the filename template.
+	NormalizeNames bool
+	// If "stack", files are nested in a directory per stack; see
+	// stackDirectory.
+	GroupBy string
+	// Also write a '.meta.json' file per account; see AccountMetadata.
+	Sidecar bool
+}
+
+// The supported values for '-group-by'.
+var groupings = []string{"none", "stack"}
+
+// stackDirectory is the directory for the account's files with '-group-by
+// stack'. Accounts without a configured stack go in 'unknown'.
+func (info AccountInfo) stackDirectory(normalize bool) string {
+	stack := info.Stack
+	if stack == "" || stack == placeholder {
+		return "unknown"
+	}
+
+	if normalize {
+		return normalizeName(stack)
+	}
+
+	return stack
+}
+
+// The supported values for '-line-ending'.
+var lineEndings = []string{"lf", "crlf"}
+
+// convertLineEndings normalises content to the given line ending. Templates
+// (especially custom ones edited on Windows) may already contain a mix, so
+// CRLFs are first turned into LFs.
+func convertLineEndings(content []byte, ending string) []byte {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	if ending == "crlf" {
+		content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+	}
+
+	return content
+}
+
+// lineEndingSink converts the line endings of each file written to it.
+type lineEndingSink struct {
+	FileSink
+	ending string
+}
+
+func (s lineEndingSink) WriteFile(name string, content []byte) error {
+	return s.FileSink.WriteFile(name, convertLineEndings(content, s.ending))
+}
+
+// FileSink is somewhere to write generated files: a directory or a zip
+// archive. WriteFile returns errSkipped if it deliberately didn't write the
+// file.
+type FileSink interface {
+	WriteFile(name string, content []byte) error
+	Close() error
+}
+
+// newFileSink returns a sink for either the output directory or zip file,
+// whichever is set. If 'confirm' is set, it's asked whether to overwrite
+// existing files in the output directory.
+func newFileSink(dir string, zipPath string, force bool, confirm func(path string) bool) (FileSink, error) {
+	if zipPath != "" {
+		return newZipSink(zipPath, force)
+	}
+
+	return dirSink{dir: dir, force: force, confirm: confirm}, nil
+}
+
+// errSkipped is returned by dirSink when the user chooses not to overwrite an
+// existing file. Like io.EOF, it's a sentinel value to compare against rather
+// than a failure; recordingSink turns it back into success.
+var errSkipped = errors.New("file skipped")
+
+type dirSink struct {
+	dir     string
+	force   bool
+	confirm func(path string) bool
+}
+
+func (s dirSink) WriteFile(name string, content []byte) error {
+	if s.force || s.confirm == nil {
+		return writeFile(s.dir, name, content, s.force)
+	}
+
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return writeFile(s.dir, name, content, false)
+	}
+
+	if !s.confirm(path) {
+		log.Printf("skipping %s", path)
+		return errSkipped
+	}
+
+	return writeFile(s.dir, name, content, true)
+}
+
+// newPrompter returns a function that asks on 'out' whether to overwrite a
+// file, reading a y/N answer from 'in'. Anything other than 'y' or 'yes'
+// (including end of input) means no.
+func newPrompter(in io.Reader, out io.Writer) func(path string) bool {
+	reader := bufio.NewReader(in)
+
+	return func(path string) bool {
+		fmt.Fprintf(out, "%s already exists; overwrite? [y/N] ", path)
+
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// isTerminal reports whether f is an interactive terminal rather than a pipe
+// or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (s dirSink) Close() error {
+	return nil
+}
+
+type zipSink struct {
+	f  *os.File
+	zw *zip.Writer
+}
+
+func newZipSink(path string, force bool) (*zipSink, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+
+	f, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("%s already exists (use -force to overwrite)", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipSink{f: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (s *zipSink) WriteFile(name string, content []byte) error {
+	// Zip entries always use forward slashes.
+	w, err := s.zw.Create(filepath.ToSlash(name))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(content)
+	return err
+}
+
+func (s *zipSink) Close() error {
+	err := s.zw.Close()
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+const defaultFilenameTemplate = "{{camel .AccountName}}.{{.Ext}}"
+
+// Used instead of the default with '-normalize-names', as camel-casing would
+// undo the lowercasing.
+const normalizedFilenameTemplate = "{{.AccountName}}.{{.Ext}}"
+
+// The data available to '-filename-template'.
+type filenameData struct {
+	AccountName   string
+	AccountNumber string
+	Format        string
+	Ext           string
+}
+
+func parseFilenameTemplate(s string) (*template.Template, error) {
+	funcs := template.FuncMap{"camel": camelCase}
+	return template.New("filename").Funcs(funcs).Option("missingkey=error").Parse(s)
+}
+
+// The file (relative to the output directory) the account is written to for
+// the given format.
+func (info AccountInfo) filename(out OutputOptions, format string) (string, error) {
+	accountName := info.AccountName
+	if out.NormalizeNames {
+		accountName = normalizeName(info.AccountName)
+		if accountName == "" {
+			accountName = info.AccountNumber
+		}
+	}
+
+	data := filenameData{
+		AccountName:   accountName,
+		AccountNumber: info.AccountNumber,
+		Format:        format,
+		Ext:           formatExtensions[format],
+	}
+
+	var buf strings.Builder
+	err := out.FilenameTemplate.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("unable to render filename for %s: %w", info.AccountName, err)
+	}
+
+	name := buf.String()
+	if out.GroupBy == "stack" {
+		name = filepath.Join(info.stackDirectory(out.NormalizeNames), name)
+	}
+
+	err = checkRelativePath(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid filename for %s: %w", info.AccountName, err)
+	}
+
+	return name, nil
+}
+
+// normalizeName makes an account name safe to use in a filename: it's
+// lowercased and each run of characters other than letters, digits and
+// underscores becomes a single '-'. Dots and slashes are replaced too, so the
+// result can never be '..' or contain a path separator.
+func normalizeName(name string) string {
+	var b strings.Builder
+	pendingDash := false
+
+	for _, r := range strings.ToLower(name) {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingDash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingDash = false
+			b.WriteRune(r)
+			continue
+		}
+
+		pendingDash = true
+	}
+
+	return b.String()
+}
+
+// checkRelativePath ensures that 'name' stays within the output directory.
+func checkRelativePath(name string) error {
+	if name == "" {
+		return errors.New("filename is empty")
+	}
+
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return fmt.Errorf("%q is not a relative path", name)
+	}
+
+	clean := filepath.Clean(name)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%q is outside the output directory", name)
+	}
+
+	return nil
+}
+
+// writeFile writes content to dir/name, creating directories if needed.
+// Existing files are only replaced if 'force' is set.
+func writeFile(dir string, name string, content []byte, force bool) error {
+	path := filepath.Join(dir, name)
+
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	// There's a small window between this check and the rename in which
+	// another process could create the file, but that's fine for our use.
+	if !force {
+		if _, err := os.Lstat(path); err == nil {
+			return fmt.Errorf("%s already exists (use -force to overwrite)", path)
+		}
+	}
+
+	return writeFileAtomic(path, content)
+}
+
+// writeFileAtomic writes content to a temporary file alongside 'path' and then
+// renames it into place, so that a crash part way through can't leave a
+// truncated file behind.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// After a successful rename there's nothing to remove, so this is a no-op.
+	defer os.Remove(tmp.Name())
+
+	// CreateTemp uses 0600, but the file may be read by other users.
+	err = tmp.Chmod(0o644)
+	if err == nil {
+		_, err = tmp.Write(content)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeAccountFiles writes a file per account for each format.
+func writeAccountFiles(out OutputOptions, formats []string, infos []AccountInfo, opts RenderOptions) error {
+	for _, info := range infos {
+		for _, format := range formats {
+			content, err := renderAccount(format, info, opts)
+			if err != nil {
+				return err
+			}
+
+			name, err := info.filename(out, format)
+			if err != nil {
+				return err
+			}
+
+			err = out.Sink.WriteFile(name, content)
+			if err != nil {
+				return err
+			}
+		}
+
+		if out.Sidecar {
+			err := writeSidecar(out, info)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeSidecar writes the account's metadata next to its other files,
+// named after the Typescript file, e.g. 'DeployTools.meta.json'.
+func writeSidecar(out OutputOptions, info AccountInfo) error {
+	name, err := info.filename(out, "typescript")
+	if err != nil {
+		return err
+	}
+	name = strings.TrimSuffix(name, "."+formatExtensions["typescript"]) + ".meta.json"
+
+	content, err := json.MarshalIndent(info.asMetadata(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return out.Sink.WriteFile(name, append(content, '\n'))
+}
+
+// typescriptIndex renders an index.ts 'barrel' file re-exporting each account.
+// Lines are sorted so that the file is stable across runs.
+func typescriptIndex(infos []AccountInfo, out OutputOptions, opts RenderOptions) (string, error) {
+	lines := []string{}
+	for _, info := range infos {
+		name, err := info.filename(out, "typescript")
+		if err != nil {
+			return "", err
+		}
+
+		module := "./" + filepath.ToSlash(strings.TrimSuffix(name, ".ts"))
+		lines = append(lines, fmt.Sprintf("export { %s } from '%s';", info.constName(opts), module))
+	}
+
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
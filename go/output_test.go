@@ -0,0 +1,638 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func testOutputOptions(t *testing.T, dir string, filenameTemplate string) OutputOptions {
+	t.Helper()
+
+	tmpl, err := parseFilenameTemplate(filenameTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return OutputOptions{Sink: dirSink{dir: dir}, FilenameTemplate: tmpl}
+}
+
+func TestWriteIndexReferencesGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	legacy := goldenNoVPCAccountInfo()
+	legacy.AccountName = "legacy-tools"
+	infos := []AccountInfo{legacy, goldenAccountInfo()}
+
+	out := testOutputOptions(t, dir, defaultFilenameTemplate)
+	if err := writeAccountFiles(out, []string{"typescript"}, infos, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := typescriptIndex(infos, out, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "index.ts", []byte(index))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	for _, entry := range entries {
+		files = append(files, "./"+strings.TrimSuffix(entry.Name(), ".ts"))
+	}
+
+	modules := []string{}
+	for _, match := range regexp.MustCompile(`from '([^']+)'`).FindAllStringSubmatch(index, -1) {
+		modules = append(modules, match[1])
+	}
+	sort.Strings(files)
+	if strings.Join(modules, " ") != strings.Join(files, " ") {
+		t.Errorf("index references %v, but the generated files are %v", modules, files)
+	}
+}
+
+func TestWriteFileForce(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested")
+
+	if err := writeFile(dir, "a.ts", []byte("one"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(dir, "a.ts", []byte("two"), false); err == nil || !strings.Contains(err.Error(), "use -force to overwrite") {
+		t.Errorf("got %v, want an error about -force", err)
+	}
+	if err := writeFile(dir, "a.ts", []byte("three"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := os.ReadFile(filepath.Join(dir, "a.ts")); string(got) != "three" {
+		t.Errorf("got %q, want the forced write", got)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.ts")
+
+	if err := writeFileAtomic(path, []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("got %v, %v; want a 0644 file", info, err)
+	}
+
+	// A failed rename (here, onto a non-empty directory) leaves no temporary
+	// file behind.
+	blocked := filepath.Join(dir, "blocked.ts")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(blocked, []byte("two")); err == nil {
+		t.Error("expected an error renaming onto a directory")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"a.ts", "blocked.ts"}) {
+		t.Errorf("got directory entries %v, want no temporary files", names)
+	}
+}
+
+func TestWriteAccountFilesRenderError(t *testing.T) {
+	dir := t.TempDir()
+
+	// The template writes some output before failing, which mustn't end up
+	// in a file.
+	tmpl, err := template.New("broken").Parse("export const {{.ConstName}} = {{call .AccountName}};\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeAccountFiles(testOutputOptions(t, dir, defaultFilenameTemplate), []string{"typescript"}, []AccountInfo{goldenAccountInfo()}, RenderOptions{Template: tmpl})
+	if err == nil {
+		t.Fatal("expected a render error")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("got %d files after a render error, want none", len(entries))
+	}
+}
+
+func TestFilenameTemplate(t *testing.T) {
+	info := goldenAccountInfo()
+
+	tests := []struct {
+		template string
+		format   string
+		want     string
+		err      string
+	}{
+		{defaultFilenameTemplate, "typescript", "DeployTools.ts", ""},
+		{defaultFilenameTemplate, "json", "DeployTools.json", ""},
+		{"{{.AccountNumber}}.{{.Ext}}", "typescript", "123456789012.ts", ""},
+		{"{{.Format}}/{{.AccountName}}.{{.Ext}}", "markdown", "markdown/deploy-tools.md", ""},
+		{"{{if false}}x{{end}}", "typescript", "", "filename is empty"},
+		{"../{{.AccountName}}.ts", "typescript", "", "outside the output directory"},
+		{"/tmp/{{.AccountName}}.ts", "typescript", "", "is not a relative path"},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := parseFilenameTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := info.filename(OutputOptions{FilenameTemplate: tmpl}, tt.format)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got %q, %v; want an error containing %q", tt.template, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.template, got, err, tt.want)
+		}
+	}
+
+	if _, err := parseFilenameTemplate("{{.AccountName"); err == nil {
+		t.Error("expected an error for an unterminated template")
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"deploy-tools", "deploy-tools"},
+		{"Deploy Tools", "deploy-tools"},
+		{"legacy|tools", "legacy-tools"},
+		{"a/b:c\\d", "a-b-c-d"},
+		{"a -- b", "a-b"},
+		{"snake_case", "snake_case"},
+		{"ÜberKonto", "überkonto"},
+		{"../../etc/passwd", "etc-passwd"},
+		{"/absolute", "absolute"},
+		{"trailing/", "trailing"},
+		{"..", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := normalizeName(tt.name)
+		if got != tt.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got != "" {
+			if err := checkRelativePath(got); err != nil {
+				t.Errorf("normalizeName(%q) = %q, which is unsafe: %v", tt.name, got, err)
+			}
+		}
+	}
+}
+
+func TestFilenameNormalizeNames(t *testing.T) {
+	tmpl, err := parseFilenameTemplate(normalizedFilenameTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := OutputOptions{FilenameTemplate: tmpl, NormalizeNames: true}
+
+	tests := []struct {
+		accountName string
+		want        string
+	}{
+		{"Deploy/Tools", "deploy-tools.ts"},
+		{"../../escape", "escape.ts"},
+		// Nothing left after normalising, so the number is used instead.
+		{"../..", "123456789012.ts"},
+		{"", "123456789012.ts"},
+	}
+
+	for _, tt := range tests {
+		info := goldenAccountInfo()
+		info.AccountName = tt.accountName
+
+		got, err := info.filename(out, "typescript")
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v; want %q", tt.accountName, got, err, tt.want)
+		}
+	}
+
+	// Only filenames are normalised, not the Typescript constant name.
+	dir := t.TempDir()
+	out.Sink = dirSink{dir: dir}
+	info := goldenAccountInfo()
+	info.AccountName = "Deploy_Tools"
+	if err := writeAccountFiles(out, []string{"typescript"}, []AccountInfo{info}, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "deploy_tools.ts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "export const Deploy_ToolsAccount") {
+		t.Errorf("unexpected content:\n%s", content)
+	}
+}
+
+func TestStackDirectory(t *testing.T) {
+	tests := []struct {
+		stack     string
+		normalize bool
+		want      string
+	}{
+		{"Frontend", false, "Frontend"},
+		{"Frontend App", true, "frontend-app"},
+		{"", false, "unknown"},
+		{placeholder, false, "unknown"},
+	}
+
+	for _, tt := range tests {
+		info := AccountInfo{Stack: tt.stack}
+		if got := info.stackDirectory(tt.normalize); got != tt.want {
+			t.Errorf("stackDirectory(%q, %t) = %q, want %q", tt.stack, tt.normalize, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByStack(t *testing.T) {
+	dir := t.TempDir()
+	out := testOutputOptions(t, dir, defaultFilenameTemplate)
+	out.GroupBy = "stack"
+
+	infos := []AccountInfo{
+		{AccountName: "frontend", Stack: "web"},
+		{AccountName: "frontend-admin", Stack: "web"},
+		{AccountName: "deploy-tools", Stack: "tools"},
+		{AccountName: "sandbox", Stack: placeholder},
+	}
+	if err := writeAccountFiles(out, []string{"typescript"}, infos, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			got = append(got, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"tools/DeployTools.ts", "unknown/Sandbox.ts", "web/Frontend.ts", "web/FrontendAdmin.ts"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got files %v, want %v", got, want)
+	}
+
+	index, err := typescriptIndex(infos, out, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(index, "from './web/Frontend';") {
+		t.Errorf("index doesn't reference the nested files:\n%s", index)
+	}
+
+	// A stack can't be used to escape the output directory.
+	if _, err := (AccountInfo{AccountName: "a", Stack: "../a"}).filename(out, "typescript"); err == nil {
+		t.Error("expected an error for a stack outside the output directory")
+	}
+
+	if out, err := runMain(t, "-group-by", "region"); err == nil || !strings.Contains(out, `invalid -group-by "region"`) {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestFilenameTemplateSubdirectories(t *testing.T) {
+	dir := t.TempDir()
+	out := testOutputOptions(t, dir, "accounts/{{.AccountNumber}}.{{.Ext}}")
+	infos := []AccountInfo{goldenAccountInfo()}
+
+	if err := writeAccountFiles(out, []string{"typescript"}, infos, RenderOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "accounts", "123456789012.ts")); err != nil {
+		t.Error(err)
+	}
+
+	index, err := typescriptIndex(infos, out, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index != "export { DeployToolsAccount } from './accounts/123456789012';\n" {
+		t.Errorf("got index %q", index)
+	}
+}
+
+func TestFilenameTemplateDuplicateNames(t *testing.T) {
+	// Without the account in the name, the second account's file would
+	// overwrite the first, so it's refused.
+	out := testOutputOptions(t, t.TempDir(), "account.{{.Ext}}")
+	other := goldenAccountInfo()
+	other.AccountName = "other"
+
+	err := writeAccountFiles(out, []string{"typescript"}, []AccountInfo{goldenAccountInfo(), other}, RenderOptions{})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("got %v, want an error about the existing file", err)
+	}
+}
+
+func TestCheckRelativePath(t *testing.T) {
+	for _, name := range []string{"a.ts", "nested/a.ts", "./a.ts", "ü/아.ts", "a/../b.ts"} {
+		if err := checkRelativePath(name); err != nil {
+			t.Errorf("checkRelativePath(%q) = %v, want nil", name, err)
+		}
+	}
+
+	for _, name := range []string{"", ".", "..", "../x", "a/../../x", "/etc/passwd"} {
+		if err := checkRelativePath(name); err == nil {
+			t.Errorf("checkRelativePath(%q) should fail", name)
+		}
+	}
+}
+
+func TestOutputZip(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 3, 3)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "frontend"}
+	]`, string(vpcs))
+
+	path := filepath.Join(t.TempDir(), "accounts.zip")
+	args := []string{"-prism-url", server.URL, "-accounts", "deploy-tools,frontend", "-output-zip", path, "-filename-template", "{{.AccountNumber}}/{{camel .AccountName}}.{{.Ext}}", "-write-index"}
+	if out, err := runMain(t, args...); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	entries := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[f.Name] = string(content)
+	}
+
+	names := []string{}
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := "111/DeployTools.ts 222/Frontend.ts index.ts"; strings.Join(names, " ") != want {
+		t.Errorf("got entries %v, want %s", names, want)
+	}
+
+	if !strings.Contains(entries["111/DeployTools.ts"], "accountNumber: '111'") {
+		t.Errorf("unexpected content:\n%s", entries["111/DeployTools.ts"])
+	}
+	if !strings.Contains(entries["index.ts"], "from './222/Frontend'") {
+		t.Errorf("unexpected index:\n%s", entries["index.ts"])
+	}
+
+	// An existing archive is only replaced with -force.
+	if out, err := runMain(t, args...); err == nil || !strings.Contains(out, "already exists (use -force to overwrite)") {
+		t.Errorf("got %v: %s", err, out)
+	}
+	if out, err := runMain(t, append(args, "-force")...); err != nil {
+		t.Errorf("%v: %s", err, out)
+	}
+}
+
+func TestOutputDirAndZipConflict(t *testing.T) {
+	out, err := runMain(t, "-output-dir", t.TempDir(), "-output-zip", filepath.Join(t.TempDir(), "accounts.zip"))
+	if err == nil || !strings.Contains(out, "can't both be set") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestPrompter(t *testing.T) {
+	var prompts bytes.Buffer
+	confirm := newPrompter(strings.NewReader("y\nno\n YES \n\n"), &prompts)
+
+	got := []bool{}
+	for i := 0; i < 5; i++ {
+		got = append(got, confirm("a.ts"))
+	}
+
+	// The last answer is past the end of the input, which means no.
+	if want := []bool{true, false, true, false, false}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if want := strings.Repeat("a.ts already exists; overwrite? [y/N] ", 5); prompts.String() != want {
+		t.Errorf("got prompts %q", prompts.String())
+	}
+}
+
+func TestDirSinkConfirm(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"kept.ts", "replaced.ts"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	asked := []string{}
+	sink, err := newFileSink(dir, "", false, func(path string) bool {
+		asked = append(asked, filepath.Base(path))
+		return filepath.Base(path) == "replaced.ts"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged := captureLog(t)
+
+	for _, name := range []string{"kept.ts", "replaced.ts", "new.ts"} {
+		err := sink.WriteFile(name, []byte("new"))
+		if name == "kept.ts" {
+			if !errors.Is(err, errSkipped) {
+				t.Errorf("%s: got %v, want errSkipped", name, err)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only existing files are asked about.
+	if !slices.Equal(asked, []string{"kept.ts", "replaced.ts"}) {
+		t.Errorf("asked about %v", asked)
+	}
+	for name, want := range map[string]string{"kept.ts": "old", "replaced.ts": "new", "new.ts": "new"} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != want {
+			t.Errorf("%s: got %q, %v; want %q", name, content, err, want)
+		}
+	}
+	if !strings.Contains(logged.String(), "skipping "+filepath.Join(dir, "kept.ts")) {
+		t.Errorf("got log %q", logged)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "not-a-terminal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if isTerminal(f) {
+		t.Error("a regular file is not a terminal")
+	}
+}
+
+func TestConvertLineEndings(t *testing.T) {
+	tests := []struct {
+		in     string
+		ending string
+		want   string
+	}{
+		{"a\nb\n", "lf", "a\nb\n"},
+		{"a\r\nb\r\n", "lf", "a\nb\n"},
+		{"a\r\nb\n", "lf", "a\nb\n"},
+		{"a\nb\n", "crlf", "a\r\nb\r\n"},
+		{"a\r\nb\n", "crlf", "a\r\nb\r\n"},
+		{"a\r\nb\r\n", "crlf", "a\r\nb\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := string(convertLineEndings([]byte(tt.in), tt.ending)); got != tt.want {
+			t.Errorf("convertLineEndings(%q, %s) = %q, want %q", tt.in, tt.ending, got, tt.want)
+		}
+	}
+
+	// Converting back and forth leaves the content as it was.
+	in := []byte("a\nb\r\nc\n")
+	lf := convertLineEndings(in, "lf")
+	if got := convertLineEndings(convertLineEndings(lf, "crlf"), "lf"); !bytes.Equal(got, lf) {
+		t.Errorf("round trip gave %q, want %q", got, lf)
+	}
+}
+
+func TestLineEndingFlag(t *testing.T) {
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, "[]")
+
+	for _, ending := range []string{"lf", "crlf"} {
+		t.Run(ending, func(t *testing.T) {
+			dir := t.TempDir()
+			out, err := runMain(t, "-prism-url", server.URL, "-output-dir", dir, "-line-ending", ending)
+			if err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			file, err := os.ReadFile(filepath.Join(dir, "DeployTools.ts"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stdout, err := mainCommand("-prism-url", server.URL, "-line-ending", ending).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for name, content := range map[string][]byte{"file": file, "stdout": stdout} {
+				lines := bytes.Count(content, []byte("\n"))
+				crlfs := bytes.Count(content, []byte("\r\n"))
+				if lines == 0 {
+					t.Fatalf("%s is empty", name)
+				}
+				if ending == "lf" && crlfs != 0 {
+					t.Errorf("%s has %d CRLFs, want none", name, crlfs)
+				}
+				if ending == "crlf" && crlfs != lines {
+					t.Errorf("%s has %d CRLFs in %d lines, want all CRLF", name, crlfs, lines)
+				}
+			}
+		})
+	}
+
+	out, err := runMain(t, "-line-ending", "cr")
+	if err == nil || !strings.Contains(out, `invalid -line-ending "cr"`) {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestWriteSidecar(t *testing.T) {
+	dir := t.TempDir()
+	out := testOutputOptions(t, dir, defaultFilenameTemplate)
+	out.Sidecar = true
+
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+	err := writeAccountFiles(out, []string{"typescript"}, []AccountInfo{goldenAccountInfo(), noVPC}, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) AccountMetadata {
+		t.Helper()
+
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var metadata AccountMetadata
+		if err := json.Unmarshal(content, &metadata); err != nil {
+			t.Fatal(err)
+		}
+		return metadata
+	}
+
+	// The sidecar records the chosen VPC in full, and every VPC considered.
+	info := goldenAccountInfo()
+	metadata := read("DeployTools.meta.json")
+	if !reflect.DeepEqual(metadata.AccountReport, info.asReport()) {
+		t.Errorf("got report %+v, want %+v", metadata.AccountReport, info.asReport())
+	}
+	if metadata.PrimaryVPC == nil || !reflect.DeepEqual(*metadata.PrimaryVPC, info.Selection.VPC) {
+		t.Errorf("got primary VPC %+v, want %+v", metadata.PrimaryVPC, info.Selection.VPC)
+	}
+	if !reflect.DeepEqual(metadata.VPCs, info.VPCs) {
+		t.Errorf("got VPCs %+v, want %+v", metadata.VPCs, info.VPCs)
+	}
+
+	metadata = read("LegacyTools.meta.json")
+	if metadata.Status != StatusNoVPC || metadata.PrimaryVPC != nil || metadata.VPCs == nil {
+		t.Errorf("unexpected metadata for an account without a VPC: %+v", metadata)
+	}
+
+	// Only -output-dir and -output-zip have somewhere to put sidecars.
+	out2, err := runMain(t, "-sidecar")
+	if err == nil || !strings.Contains(out2, "-sidecar requires -output-dir or -output-zip") {
+		t.Errorf("got %v: %s", err, out2)
+	}
+}
@@ -0,0 +1,66 @@
+// Package prism is the Prism data model (accounts, VPCs and subnets) along
+// with helpers for working with it, for tools which want to reuse them
+// without the rest of the vpc-examples CLI.
+package prism
+
+import "strings"
+
+type Account struct {
+	AccountNumber      string `json:"accountNumber"`
+	AccountName        string `json:"accountName"`
+	OrganizationalUnit string `json:"organizationalUnit"`
+	// The AWS Organizations status, e.g. 'ACTIVE' or 'SUSPENDED'. Empty if
+	// Prism doesn't say, in which case the account is assumed active.
+	Status string `json:"status"`
+}
+
+// IsActive reports whether the account's status is active (or unknown).
+func (a Account) IsActive() bool {
+	return a.Status == "" || strings.EqualFold(a.Status, "active")
+}
+
+// AccountLookup indexes accounts by name and by number so that each lookup is
+// O(1), rather than scanning the full account list every time.
+type AccountLookup struct {
+	byName   map[string]Account
+	byNumber map[string]Account
+	// All accounts sharing each name, to detect ambiguous names.
+	allByName map[string][]Account
+}
+
+func NewAccountLookup(accounts []Account) AccountLookup {
+	lookup := AccountLookup{
+		byName:    make(map[string]Account, len(accounts)),
+		byNumber:  make(map[string]Account, len(accounts)),
+		allByName: make(map[string][]Account, len(accounts)),
+	}
+
+	for _, account := range accounts {
+		// If several accounts share a name, the first wins.
+		if _, ok := lookup.byName[account.AccountName]; !ok {
+			lookup.byName[account.AccountName] = account
+		}
+
+		lookup.byNumber[account.AccountNumber] = account
+		lookup.allByName[account.AccountName] = append(lookup.allByName[account.AccountName], account)
+	}
+
+	return lookup
+}
+
+// AccountsNamed returns every account with the given name.
+func (l AccountLookup) AccountsNamed(name string) []Account {
+	return l.allByName[name]
+}
+
+// GetAccountByName returns the account with the given name, or the first one
+// if several share it.
+func (l AccountLookup) GetAccountByName(name string) (Account, bool) {
+	account, ok := l.byName[name]
+	return account, ok
+}
+
+func (l AccountLookup) GetAccountByNumber(number string) (Account, bool) {
+	account, ok := l.byNumber[number]
+	return account, ok
+}
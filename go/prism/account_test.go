@@ -0,0 +1,73 @@
+package prism
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testAccounts(n int) []Account {
+	accounts := make([]Account, n)
+	for i := range accounts {
+		accounts[i] = Account{AccountNumber: fmt.Sprint(100 + i), AccountName: fmt.Sprintf("account-%d", i)}
+	}
+
+	return accounts
+}
+
+func TestAccountLookup(t *testing.T) {
+	lookup := NewAccountLookup(testAccounts(3))
+
+	if account, ok := lookup.GetAccountByName("account-1"); !ok || account.AccountNumber != "101" {
+		t.Errorf("GetAccountByName(account-1) = %v, %v", account, ok)
+	}
+	if account, ok := lookup.GetAccountByNumber("102"); !ok || account.AccountName != "account-2" {
+		t.Errorf("GetAccountByNumber(102) = %v, %v", account, ok)
+	}
+
+	// Names and numbers are indexed separately.
+	if _, ok := lookup.GetAccountByName("101"); ok {
+		t.Error("GetAccountByName found an account by number")
+	}
+	if _, ok := lookup.GetAccountByNumber("missing"); ok {
+		t.Error("GetAccountByNumber found a missing account")
+	}
+}
+
+func TestAccountLookupDuplicateNames(t *testing.T) {
+	lookup := NewAccountLookup([]Account{
+		{AccountNumber: "111", AccountName: "shared-name"},
+		{AccountNumber: "222", AccountName: "unique"},
+		{AccountNumber: "333", AccountName: "shared-name"},
+	})
+
+	// The first account with the name wins...
+	if account, ok := lookup.GetAccountByName("shared-name"); !ok || account.AccountNumber != "111" {
+		t.Errorf("GetAccountByName(shared-name) = %v, %v", account, ok)
+	}
+
+	// ...and both are available to report the ambiguity.
+	if matches := lookup.AccountsNamed("shared-name"); len(matches) != 2 || matches[0].AccountNumber != "111" || matches[1].AccountNumber != "333" {
+		t.Errorf("AccountsNamed(shared-name) = %v", matches)
+	}
+	if matches := lookup.AccountsNamed("unique"); len(matches) != 1 {
+		t.Errorf("AccountsNamed(unique) = %v", matches)
+	}
+}
+
+func TestIsActive(t *testing.T) {
+	for status, want := range map[string]bool{"": true, "ACTIVE": true, "active": true, "SUSPENDED": false, "PENDING_CLOSURE": false} {
+		if got := (Account{Status: status}).IsActive(); got != want {
+			t.Errorf("IsActive() with status %q = %t, want %t", status, got, want)
+		}
+	}
+}
+
+func BenchmarkAccountLookup(b *testing.B) {
+	accounts := testAccounts(10000)
+	lookup := NewAccountLookup(accounts)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup.GetAccountByName(accounts[i%len(accounts)].AccountName)
+	}
+}
@@ -0,0 +1,131 @@
+package prism
+
+import "time"
+
+// Structs are the basic data type in Go - a bit like 'case classes' but also
+// quite different! The `json:..` annotations indicate the field to use when
+// (de)serialising to JSON. Note, in Go, 'marshal' and 'unmarshal' are used
+// instead of 'serialise' and 'deserialise' (aka 'write' and 'read').
+type VPC struct {
+	VPCID     string            `json:"vpcId"`
+	AccountID string            `json:"accountId"`
+	IsDefault bool              `json:"default"`
+	Subnets   []Subnet          `json:"subnets"`
+	Tags      map[string]string `json:"tags"`
+	// Shared (e.g. transit or shared-services) VPCs belong to more than one
+	// account, so are not an account's primary VPC.
+	IsShared bool `json:"shared"`
+	// When Prism last refreshed this VPC's data. The zero value means unknown.
+	LastUpdated time.Time `json:"lastUpdated"`
+	// The AWS region, e.g. 'eu-west-1'. If Prism doesn't say, vpc-examples
+	// derives it from the subnets' AZs.
+	Region string `json:"region"`
+	// The AWS VPC state, e.g. 'pending' or 'available'. Empty if Prism
+	// doesn't say, in which case we assume the VPC is usable.
+	State string `json:"state"`
+}
+
+type Subnet struct {
+	// A pointer so that a missing value can be told apart from 'false'; see
+	// ClassifySubnet.
+	IsPublic         *bool  `json:"isPublic"`
+	SubnetID         string `json:"subnetId"`
+	AvailabilityZone string `json:"availabilityZone"`
+	// Whether the subnet's route table routes to an internet gateway, or nil
+	// if Prism doesn't say.
+	HasInternetGatewayRoute *bool `json:"hasInternetGatewayRoute"`
+	// The NAT gateway the subnet's route table uses for outbound traffic, if
+	// any.
+	NATGatewayID string `json:"natGatewayId"`
+	// The subnet's AWS tags.
+	Tags map[string]string `json:"tags"`
+	// Prism's name for the subnet's tier, if any. Only 'reserved' (spare
+	// subnets kept back for future use) is currently meaningful.
+	Tier string `json:"tier"`
+	// The subnet's IPv4 range, e.g. '10.248.16.0/20', if Prism says.
+	CIDR string `json:"cidrBlock"`
+}
+
+type SubnetClass string
+
+const (
+	SubnetPublic  SubnetClass = "public"
+	SubnetPrivate SubnetClass = "private"
+	// Reserved subnets are neither counted as public nor private, and are
+	// rendered as their own tier.
+	SubnetReserved SubnetClass = "reserved"
+	SubnetUnknown  SubnetClass = "unknown"
+)
+
+// ClassifySubnet returns whether a subnet is public or private. If Prism didn't
+// say, the subnet is 'unknown' rather than assumed private, so that schema
+// drift can't silently skew the subnet counts.
+func ClassifySubnet(subnet Subnet) SubnetClass {
+	switch {
+	case subnet.Tier == "reserved":
+		return SubnetReserved
+	case subnet.IsPublic == nil:
+		return SubnetUnknown
+	case *subnet.IsPublic:
+		return SubnetPublic
+	default:
+		return SubnetPrivate
+	}
+}
+
+func PublicSubnets(subnets []Subnet) []Subnet {
+	out := []Subnet{}
+
+	for _, subnet := range subnets {
+		if ClassifySubnet(subnet) == SubnetPublic {
+			out = append(out, subnet)
+		}
+	}
+
+	return out
+}
+
+func ReservedSubnets(subnets []Subnet) []Subnet {
+	out := []Subnet{}
+
+	for _, subnet := range subnets {
+		if ClassifySubnet(subnet) == SubnetReserved {
+			out = append(out, subnet)
+		}
+	}
+
+	return out
+}
+
+func PrivateSubnets(subnets []Subnet) []Subnet {
+	out := []Subnet{}
+
+	for _, subnet := range subnets {
+		if ClassifySubnet(subnet) == SubnetPrivate {
+			out = append(out, subnet)
+		}
+	}
+
+	return out
+}
+
+// Our standard VPC topology has a public and a private subnet in each of three
+// AZs.
+const StandardSubnetCount = 3
+
+// CountPublic returns the number of public subnets.
+func CountPublic(subnets []Subnet) int {
+	return len(PublicSubnets(subnets))
+}
+
+// CountPrivate returns the number of private subnets. Subnets which are
+// neither public nor private (see ClassifySubnet) are not counted.
+func CountPrivate(subnets []Subnet) int {
+	return len(PrivateSubnets(subnets))
+}
+
+// IsStandardTopology reports whether vpc matches our standard topology: a
+// non-default VPC with exactly 3 public and 3 private subnets.
+func IsStandardTopology(vpc VPC) bool {
+	return !vpc.IsDefault && CountPublic(vpc.Subnets) == StandardSubnetCount && CountPrivate(vpc.Subnets) == StandardSubnetCount
+}
@@ -0,0 +1,117 @@
+package prism
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testSubnet(id string, public bool, az string) Subnet {
+	return Subnet{SubnetID: id, IsPublic: &public, AvailabilityZone: az}
+}
+
+// testVPC returns a non-default VPC with the given number of public and
+// private subnets.
+func testVPC(id string, public int, private int) VPC {
+	vpc := VPC{VPCID: id}
+	for i := 0; i < public; i++ {
+		vpc.Subnets = append(vpc.Subnets, testSubnet(fmt.Sprintf("%s-public-%d", id, i), true, ""))
+	}
+	for i := 0; i < private; i++ {
+		vpc.Subnets = append(vpc.Subnets, testSubnet(fmt.Sprintf("%s-private-%d", id, i), false, ""))
+	}
+
+	return vpc
+}
+
+func TestClassifySubnet(t *testing.T) {
+	tests := []struct {
+		subnet Subnet
+		want   SubnetClass
+	}{
+		{testSubnet("a", true, ""), SubnetPublic},
+		{testSubnet("b", false, ""), SubnetPrivate},
+		{Subnet{SubnetID: "c"}, SubnetUnknown},
+		// The tier wins over the public flag.
+		{Subnet{SubnetID: "d", IsPublic: testSubnet("", false, "").IsPublic, Tier: "reserved"}, SubnetReserved},
+		{Subnet{SubnetID: "e", Tier: "reserved"}, SubnetReserved},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifySubnet(tt.subnet); got != tt.want {
+			t.Errorf("ClassifySubnet(%s) = %s, want %s", tt.subnet.SubnetID, got, tt.want)
+		}
+	}
+}
+
+func TestCountSubnets(t *testing.T) {
+	// Each tier is counted independently, from none up to more than the
+	// standard 3.
+	for _, public := range []int{0, 1, 3, 4, 6} {
+		for _, private := range []int{0, 1, 3, 4, 6} {
+			vpc := testVPC("vpc-a", public, private)
+			if got := CountPublic(vpc.Subnets); got != public {
+				t.Errorf("%d+%d: CountPublic got %d", public, private, got)
+			}
+			if got := CountPrivate(vpc.Subnets); got != private {
+				t.Errorf("%d+%d: CountPrivate got %d", public, private, got)
+			}
+		}
+	}
+
+	vpc := testVPC("vpc-a", 2, 4)
+	// Unknown subnets count towards neither tier.
+	vpc.Subnets = append(vpc.Subnets, Subnet{SubnetID: "subnet-unknown"})
+
+	if got := CountPublic(vpc.Subnets); got != 2 {
+		t.Errorf("CountPublic got %d, want 2", got)
+	}
+	if got := CountPrivate(vpc.Subnets); got != 4 {
+		t.Errorf("CountPrivate got %d, want 4", got)
+	}
+
+	// Nor do reserved ones, even if Prism also marks them private.
+	reserved := testSubnet("subnet-reserved", false, "eu-west-1a")
+	reserved.Tier = "reserved"
+	if got := CountPrivate(append(vpc.Subnets, reserved)); got != 4 {
+		t.Errorf("CountPrivate with a reserved subnet got %d, want 4", got)
+	}
+	if CountPublic(nil) != 0 || CountPrivate(nil) != 0 {
+		t.Error("expected no subnets to count as 0")
+	}
+}
+
+func TestIsStandardTopology(t *testing.T) {
+	defaultVPC := testVPC("vpc-default", 3, 3)
+	defaultVPC.IsDefault = true
+
+	// Reserved and unknown subnets don't count towards either tier.
+	withReserved := testVPC("vpc-a", 3, 3)
+	reserved := testSubnet("subnet-reserved", false, "")
+	reserved.Tier = "reserved"
+	withReserved.Subnets = append(withReserved.Subnets, reserved, Subnet{SubnetID: "subnet-unknown"})
+
+	tests := []struct {
+		name string
+		vpc  VPC
+		want bool
+	}{
+		{"3 public, 3 private", testVPC("vpc-a", 3, 3), true},
+		{"no subnets", testVPC("vpc-a", 0, 0), false},
+		{"no public subnets", testVPC("vpc-a", 0, 3), false},
+		{"no private subnets", testVPC("vpc-a", 3, 0), false},
+		{"too few public subnets", testVPC("vpc-a", 2, 3), false},
+		{"too many public subnets", testVPC("vpc-a", 4, 3), false},
+		{"too many private subnets", testVPC("vpc-a", 3, 4), false},
+		{"6 public, 6 private", testVPC("vpc-a", 6, 6), false},
+		{"3 public, 3 private, reserved and unknown", withReserved, true},
+		{"default VPC", defaultVPC, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsStandardTopology(tt.vpc); got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,575 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// prismTestServer is a fake Prism over real HTTP, so that tests go through the
+// same client code (headers, status handling, decompression and decoding) as
+// a real run. By default it serves the canned responses in testdata/prism,
+// including the version 2 VPCs shape when that's requested.
+type prismTestServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	requests  []*http.Request
+	overrides map[string]cannedResponse
+}
+
+type cannedResponse struct {
+	status int
+	body   string
+	header http.Header
+}
+
+// newPrismTestServer starts a prismTestServer, which is shut down when the test
+// finishes.
+func newPrismTestServer(t *testing.T) *prismTestServer {
+	t.Helper()
+
+	accounts, err := os.ReadFile("testdata/prism/accounts.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vpcs, err := os.ReadFile("testdata/prism/vpcs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vpcsV2, err := os.ReadFile("testdata/prism/vpcs-v2.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &prismTestServer{overrides: map[string]cannedResponse{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		override, overridden := s.overrides[r.URL.Path]
+		s.mu.Unlock()
+
+		switch {
+		case overridden:
+			for name, values := range override.header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(override.status)
+			w.Write([]byte(override.body))
+		case r.URL.Path == "/sources/accounts":
+			w.Write(accounts)
+		case r.URL.Path == "/vpcs" && r.Header.Get("Accept") == "application/vnd.prism.v2+json":
+			w.Write(vpcsV2)
+		case r.URL.Path == "/vpcs" && r.URL.Query().Has("accountId"):
+			w.Write(vpcsForAccount(t, vpcs, r.URL.Query().Get("accountId")))
+		case r.URL.Path == "/vpcs":
+			w.Write(vpcs)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// vpcsForAccount filters the canned VPCs response, like Prism's field
+// filtering.
+func vpcsForAccount(t *testing.T, data []byte, account string) []byte {
+	var wrapper PrismResponseVPCsWrapper
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		t.Error(err)
+	}
+
+	filtered := []PrismVPC{}
+	for _, vpc := range wrapper.Data.VPCs {
+		if vpc.AccountID == account {
+			filtered = append(filtered, vpc)
+		}
+	}
+	wrapper.Data.VPCs = filtered
+	out, err := json.Marshal(wrapper)
+	if err != nil {
+		t.Error(err)
+	}
+
+	return out
+}
+
+// respond replaces the response for a path, e.g. to simulate a failure.
+func (s *prismTestServer) respond(path string, status int, body string) {
+	s.respondWithHeader(path, status, body, nil)
+}
+
+func (s *prismTestServer) respondWithHeader(path string, status int, body string, header http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides[path] = cannedResponse{status: status, body: body, header: header}
+}
+
+// received returns the requests made so far.
+func (s *prismTestServer) received() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request{}, s.requests...)
+}
+
+func (s *prismTestServer) prism() Prism {
+	return Prism{BaseURL: s.URL, Client: s.Client()}
+}
+
+func TestPrismGetAccounts(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	accounts, err := server.prism().getAccounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PrismAccount{
+		{AccountNumber: "111111111111", AccountName: "deploy-tools", OrganizationalUnit: "tools", Status: "ACTIVE"},
+		{AccountNumber: "222222222222", AccountName: "frontend", OrganizationalUnit: "web", Status: "ACTIVE"},
+		{AccountNumber: "333333333333", AccountName: "old-one", OrganizationalUnit: "web", Status: "SUSPENDED"},
+	}
+	if !slices.Equal(accounts, want) {
+		t.Errorf("got %+v, want %+v", accounts, want)
+	}
+}
+
+func TestPrismGetVPCs(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	vpcs, err := server.prism().getVPCs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vpcs) != 2 || len(vpcs["111111111111"]) != 2 || len(vpcs["222222222222"]) != 1 {
+		t.Fatalf("got %v, want 2 VPCs for 111111111111 and 1 for 222222222222", vpcs)
+	}
+
+	main := vpcs["111111111111"][0]
+	if main.VPCID != "vpc-1" || main.Tags["Name"] != "main" || prism.CountPublic(main.Subnets) != 3 || prism.CountPrivate(main.Subnets) != 3 {
+		t.Errorf("vpc-1 wasn't decoded correctly: %+v", main)
+	}
+	if main.Subnets[0].SubnetID != "subnet-a1" || main.Subnets[0].AvailabilityZone != "eu-west-1a" {
+		t.Errorf("subnet-a1 wasn't decoded correctly: %+v", main.Subnets[0])
+	}
+}
+
+func TestPrismGetVPCsForAccount(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	vpcs, err := server.prism().getVPCsForAccount(context.Background(), "222222222222")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vpcs) != 1 || vpcs[0].VPCID != "vpc-2" {
+		t.Errorf("got %+v, want just vpc-2", vpcs)
+	}
+	if got := server.received()[0].URL.Query().Get("accountId"); got != "222222222222" {
+		t.Errorf("requested accountId %q", got)
+	}
+}
+
+func TestPrismAPIVersions(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	want, err := server.prism().getVPCs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want["111111111111"]) != 2 || len(want["222222222222"]) != 1 {
+		t.Fatalf("unexpected version 1 VPCs: %v", want)
+	}
+
+	tests := []struct {
+		version int
+		accept  string
+	}{
+		{0, ""},
+		{1, "application/vnd.prism.v1+json"},
+		{2, "application/vnd.prism.v2+json"},
+	}
+
+	for _, tt := range tests {
+		prism := server.prism()
+		prism.APIVersion = tt.version
+
+		// Both shapes decode to the same VPCs.
+		got, err := prism.getVPCs(context.Background())
+		if err != nil {
+			t.Fatalf("version %d: %v", tt.version, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("version %d: got %v, want %v", tt.version, got, want)
+		}
+
+		requests := server.received()
+		if accept := requests[len(requests)-1].Header.Get("Accept"); accept != tt.accept {
+			t.Errorf("version %d: got Accept %q, want %q", tt.version, accept, tt.accept)
+		}
+	}
+
+	// The version 1 shape doesn't decode as version 2.
+	server.respond("/vpcs", http.StatusOK, `{"data": {"vpcs": []}}`)
+	prism := server.prism()
+	prism.APIVersion = 2
+	var parseErr *ParseError
+	if _, err := prism.getVPCs(context.Background()); !errors.As(err, &parseErr) {
+		t.Errorf("got %v, want a *ParseError", err)
+	}
+
+	out, err := runMain(t, "-prism-api-version", "3")
+	if err == nil || !strings.Contains(out, "unsupported -prism-api-version 3") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestPrismRequestHeaders(t *testing.T) {
+	server := newPrismTestServer(t)
+	server.respond("/vpcs", http.StatusOK, `{"data": [{"vpcId": "vpc-v2", "accountId": "111111111111"}]}`)
+
+	prism := server.prism()
+	prism.APIVersion = 2
+	prism.Headers = http.Header{"X-Request-Id": {"abc"}}
+
+	vpcs, err := prism.getVPCs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 2 has the VPCs directly under 'data'.
+	if len(vpcs["111111111111"]) != 1 || vpcs["111111111111"][0].VPCID != "vpc-v2" {
+		t.Errorf("version 2 response wasn't decoded: %v", vpcs)
+	}
+
+	req := server.received()[0]
+	if got := req.Header.Get("Accept"); got != "application/vnd.prism.v2+json" {
+		t.Errorf("got Accept %q", got)
+	}
+	if got := req.Header.Get("X-Request-Id"); got != "abc" {
+		t.Errorf("got X-Request-Id %q", got)
+	}
+}
+
+func TestGetJSONGzip(t *testing.T) {
+	// Go's default transport asks for gzip itself and then decodes it
+	// transparently. Turning that off simulates a body that arrives still
+	// encoded, e.g. because a proxy added the encoding.
+	prism := Prism{Client: &http.Client{Transport: &http.Transport{DisableCompression: true}}}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		fmt.Fprint(gz, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+		gz.Close()
+	}))
+	defer server.Close()
+
+	var wrapper PrismResponseAccountsWrapper
+	if err := prism.getJSON(context.Background(), server.URL, &wrapper); err != nil {
+		t.Fatal(err)
+	}
+	if len(wrapper.Data) != 1 || wrapper.Data[0].AccountName != "deploy-tools" {
+		t.Errorf("got %+v", wrapper.Data)
+	}
+
+	notGzip := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		fmt.Fprint(w, `{"data": []}`)
+	}))
+	defer notGzip.Close()
+
+	var parseErr *ParseError
+	if err := prism.getJSON(context.Background(), notGzip.URL, &wrapper); !errors.As(err, &parseErr) {
+		t.Errorf("got %v, want a *ParseError for an invalid gzip body", err)
+	}
+}
+
+func TestPrismURL(t *testing.T) {
+	tests := []struct {
+		env, override string
+		want          string
+	}{
+		{"prod", "", "https://prism.gutools.co.uk"},
+		{"code", "", "https://prism.code.dev-gutools.co.uk"},
+		{"local", "", "http://localhost:9000"},
+		{"prod", "http://prism.internal", "http://prism.internal"},
+		{"prod", "http://prism.internal/", "http://prism.internal"},
+		// The override wins even over an unknown environment.
+		{"nope", "http://prism.internal", "http://prism.internal"},
+	}
+
+	for _, tt := range tests {
+		got, err := prismURL(tt.env, tt.override)
+		if err != nil || got != tt.want {
+			t.Errorf("prismURL(%q, %q) = %q, %v; want %q", tt.env, tt.override, got, err, tt.want)
+		}
+	}
+
+	_, err := prismURL("staging", "")
+	if err == nil || err.Error() != `unknown environment "staging"; valid environments are: code, local, prod` {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPrismUsesBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sources/accounts" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+	}))
+	defer server.Close()
+
+	baseURL, err := prismURL("prod", server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := Prism{BaseURL: baseURL, Client: http.DefaultClient}.getAccounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].AccountNumber != "111" {
+		t.Errorf("got %+v", accounts)
+	}
+}
+
+func TestGetVPCsForAccountEscapesID(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.Query().Get("accountId")
+		fmt.Fprint(w, `{"data": {"vpcs": [{"vpcId": "vpc-a", "accountId": "111"}]}}`)
+	}))
+	defer server.Close()
+
+	prism := Prism{BaseURL: server.URL, Client: http.DefaultClient}
+	vpcs, err := prism.getVPCsForAccount(context.Background(), "111&x=y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "111&x=y" {
+		t.Errorf("Prism saw accountId %q", got)
+	}
+	if len(vpcs) != 1 || vpcs[0].VPCID != "vpc-a" {
+		t.Errorf("got %+v", vpcs)
+	}
+}
+
+func TestPrismGzipResponse(t *testing.T) {
+	gzipped := func(s string) string {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		gz.Write([]byte(s))
+		gz.Close()
+		return body.String()
+	}
+	// The server compresses the body without being asked, so Go's client
+	// doesn't decompress it for us.
+	gzipHeader := http.Header{"Content-Encoding": {"gzip"}}
+
+	server := newPrismTestServer(t)
+	server.respondWithHeader("/sources/accounts", http.StatusOK, gzipped(`{"data": [{"accountNumber": "999", "accountName": "zipped"}]}`), gzipHeader)
+
+	accounts, err := server.prism().getAccounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].AccountName != "zipped" {
+		t.Errorf("got %+v", accounts)
+	}
+
+	// The limit applies after decompression, so a small body that expands
+	// past it is still rejected.
+	huge := `{"data": []}` + strings.Repeat(" ", 10000)
+	server.respondWithHeader("/sources/accounts", http.StatusOK, gzipped(huge), gzipHeader)
+
+	prism := server.prism()
+	prism.MaxResponseBytes = 1000
+	_, err = prism.getAccounts(context.Background())
+	var tooLargeErr *ResponseTooLargeError
+	if !errors.As(err, &tooLargeErr) || tooLargeErr.Limit != 1000 {
+		t.Errorf("got %v, want a ResponseTooLargeError", err)
+	}
+	if len(gzipped(huge)) >= 1000 {
+		t.Fatalf("compressed body is %d bytes, so doesn't test decompression", len(gzipped(huge)))
+	}
+
+	// And it isn't retried, as a second attempt would be just as big.
+	requests := len(server.received())
+	prism.Retries = 2
+	prism.getAccounts(context.Background())
+	if got := len(server.received()) - requests; got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestPrismFailures(t *testing.T) {
+	methods := []struct {
+		name string
+		path string
+		call func(p Prism) error
+	}{
+		{"getAccounts", "/sources/accounts", func(p Prism) error {
+			_, err := p.getAccounts(context.Background())
+			return err
+		}},
+		{"getVPCs", "/vpcs", func(p Prism) error {
+			_, err := p.getVPCs(context.Background())
+			return err
+		}},
+	}
+
+	responses := []struct {
+		name   string
+		status int
+		body   string
+		check  func(t *testing.T, err error)
+	}{
+		{"server error", http.StatusInternalServerError, "oops", func(t *testing.T, err error) {
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.Code != 500 || statusErr.Body != "oops" {
+				t.Errorf("got %v, want a 500 StatusError", err)
+			}
+		}},
+		{"empty body", http.StatusOK, "", func(t *testing.T, err error) {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("got %v, want a ParseError", err)
+			}
+		}},
+		{"malformed JSON", http.StatusOK, `{"data": [{"accountNumber": }`, func(t *testing.T, err error) {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("got %v, want a ParseError", err)
+			}
+		}},
+		{"too large", http.StatusOK, `{"data": []}` + string(bytes.Repeat([]byte(" "), 100)), func(t *testing.T, err error) {
+			var tooLargeErr *ResponseTooLargeError
+			if !errors.As(err, &tooLargeErr) || tooLargeErr.Limit != 64 {
+				t.Errorf("got %v, want a ResponseTooLargeError", err)
+			}
+		}},
+		{"exactly the limit", http.StatusOK, `{"data": []}` + string(bytes.Repeat([]byte(" "), 64-len(`{"data": []}`))), func(t *testing.T, err error) {
+			var tooLargeErr *ResponseTooLargeError
+			if errors.As(err, &tooLargeErr) {
+				t.Errorf("got %v for a response of exactly the limit", err)
+			}
+		}},
+	}
+
+	for _, method := range methods {
+		for _, response := range responses {
+			t.Run(method.name+"/"+response.name, func(t *testing.T) {
+				server := newPrismTestServer(t)
+				server.respond(method.path, response.status, response.body)
+
+				prism := server.prism()
+				prism.MaxResponseBytes = 64
+				response.check(t, method.call(prism))
+			})
+		}
+	}
+}
+
+func TestPrismEndpointOverrides(t *testing.T) {
+	base := newPrismTestServer(t)
+	accounts := newPrismTestServer(t)
+	vpcs := newPrismTestServer(t)
+
+	tests := []struct {
+		name                  string
+		accountsURL, vpcsURL  string
+		wantBase, wantAccount int
+		wantVPCs              int
+	}{
+		{"base only", "", "", 2, 0, 0},
+		{"accounts overridden", accounts.URL + "/sources/accounts", "", 1, 1, 0},
+		{"vpcs overridden", "", vpcs.URL + "/vpcs", 1, 0, 1},
+		{"both overridden", accounts.URL + "/sources/accounts", vpcs.URL + "/vpcs", 0, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := func() []int {
+				return []int{len(base.received()), len(accounts.received()), len(vpcs.received())}
+			}
+			before := counts()
+
+			prism := Prism{BaseURL: base.URL, AccountsURL: tt.accountsURL, VPCsURL: tt.vpcsURL, Client: http.DefaultClient}
+			if _, err := prism.getAccounts(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := prism.getVPCs(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			after := counts()
+			got := []int{after[0] - before[0], after[1] - before[1], after[2] - before[2]}
+			if want := []int{tt.wantBase, tt.wantAccount, tt.wantVPCs}; !slices.Equal(got, want) {
+				t.Errorf("got requests to base, accounts and vpcs servers of %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetVPCsForAccountKeepsVPCsURLQuery(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	prism := Prism{VPCsURL: server.URL + "/vpcs?region=eu-west-1", Client: http.DefaultClient}
+	if _, err := prism.getVPCsForAccount(context.Background(), "111111111111"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := server.received()[0].URL.Query()
+	if query.Get("region") != "eu-west-1" || query.Get("accountId") != "111111111111" {
+		t.Errorf("got query %v", query)
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, valid := range []string{"https://prism.gutools.co.uk", "http://localhost:9000/vpcs?x=y"} {
+		if err := validateURL(valid); err != nil {
+			t.Errorf("validateURL(%q) = %v", valid, err)
+		}
+	}
+
+	for _, invalid := range []string{"prism.gutools.co.uk/vpcs", "ftp://prism", "https://", "http://a b", ""} {
+		if err := validateURL(invalid); err == nil {
+			t.Errorf("validateURL(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestInvalidEndpointURL(t *testing.T) {
+	out, err := runMain(t, "-vpcs-url", "prism/vpcs")
+	if err == nil || !strings.Contains(out, "invalid -vpcs-url") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestMaxResponseMBFlag(t *testing.T) {
+	out, err := runMain(t, "-max-response-mb", "0")
+	if err == nil || !strings.Contains(out, "-max-response-mb must be positive") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
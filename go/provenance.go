@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Set at build time with '-ldflags "-X main.version=..."'; otherwise we fall
+// back to what the Go toolchain recorded in the binary.
+var version = ""
+
+// toolVersion returns the version of this tool: the module version if it was
+// installed with 'go install', or the VCS revision it was built from.
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+
+	return "devel"
+}
+
+// Provenance describes how output was generated, for the '-header' comment.
+type Provenance struct {
+	Version string
+	// Where the data came from, e.g. 'Prism: https://prism.gutools.co.uk';
+	// see describeSource.
+	Source string
+	// Omitted from the comment if zero, e.g. with '-no-timestamp'.
+	Generated time.Time
+}
+
+// comment renders the provenance of the account's output as a Typescript
+// comment block.
+func (p Provenance) comment(info AccountInfo) string {
+	vpc := "none found"
+	if info.Selection.Found {
+		vpc = info.Selection.VPC.VPCID
+	}
+
+	lines := []string{
+		"// Generated by scala-school-example " + p.Version,
+		"// " + p.Source,
+		"// Primary VPC: " + vpc,
+	}
+	if !p.Generated.IsZero() {
+		lines = append(lines, "// Generated at: "+p.Generated.Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("%s\n\n", strings.Join(lines, "\n"))
+}
+
+// describeSource returns where source read its data from, for the provenance
+// comment: the Prism URL, the -replay directory, or the AWS account and region.
+// accounts are the accounts source returned.
+func describeSource(source PrismLike, accounts []PrismAccount) string {
+	switch s := source.(type) {
+	case AWSPrism:
+		if len(accounts) == 0 {
+			return "AWS: " + s.Region
+		}
+		return fmt.Sprintf("AWS: account %s in %s", accounts[0].AccountNumber, s.Region)
+	case Prism:
+		if s.ReplayDir != "" {
+			return "Replayed from: " + s.ReplayDir
+		}
+		return "Prism: " + s.BaseURL
+	default:
+		return fmt.Sprintf("Source: %T", source)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// renderReadme writes a short Markdown summary of the account and its primary
+// VPC, for '-format readme', to hand over alongside the Typescript.
+func (info AccountInfo) renderReadme(w io.Writer, opts RenderOptions) error {
+	var b strings.Builder
+
+	stack := info.Stack
+	if stack == placeholder {
+		stack = camelCase(info.AccountName)
+	}
+
+	fmt.Fprintf(&b, "# %s\n\n", info.AccountName)
+	b.WriteString("| | |\n| --- | --- |\n")
+	fmt.Fprintf(&b, "| Account number | %s |\n", info.AccountNumber)
+	fmt.Fprintf(&b, "| Stack | %s |\n", stack)
+
+	if !info.Selection.Found {
+		fmt.Fprintf(&b, "\nNo suitable primary VPC was found: %s.\n", info.Selection.Reason)
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	vpc := info.Selection.VPC
+	fmt.Fprintf(&b, "| Primary VPC | %s |\n", vpc.VPCID)
+	if vpc.Region != "" {
+		fmt.Fprintf(&b, "| Region | %s |\n", vpc.Region)
+	}
+
+	public := orderSubnets(prism.PublicSubnets(vpc.Subnets), opts.SubnetOrder)
+	private := orderSubnets(prism.PrivateSubnets(vpc.Subnets), opts.SubnetOrder)
+	reserved := orderSubnets(prism.ReservedSubnets(vpc.Subnets), opts.SubnetOrder)
+
+	fmt.Fprintf(&b, "\nThe primary VPC is %s, with %d public and %d private subnets", vpc.VPCID, len(public), len(private))
+	if len(reserved) > 0 {
+		fmt.Fprintf(&b, " (and %d reserved)", len(reserved))
+	}
+	if azs, ok := knownAvailabilityZones(vpc); ok {
+		fmt.Fprintf(&b, " across %d availability zones (%s)", len(azs), strings.Join(azs, ", "))
+	}
+	b.WriteString(".\n")
+
+	if info.Selection.Warning != "" {
+		fmt.Fprintf(&b, "\n**Warning:** this VPC was accepted with %s.\n", info.Selection.Warning)
+	}
+
+	b.WriteString("\n## Subnets\n\n| Subnet | Tier | Availability zone |\n| --- | --- | --- |\n")
+	tiers := []struct {
+		name    string
+		subnets []PrismSubnet
+	}{
+		{"public", public},
+		{"private", private},
+		{"reserved", reserved},
+	}
+	for _, tier := range tiers {
+		for _, subnet := range tier.subnets {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", subnet.SubnetID, tier.name, valueOr(subnet.AvailabilityZone, "unknown"))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+)
+
+// Where summaries and reports for humans go. With '-redact-account-numbers'
+// it's wrapped in a redactingWriter.
+var stderr io.Writer = os.Stderr
+
+// AWS account numbers are always 12 digits.
+var accountNumberPattern = regexp.MustCompile(`\b\d{12}\b`)
+
+// redactAccountNumber masks all but the last 4 digits of an account number,
+// e.g. '****1234'.
+func redactAccountNumber(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+
+	return "****" + number[len(number)-4:]
+}
+
+// redactAccountNumbers masks every account number in s.
+func redactAccountNumbers(s string) string {
+	return accountNumberPattern.ReplaceAllStringFunc(s, redactAccountNumber)
+}
+
+// redactingWriter masks account numbers in everything written through it. It
+// assumes each Write is a whole line (or more), which holds for the log
+// package and our summaries.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	_, err := io.WriteString(r.w, redactAccountNumbers(string(p)))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
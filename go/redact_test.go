@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactAccountNumber(t *testing.T) {
+	tests := map[string]string{
+		"123456789012": "****9012",
+		"12345":        "****2345",
+		"1234":         "1234",
+		"":             "",
+	}
+
+	for number, want := range tests {
+		if got := redactAccountNumber(number); got != want {
+			t.Errorf("redactAccountNumber(%q) = %q, want %q", number, got, want)
+		}
+	}
+}
+
+func TestRedactAccountNumbers(t *testing.T) {
+	tests := map[string]string{
+		"deploy-tools (123456789012): 2 VPCs":           "deploy-tools (****9012): 2 VPCs",
+		`{"account":"123456789012","n":1}`:              `{"account":"****9012","n":1}`,
+		"123456789012,210987654321":                     "****9012,****4321",
+		"| deploy-tools | 123456789012 | vpc-1 |":       "| deploy-tools | ****9012 | vpc-1 |",
+		"no numbers here":                               "no numbers here",
+		"too short 12345678901, too long 1234567890123": "too short 12345678901, too long 1234567890123",
+		"vpc-123456789012abc":                           "vpc-123456789012abc",
+	}
+
+	for in, want := range tests {
+		if got := redactAccountNumbers(in); got != want {
+			t.Errorf("redactAccountNumbers(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := redactingWriter{w: &buf}
+
+	in := "summary: 123456789012 failed\n"
+	n, err := w.Write([]byte(in))
+	if err != nil || n != len(in) {
+		t.Errorf("got %d, %v; want %d, nil", n, err, len(in))
+	}
+	if buf.String() != "summary: ****9012 failed\n" {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func TestRedactFlag(t *testing.T) {
+	server := newPrismTestServer(t)
+
+	// Generated output keeps full account numbers in every format, while
+	// logs and summaries are masked.
+	for _, format := range outputFormats {
+		t.Run(format, func(t *testing.T) {
+			logPath := filepath.Join(t.TempDir(), "run.log")
+
+			args := []string{"-prism-url", server.URL, "-all", "-verbose", "-no-timestamp", "-format", format}
+			unredacted, err := mainCommand(args...).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd := mainCommand(append(args, "-redact-account-numbers", "-log-file", logPath)...)
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatalf("%v: %s", err, stderr.String())
+			}
+
+			if stdout.String() != string(unredacted) {
+				t.Errorf("generated output was redacted:\n%s\nwant:\n%s", stdout.String(), unredacted)
+			}
+
+			if !strings.Contains(stderr.String(), "(****1111): 2 VPCs") || strings.Contains(stderr.String(), "111111111111") {
+				t.Errorf("logs weren't redacted:\n%s", stderr.String())
+			}
+
+			f, err := os.Open(logPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			lines := 0
+			for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+				if strings.Contains(scanner.Text(), "111111111111") {
+					t.Errorf("-log-file line wasn't redacted: %s", scanner.Text())
+				}
+			}
+			if lines == 0 {
+				t.Error("nothing written to -log-file")
+			}
+		})
+	}
+
+	// Errors, here as JSON, are redacted too.
+	server.respond("/vpcs", 500, "account 222222222222 is broken")
+	var stderr bytes.Buffer
+	cmd := mainCommand("-prism-url", server.URL, "-retries", "0", "-error-format", "json", "-redact-account-numbers")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+	if !strings.Contains(stderr.String(), "****2222") || strings.Contains(stderr.String(), "222222222222") {
+		t.Errorf("error wasn't redacted:\n%s", stderr.String())
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// AccountReport is the machine-readable equivalent of the Typescript template,
+// used by the JSON output formats.
+type AccountReport struct {
+	AccountNumber  string   `json:"accountNumber"`
+	AccountName    string   `json:"accountName"`
+	Stack          string   `json:"stack"`
+	Status         string   `json:"status"`
+	Reason         string   `json:"reason,omitempty"`
+	VPCID          string   `json:"vpcId,omitempty"`
+	PublicSubnets  []string `json:"publicSubnets"`
+	PrivateSubnets []string `json:"privateSubnets"`
+	// Omitted for the usual two-tier VPCs.
+	ReservedSubnets []string `json:"reservedSubnets,omitempty"`
+	// Public subnets that Prism reports as lacking an internet gateway route.
+	UnroutedPublicSubnets []string `json:"unroutedPublicSubnets,omitempty"`
+	// Set if the VPC was accepted despite a sub-standard topology.
+	Warning string `json:"warning,omitempty"`
+}
+
+// AccountMetadata is written to a '.meta.json' file alongside each account's
+// generated files with '-sidecar', recording what the selection was based on
+// for later auditing. The AccountReport fields are embedded, so appear at the
+// top level of the JSON, a bit like mixing in a trait.
+type AccountMetadata struct {
+	AccountReport
+	// Every VPC Prism has for the account, before any filtering.
+	VPCs []PrismVPC `json:"vpcs"`
+	// The chosen VPC in full, e.g. with subnet AZs and tags.
+	PrimaryVPC *PrismVPC `json:"primaryVpc,omitempty"`
+}
+
+func (info AccountInfo) asMetadata() AccountMetadata {
+	metadata := AccountMetadata{AccountReport: info.asReport(), VPCs: info.VPCs}
+	if metadata.VPCs == nil {
+		metadata.VPCs = []PrismVPC{}
+	}
+	if info.Selection.Found {
+		vpc := info.Selection.VPC
+		metadata.PrimaryVPC = &vpc
+	}
+
+	return metadata
+}
+
+const (
+	StatusMatched = "matched"
+	StatusNoVPC   = "no-suitable-vpc"
+)
+
+func subnetIDs(subnets []PrismSubnet) []string {
+	ids := []string{}
+	for _, s := range subnets {
+		ids = append(ids, s.SubnetID)
+	}
+
+	return ids
+}
+
+func (info AccountInfo) asReport() AccountReport {
+	report := AccountReport{
+		AccountNumber:  info.AccountNumber,
+		AccountName:    info.AccountName,
+		Stack:          info.Stack,
+		Status:         StatusNoVPC,
+		Reason:         info.Selection.Reason,
+		PublicSubnets:  []string{},
+		PrivateSubnets: []string{},
+	}
+
+	primaryVPC := info.Selection.VPC
+	if info.Selection.Found {
+		report.Status = StatusMatched
+		report.VPCID = primaryVPC.VPCID
+		report.PublicSubnets = subnetIDs(prism.PublicSubnets(primaryVPC.Subnets))
+		report.PrivateSubnets = subnetIDs(prism.PrivateSubnets(primaryVPC.Subnets))
+		if reserved := prism.ReservedSubnets(primaryVPC.Subnets); len(reserved) > 0 {
+			report.ReservedSubnets = subnetIDs(reserved)
+		}
+		report.Warning = info.Selection.Warning
+
+		if unrouted := unroutedPublicSubnets(primaryVPC.Subnets); len(unrouted) > 0 {
+			report.UnroutedPublicSubnets = subnetIDs(unrouted)
+		}
+	}
+
+	return report
+}
+
+// reportsAsJSON renders all accounts as a single JSON array, indented for
+// humans if 'pretty' is set.
+func reportsAsJSON(infos []AccountInfo, pretty bool) ([]byte, error) {
+	reports := []AccountReport{}
+	for _, info := range infos {
+		reports = append(reports, info.asReport())
+	}
+
+	if pretty {
+		return json.MarshalIndent(reports, "", "  ")
+	}
+
+	return json.Marshal(reports)
+}
+
+// reportsAsNDJSON renders one compact JSON object per line (newline-delimited
+// JSON). Indentation would break the one-object-per-line contract, so there is
+// no 'pretty' option here.
+func reportsAsNDJSON(infos []AccountInfo) ([]byte, error) {
+	out := []byte{}
+	for _, info := range infos {
+		line, err := json.Marshal(info.asReport())
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, line...)
+		out = append(out, '\n')
+	}
+
+	return out, nil
+}
+
+// reportsAsMarkdown renders a summary table, handy for pasting into docs.
+func reportsAsMarkdown(infos []AccountInfo) string {
+	var b strings.Builder
+	b.WriteString("| Account | Account Number | Primary VPC | Public Subnets | Private Subnets | Status |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+
+	for _, info := range infos {
+		r := info.asReport()
+
+		status := r.Status
+		if r.Reason != "" {
+			status += ": " + r.Reason
+		}
+
+		cells := []string{
+			r.AccountName,
+			r.AccountNumber,
+			r.VPCID,
+			strings.Join(r.PublicSubnets, ", "),
+			strings.Join(r.PrivateSubnets, ", "),
+			status,
+		}
+		for i, cell := range cells {
+			cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+
+		b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+
+	return b.String()
+}
+
+// reportsAsCSV writes a header row followed by one row per account.
+func reportsAsCSV(w io.Writer, infos []AccountInfo) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"account", "account_number", "vpc_id", "public_subnets", "private_subnets", "status", "reason"})
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		r := info.asReport()
+		err := cw.Write([]string{
+			r.AccountName,
+			r.AccountNumber,
+			r.VPCID,
+			strconv.Itoa(len(r.PublicSubnets)),
+			strconv.Itoa(len(r.PrivateSubnets)),
+			r.Status,
+			r.Reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// printValidation prints PASS or FAIL for each account depending on whether a
+// primary VPC was found, for '-validate-only'. It returns the number of
+// failures.
+func printValidation(w io.Writer, infos []AccountInfo) int {
+	failed := 0
+	for _, info := range infos {
+		if info.Selection.Found {
+			fmt.Fprintf(w, "PASS %s: %s\n", info.AccountName, info.Selection.VPC.VPCID)
+		} else {
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %s\n", info.AccountName, info.Selection.Reason)
+		}
+	}
+
+	return failed
+}
+
+// printPreview prints a concise summary of what would be generated for each
+// account, for '-preview': the chosen VPC and its subnet IDs by tier.
+func printPreview(w io.Writer, infos []AccountInfo, opts RenderOptions) {
+	for _, info := range infos {
+		if !info.Selection.Found {
+			fmt.Fprintf(w, "%s (%s): no suitable VPC: %s\n", info.AccountName, info.AccountNumber, info.Selection.Reason)
+			continue
+		}
+
+		vpc := info.Selection.VPC
+		fmt.Fprintf(w, "%s (%s): %s\n", info.AccountName, info.AccountNumber, vpc.VPCID)
+
+		tiers := []struct {
+			name    string
+			subnets []PrismSubnet
+		}{
+			{"public", prism.PublicSubnets(vpc.Subnets)},
+			{"private", prism.PrivateSubnets(vpc.Subnets)},
+			{"reserved", prism.ReservedSubnets(vpc.Subnets)},
+		}
+		for _, tier := range tiers {
+			if len(tier.subnets) == 0 && tier.name == "reserved" {
+				continue
+			}
+
+			ids := subnetIDs(orderSubnets(tier.subnets, opts.SubnetOrder))
+			fmt.Fprintf(w, "  %-9s %s\n", tier.name+":", strings.Join(ids, ", "))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestReportsAsJSONIndentation(t *testing.T) {
+	infos := []AccountInfo{goldenAccountInfo(), goldenAccountInfo()}
+
+	pretty, err := reportsAsJSON(infos, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(pretty, []byte("\n  {\n    \"accountNumber\"")) {
+		t.Errorf("expected indented output, got:\n%s", pretty)
+	}
+
+	compact, err := reportsAsJSON(infos, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.ContainsAny(compact, "\n ") {
+		t.Errorf("expected compact output, got:\n%s", compact)
+	}
+
+	// Both forms hold the same data.
+	var a, b []AccountReport
+	if err := json.Unmarshal(pretty, &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(compact, &b); err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 2 || len(b) != 2 || a[0].VPCID != "vpc-main" || b[0].VPCID != "vpc-main" {
+		t.Errorf("got %v and %v", a, b)
+	}
+}
+
+func TestReportsAsNDJSONIsAlwaysCompact(t *testing.T) {
+	out, err := reportsAsNDJSON([]AccountInfo{goldenAccountInfo(), goldenAccountInfo()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(out, []byte("\n")), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want one per account:\n%s", len(lines), out)
+	}
+	for _, line := range lines {
+		if bytes.Contains(line, []byte(" ")) {
+			t.Errorf("expected a compact line, got %s", line)
+		}
+		var report AccountReport
+		if err := json.Unmarshal(line, &report); err != nil {
+			t.Errorf("line is not a JSON object: %v", err)
+		}
+	}
+}
+
+func TestReportsAsCSVParsesBack(t *testing.T) {
+	var buf bytes.Buffer
+	legacy := goldenNoVPCAccountInfo()
+	legacy.AccountName = `legacy, "tools"`
+	infos := []AccountInfo{goldenAccountInfo(), legacy}
+	if err := reportsAsCSV(&buf, infos); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+len(infos) {
+		t.Fatalf("got %d rows, want a header and one per account", len(rows))
+	}
+
+	header := []string{"account", "account_number", "vpc_id", "public_subnets", "private_subnets", "status", "reason"}
+	if !slices.Equal(rows[0], header) {
+		t.Errorf("got header %v", rows[0])
+	}
+	if want := []string{"deploy-tools", "123456789012", "vpc-main", "3", "3", "matched", ""}; !slices.Equal(rows[1], want) {
+		t.Errorf("got row %v, want %v", rows[1], want)
+	}
+
+	// Fields with commas and quotes survive the round trip.
+	if rows[2][0] != `legacy, "tools"` || rows[2][6] != "no non-default VPC with 3 public and 3 private subnets" {
+		t.Errorf("got row %v", rows[2])
+	}
+}
+
+func TestPrintValidation(t *testing.T) {
+	pass := goldenAccountInfo()
+	fail := goldenNoVPCAccountInfo()
+
+	var buf bytes.Buffer
+	if got := printValidation(&buf, []AccountInfo{pass, fail}); got != 1 {
+		t.Errorf("got %d failures, want 1", got)
+	}
+
+	want := "PASS deploy-tools: " + pass.Selection.VPC.VPCID + "\n" +
+		"FAIL " + fail.AccountName + ": " + fail.Selection.Reason + "\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if got := printValidation(&buf, []AccountInfo{pass}); got != 0 {
+		t.Errorf("got %d failures, want 0", got)
+	}
+}
+
+func TestPrintPreview(t *testing.T) {
+	vpc := testVPC("vpc-a", 2, 2)
+	reserved := testSubnet("vpc-a-reserved-0", false, "eu-west-1c")
+	reserved.Tier = "reserved"
+	vpc.Subnets = append(vpc.Subnets, reserved)
+
+	infos := []AccountInfo{
+		{AccountName: "deploy-tools", AccountNumber: "111", Selection: VPCSelection{VPC: vpc, Found: true}},
+		{AccountName: "frontend", AccountNumber: "222", Selection: VPCSelection{VPC: testVPC("vpc-b", 3, 3), Found: true}},
+		{AccountName: "sandbox", AccountNumber: "333", Selection: VPCSelection{Reason: "no VPCs found"}},
+	}
+
+	var buf bytes.Buffer
+	printPreview(&buf, infos, RenderOptions{SubnetOrder: "id"})
+
+	// The reserved tier is only shown when there are reserved subnets.
+	want := `deploy-tools (111): vpc-a
+  public:   vpc-a-public-0, vpc-a-public-1
+  private:  vpc-a-private-0, vpc-a-private-1
+  reserved: vpc-a-reserved-0
+frontend (222): vpc-b
+  public:   vpc-b-public-0, vpc-b-public-1, vpc-b-public-2
+  private:  vpc-b-private-0, vpc-b-private-1, vpc-b-private-2
+sandbox (333): no suitable VPC: no VPCs found
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
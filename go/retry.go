@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backoff computes exponential retry delays with random jitter, so that many
+// clients failing at the same moment don't all retry in lockstep.
+type Backoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// The fraction by which each delay is randomly varied, between 0 (no
+	// jitter) and 1. With 0.2, a 1s delay becomes anything from 0.8s to 1.2s.
+	Jitter float64
+	// The longest to wait when the server asks for a longer Retry-After, so
+	// that a misbehaving server can't stall the run. Zero means no limit.
+	MaxRetryAfter time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// The default for '-max-retry-after'.
+const defaultMaxRetryAfter = time.Minute
+
+// newBackoff returns a Backoff with its own random source. A fixed seed gives
+// a repeatable sequence of delays.
+func newBackoff(base time.Duration, max time.Duration, jitter float64, seed int64) *Backoff {
+	return &Backoff{
+		BaseDelay:     base,
+		MaxDelay:      max,
+		Jitter:        jitter,
+		MaxRetryAfter: defaultMaxRetryAfter,
+		rand:          rand.New(rand.NewSource(seed)),
+	}
+}
+
+// delay returns how long to wait before retry number 'attempt' (from 0).
+func (b *Backoff) delay(attempt int) time.Duration {
+	d := b.BaseDelay << attempt
+	if d > b.MaxDelay || d <= 0 {
+		d = b.MaxDelay
+	}
+
+	if b.Jitter <= 0 {
+		return d
+	}
+
+	// rand.Rand isn't safe for concurrent use, and requests may be concurrent.
+	b.mu.Lock()
+	r := b.rand.Float64()
+	b.mu.Unlock()
+
+	factor := 1 - b.Jitter + 2*b.Jitter*r
+	return time.Duration(float64(d) * factor)
+}
+
+// isRetryable reports whether a request that failed with err is worth trying
+// again: network errors, rate limiting and server errors are, but client errors
+// and unparseable responses won't fix themselves.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr *NetworkError
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == 429 || statusErr.Code >= 500
+	}
+
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		d := date.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// retryDelay returns how long to wait before retrying after err. A Retry-After
+// from the server takes precedence over the computed backoff, up to
+// backoff.MaxRetryAfter. The bool return value is false if the wait would
+// outlast ctx's deadline, in which case there's no point retrying.
+func retryDelay(ctx context.Context, err error, backoff *Backoff, attempt int) (time.Duration, bool) {
+	delay := backoff.delay(attempt)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		delay = statusErr.RetryAfter
+		if backoff.MaxRetryAfter > 0 && delay > backoff.MaxRetryAfter {
+			delay = backoff.MaxRetryAfter
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && delay > time.Until(deadline) {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// sleep waits for d, returning early with an error if ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffJitterRange(t *testing.T) {
+	const jitter = 0.2
+	backoff := newBackoff(100*time.Millisecond, 2*time.Second, jitter, 42)
+
+	for attempt := 0; attempt < 8; attempt++ {
+		// The un-jittered delay doubles each time, up to the maximum.
+		base := 100 * time.Millisecond << attempt
+		if base > 2*time.Second {
+			base = 2 * time.Second
+		}
+		low := time.Duration(float64(base) * (1 - jitter))
+		high := time.Duration(float64(base) * (1 + jitter))
+
+		// Sample repeatedly, as any one delay could land in range by luck.
+		for i := 0; i < 100; i++ {
+			if d := backoff.delay(attempt); d < low || d > high {
+				t.Fatalf("attempt %d: delay %s outside %s-%s", attempt, d, low, high)
+			}
+		}
+	}
+}
+
+func TestBackoffSeedIsRepeatable(t *testing.T) {
+	a := newBackoff(time.Second, time.Minute, 0.5, 7)
+	b := newBackoff(time.Second, time.Minute, 0.5, 7)
+	c := newBackoff(time.Second, time.Minute, 0.5, 8)
+
+	different := false
+	for attempt := 0; attempt < 5; attempt++ {
+		da, db, dc := a.delay(attempt), b.delay(attempt), c.delay(attempt)
+		if da != db {
+			t.Errorf("attempt %d: same seed gave %s and %s", attempt, da, db)
+		}
+		if da != dc {
+			different = true
+		}
+	}
+
+	if !different {
+		t.Error("different seeds gave the same delays")
+	}
+}
+
+func TestBackoffWithoutJitter(t *testing.T) {
+	backoff := newBackoff(time.Second, 5*time.Second, 0, 1)
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, w := range want {
+		if d := backoff.delay(attempt); d != w {
+			t.Errorf("attempt %d: got %s, want %s", attempt, d, w)
+		}
+	}
+
+	// A shift big enough to overflow is capped rather than going negative.
+	if d := backoff.delay(70); d != 5*time.Second {
+		t.Errorf("attempt 70: got %s, want the maximum", d)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&NetworkError{URL: "u", Err: errors.New("connection refused")}, true},
+		{&StatusError{Code: 503}, true},
+		{&StatusError{Code: 429}, true},
+		{&StatusError{Code: 404}, false},
+		{&ParseError{URL: "u", Err: errors.New("bad json")}, false},
+		{&NetworkError{URL: "u", Err: context.Canceled}, false},
+	}
+
+	for _, test := range tests {
+		if got := isRetryable(test.err); got != test.want {
+			t.Errorf("isRetryable(%v) = %t, want %t", test.err, got, test.want)
+		}
+	}
+}
+
+func TestPrismRetriesServerErrors(t *testing.T) {
+	// Fail the first two requests, then succeed.
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	prism := Prism{BaseURL: server.URL, Client: server.Client(), Retries: 2, Backoff: newBackoff(time.Millisecond, time.Millisecond, 0, 1)}
+	logged := captureLog(t)
+
+	if _, err := prism.getAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("got %d requests, want 3", requests.Load())
+	}
+	if !strings.Contains(logged.String(), "retrying") {
+		t.Errorf("expected a retry warning, got %q", logged)
+	}
+
+	// With no retries left, the last error is returned.
+	requests.Store(0)
+	prism.Retries = 1
+
+	_, err := prism.getAccounts(context.Background())
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("got %v, want the 503", err)
+	}
+}
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{" 3 ", 3 * time.Second, true},
+		{"0", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		// A date that's already passed means retry straight away.
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		got, ok := parseRetryAfter(test.header, now)
+		if got != test.want || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %t; want %s, %t", test.header, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	backoff := newBackoff(time.Second, time.Minute, 0, 1)
+	rateLimited := &StatusError{Code: 429, RetryAfter: 30 * time.Second}
+
+	// Retry-After takes precedence over the backoff...
+	if d, ok := retryDelay(context.Background(), rateLimited, backoff, 0); !ok || d != 30*time.Second {
+		t.Errorf("got %s, %t; want the Retry-After of 30s", d, ok)
+	}
+
+	// ...which is used otherwise...
+	if d, ok := retryDelay(context.Background(), &StatusError{Code: 503}, backoff, 2); !ok || d != 4*time.Second {
+		t.Errorf("got %s, %t; want the backoff of 4s", d, ok)
+	}
+
+	// ...but not if it would outlast the timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, ok := retryDelay(ctx, rateLimited, backoff, 0); ok {
+		t.Error("a wait beyond the deadline should give up")
+	}
+	if d, ok := retryDelay(ctx, &StatusError{Code: 503}, backoff, 0); !ok || d != time.Second {
+		t.Errorf("got %s, %t; want a retry within the deadline", d, ok)
+	}
+
+	// A Retry-After beyond MaxRetryAfter is cut short, unless there's no
+	// limit.
+	sulking := &StatusError{Code: 429, RetryAfter: 24 * time.Hour}
+	if d, ok := retryDelay(context.Background(), sulking, backoff, 0); !ok || d != defaultMaxRetryAfter {
+		t.Errorf("got %s, %t; want the default cap of %s", d, ok, defaultMaxRetryAfter)
+	}
+	backoff.MaxRetryAfter = 0
+	if d, ok := retryDelay(context.Background(), sulking, backoff, 0); !ok || d != 24*time.Hour {
+		t.Errorf("got %s, %t; want the uncapped 24h", d, ok)
+	}
+}
+
+func TestMaxRetryAfterFlag(t *testing.T) {
+	server := newPrismTestServer(t)
+	server.respondWithHeader("/sources/accounts", http.StatusTooManyRequests, "", http.Header{"Retry-After": {"3600"}})
+
+	out, err := runMain(t, "-prism-url", server.URL, "-retries", "1", "-max-retry-after", "10ms")
+	if err == nil {
+		t.Fatalf("expected the rate limited run to fail: %s", out)
+	}
+	if !strings.Contains(out, "retrying "+server.URL+"/sources/accounts in 10ms") {
+		t.Errorf("expected the hour's Retry-After to be capped at 10ms:\n%s", out)
+	}
+	if n := len(server.received()); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+
+	out, err = runMain(t, "-prism-url", server.URL, "-max-retry-after", "-1s")
+	if err == nil || !strings.Contains(out, "-max-retry-after must not be negative") {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
+
+func TestPrismHonoursRetryAfter(t *testing.T) {
+	// Rate limit the first request, then succeed.
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	prism := Prism{BaseURL: server.URL, Client: server.Client(), Retries: 2, Backoff: newBackoff(time.Millisecond, time.Millisecond, 0, 1)}
+	logged := captureLog(t)
+
+	start := time.Now()
+	if _, err := prism.getAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The backoff alone would have retried after a millisecond.
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, before the requested 1s", elapsed)
+	}
+	if !strings.Contains(logged.String(), "retrying") {
+		t.Errorf("expected a retry warning, got %q", logged)
+	}
+
+	// With a timeout shorter than the Retry-After, it fails straight away
+	// rather than waiting.
+	requests.Store(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := prism.getAccounts(ctx)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.RetryAfter != time.Second {
+		t.Fatalf("got %v, want the 429 with its Retry-After", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestRetryWarningWithWarnAsError(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"data": []}`))
+	}))
+	defer server.Close()
+
+	logged := captureLog(t)
+	warnAsError = true
+	t.Cleanup(func() {
+		warnAsError = false
+		promoted.failures = nil
+	})
+
+	prism := Prism{BaseURL: server.URL, Client: server.Client(), Retries: 1, Backoff: newBackoff(time.Millisecond, time.Millisecond, 0, 1)}
+	if _, err := prism.getAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry is a warning like any other, so -warn-as-error fails the run
+	// even though the request eventually succeeded.
+	got := promotedWarnings()
+	if len(got) != 1 || !strings.HasPrefix(got[0].Err.Error(), "retrying "+server.URL) {
+		t.Errorf("got %+v, want the retry recorded", got)
+	}
+	if !strings.Contains(logged.String(), "warning: retrying") {
+		t.Errorf("expected a retry warning, got %q", logged)
+	}
+}
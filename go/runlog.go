@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// The '-log-file' logger, or nil if there isn't one.
+var runLog *slog.Logger
+
+// Whether logVerbose messages also go to the console, i.e. '-verbose'.
+var verboseToConsole bool
+
+// openRunLog creates (or truncates) the '-log-file' and sends everything
+// logged with the standard log package to it as JSON, as well as to the
+// console as usual. If 'redact' is set, account numbers are masked in the
+// file. The returned function closes the file.
+//
+// slog is Go's structured logging package. Rather than converting every
+// log.Printf call, we keep the standard logger and tee its output.
+func openRunLog(path string, redact bool) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = f
+	if redact {
+		w = redactingWriter{w: f}
+	}
+
+	runLog = slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	// The console keeps the standard 'date time message' format, which we
+	// now add ourselves so that the file doesn't get it too.
+	log.SetFlags(0)
+	log.SetOutput(teeWriter{console: os.Stderr, file: runLog})
+
+	return func() error {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+		return f.Close()
+	}, nil
+}
+
+// teeWriter writes each log line to the console and to the run log.
+type teeWriter struct {
+	console io.Writer
+	file    *slog.Logger
+}
+
+func (w teeWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+
+	_, err := fmt.Fprintf(w.console, "%s %s\n", time.Now().Format("2006/01/02 15:04:05"), line)
+	if err != nil {
+		return 0, err
+	}
+
+	w.file.Log(context.Background(), logLevel(line), line)
+	return len(p), nil
+}
+
+// logLevel infers a level from our log message conventions, e.g.
+// 'warning: ...'.
+func logLevel(line string) slog.Level {
+	switch {
+	case strings.HasPrefix(line, "trace:"):
+		return slog.LevelDebug
+	case strings.HasPrefix(line, "warning:"):
+		return slog.LevelWarn
+	case strings.HasPrefix(line, "error:"):
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// logVerbose logs detail that's only wanted on the console with '-verbose',
+// but always goes to the '-log-file'.
+func logVerbose(format string, args ...any) {
+	if verboseToConsole {
+		log.Printf(format, args...)
+	} else if runLog != nil {
+		runLog.Debug(fmt.Sprintf(format, args...))
+	}
+}
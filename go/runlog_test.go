@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	tests := map[string]string{
+		"trace: GET https://prism/vpcs": "DEBUG",
+		"warning: no VPCs":              "WARN",
+		"error: unable to fetch":        "ERROR",
+		"summary: 1 accounts processed": "INFO",
+		"a warning: later in the line":  "INFO",
+	}
+
+	for line, want := range tests {
+		if got := logLevel(line).String(); got != want {
+			t.Errorf("logLevel(%q) = %s, want %s", line, got, want)
+		}
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-a", 1, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	// An existing file is truncated, rather than appended to.
+	path := filepath.Join(t.TempDir(), "run.log")
+	if err := os.WriteFile(path, []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runMain(t, "-prism-url", server.URL, "-log-file", path)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	// Verbose detail goes to the file but not the console.
+	if strings.Contains(out, "deploy-tools (111)") {
+		t.Errorf("unexpected verbose output on the console:\n%s", out)
+	}
+	if !strings.Contains(out, "warning: deploy-tools: ") {
+		t.Errorf("expected the warning on the console:\n%s", out)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	levels := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", scanner.Text(), err)
+		}
+		if entry.Time == "" {
+			t.Errorf("log line %q has no time", scanner.Text())
+		}
+		levels[entry.Msg] = entry.Level
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := levels["deploy-tools (111): 1 VPCs"]; got != "DEBUG" {
+		t.Errorf("got level %q for the VPC count, want DEBUG; log: %v", got, levels)
+	}
+
+	warned := false
+	for msg, level := range levels {
+		if strings.HasPrefix(msg, "warning: deploy-tools: ") && level == "WARN" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Errorf("expected a WARN entry for deploy-tools; log: %v", levels)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Fields whose values come from a fixed set, which reflection can't tell us.
+var schemaEnums = map[string][]string{
+	"status": {StatusMatched, StatusNoVPC},
+}
+
+// jsonSchema builds a JSON Schema for t from its Go type and 'json' struct
+// tags, so that it can't drift from what encoding/json actually produces.
+// Fields tagged 'omitempty' are optional; everything else is required.
+//
+// Go's reflect package is a lot more limited than Scala's macros, but is fine
+// for simple structs like ours.
+func jsonSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Pointer:
+		return jsonSchema(t.Elem())
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			property := jsonSchema(field.Type)
+			if enum, ok := schemaEnums[name]; ok {
+				property["enum"] = enum
+			}
+			properties[name] = property
+
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		panic(fmt.Sprintf("jsonSchema: unsupported type %s", t))
+	}
+}
+
+// printJSONSchema implements the 'json-schema' subcommand, which prints the
+// schema for '-format json' output (or a single account with '-object').
+func printJSONSchema(args []string) {
+	fs := flag.NewFlagSet("json-schema", flag.ExitOnError)
+	object := fs.Bool("object", false, "print the schema for a single account, as in ndjson output and per-account json files")
+	fs.Parse(args)
+
+	schema := jsonSchema(reflect.TypeOf(AccountReport{}))
+	title := "Account report"
+	if !*object {
+		schema = map[string]any{"type": "array", "items": schema}
+		title = "Account reports"
+	}
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = title
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	check(err, "unable to render schema")
+
+	fmt.Fprintln(os.Stdout, string(out))
+}
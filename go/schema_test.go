@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// validate checks a decoded JSON value against the subset of JSON Schema that
+// jsonSchema produces.
+func validate(schema map[string]any, v any, path string) error {
+	if enum, ok := schema["enum"].([]any); ok && slices.IndexFunc(enum, func(e any) bool { return e == v }) == -1 {
+		return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+	}
+
+	switch schema["type"] {
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: want a string, got %T", path, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: want a boolean, got %T", path, v)
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: want an integer, got %v", path, v)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want an array, got %T", path, v)
+		}
+		for i, item := range items {
+			if err := validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want an object, got %T", path, v)
+		}
+		properties := schema["properties"].(map[string]any)
+		for _, name := range schema["required"].([]any) {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %s", path, name)
+			}
+		}
+		for name, value := range object {
+			property, ok := properties[name]
+			if !ok {
+				return fmt.Errorf("%s: unexpected property %s", path, name)
+			}
+			if err := validate(property.(map[string]any), value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unknown schema type %v", path, schema["type"])
+	}
+
+	return nil
+}
+
+func TestJSONSchemaCoversAllFields(t *testing.T) {
+	schema := jsonSchema(reflect.TypeOf(AccountReport{}))
+	properties := schema["properties"].(map[string]any)
+
+	typ := reflect.TypeOf(AccountReport{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, opts, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if _, ok := properties[name]; !ok {
+			t.Errorf("field %s (%s) is missing from the schema", typ.Field(i).Name, name)
+		}
+		if required := slices.Contains(schema["required"].([]string), name); required == strings.Contains(opts, "omitempty") {
+			t.Errorf("field %s has required = %t, but its json tag is %q", name, required, typ.Field(i).Tag.Get("json"))
+		}
+	}
+	if len(properties) != typ.NumField() {
+		t.Errorf("got %d properties for %d fields", len(properties), typ.NumField())
+	}
+}
+
+func TestJSONSchemaTypes(t *testing.T) {
+	type nested struct {
+		Count int `json:"count"`
+	}
+	type example struct {
+		Name     string   `json:"name"`
+		Enabled  bool     `json:"enabled,omitempty"`
+		Tags     []string `json:"tags"`
+		Pointer  *string  `json:"pointer"`
+		Nested   nested   `json:"nested"`
+		Untagged string
+		Ignored  string `json:"-"`
+		private  string
+	}
+
+	got, err := json.Marshal(jsonSchema(reflect.TypeOf(example{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"additionalProperties":false,"properties":{` +
+		`"Untagged":{"type":"string"},` +
+		`"enabled":{"type":"boolean"},` +
+		`"name":{"type":"string"},` +
+		`"nested":{"additionalProperties":false,"properties":{"count":{"type":"integer"}},"required":["count"],"type":"object"},` +
+		`"pointer":{"type":"string"},` +
+		`"tags":{"items":{"type":"string"},"type":"array"}},` +
+		`"required":["name","tags","pointer","nested","Untagged"],"type":"object"}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestJSONSchemaValidatesReports(t *testing.T) {
+	out, err := runMain(t, "json-schema")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(out), &schema); err != nil {
+		t.Fatalf("the schema isn't valid JSON: %v\n%s", err, out)
+	}
+	if schema["title"] != "Account reports" || schema["$schema"] == nil {
+		t.Errorf("unexpected schema header: %v", schema)
+	}
+
+	matched := goldenAccountInfo()
+	matched.Selection.Warning = "only 2 AZs"
+	reports, err := json.Marshal([]AccountReport{matched.asReport(), goldenNoVPCAccountInfo().asReport()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v any
+	if err := json.Unmarshal(reports, &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := validate(schema, v, "$"); err != nil {
+		t.Errorf("reports don't match the schema: %v\n%s", err, reports)
+	}
+
+	// A typo'd status is caught.
+	v.([]any)[0].(map[string]any)["status"] = "matchd"
+	if err := validate(schema, v, "$"); err == nil {
+		t.Error("expected an invalid status to fail validation")
+	}
+
+	out, err = runMain(t, "json-schema", "-object")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if err := json.Unmarshal([]byte(out), &schema); err != nil || schema["type"] != "object" {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
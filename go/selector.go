@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// VPCSelector chooses the primary VPC from an account's VPCs. Like
+// findPrimaryVPC, the bool return value indicates whether a VPC was found, and
+// if not the string explains why.
+//
+// Interfaces in Go are satisfied implicitly - any type with a matching Select
+// method is a VPCSelector, no 'extends' required.
+type VPCSelector interface {
+	Select(VPCs []PrismVPC) (PrismVPC, bool, string)
+}
+
+// SubnetCountSelector picks the VPC based on its number of public and private
+// subnets.
+type SubnetCountSelector struct {
+	Range SubnetRange
+	// If no VPC is within Range, fall back to one with a partial (but
+	// plausible) topology; see partialSubnetRange.
+	Lenient bool
+	// If no VPC is within Range, fall back to one with no public subnets and
+	// at least Range.MinPrivate private ones. There's no maximum, as isolated
+	// VPCs often have more private subnets than the usual three.
+	AllowPrivateOnly bool
+}
+
+// Some older VPCs only span two AZs. They're not ideal but are usable.
+var partialSubnetRange = SubnetRange{MinPublic: 2, MaxPublic: 2, MinPrivate: 2, MaxPrivate: 2}
+
+func (s SubnetCountSelector) Select(VPCs []PrismVPC) (PrismVPC, bool, string) {
+	vpc, ok, reason := findPrimaryVPC(VPCs, s.Range)
+	if ok {
+		return vpc, true, ""
+	}
+
+	if s.Lenient {
+		if vpc, ok, _ := findPrimaryVPC(VPCs, partialSubnetRange); ok {
+			return vpc, true, ""
+		}
+	}
+
+	if s.AllowPrivateOnly {
+		privateOnly := SubnetRange{MinPublic: 0, MaxPublic: 0, MinPrivate: s.Range.MinPrivate, MaxPrivate: -1}
+		if vpc, ok, _ := findPrimaryVPC(VPCs, privateOnly); ok {
+			return vpc, true, ""
+		}
+	}
+
+	return PrismVPC{}, false, reason
+}
+
+// topologyWarning describes how a VPC falls short of SubnetRange r, or returns
+// "" if it doesn't.
+func topologyWarning(vpc PrismVPC, r SubnetRange) string {
+	public, private := prism.CountPublic(vpc.Subnets), prism.CountPrivate(vpc.Subnets)
+	if r.contains(public, private) {
+		return ""
+	}
+
+	azs := map[string]bool{}
+	for _, subnet := range vpc.Subnets {
+		if subnet.AvailabilityZone != "" {
+			azs[subnet.AvailabilityZone] = true
+		}
+	}
+
+	if len(azs) == 0 {
+		return fmt.Sprintf("only %d public and %d private subnets", public, private)
+	}
+
+	return fmt.Sprintf("only %d AZs", len(azs))
+}
+
+// TagSelector picks the first non-default VPC with the given tag value.
+type TagSelector struct {
+	Key   string
+	Value string
+}
+
+func (s TagSelector) Select(VPCs []PrismVPC) (PrismVPC, bool, string) {
+	for _, vpc := range VPCs {
+		if !vpc.IsDefault && vpc.Tags[s.Key] == s.Value {
+			return vpc, true, ""
+		}
+	}
+
+	return PrismVPC{}, false, fmt.Sprintf("no non-default VPC tagged %s=%s", s.Key, s.Value)
+}
+
+// NameSelector picks the VPC whose 'Name' tag is Name. As names are chosen
+// deliberately, a default VPC can match, but several VPCs with the same name
+// are treated as no match rather than guessing.
+type NameSelector struct {
+	Name string
+}
+
+func (s NameSelector) Select(VPCs []PrismVPC) (PrismVPC, bool, string) {
+	matches := []PrismVPC{}
+	for _, vpc := range VPCs {
+		if vpc.Tags["Name"] == s.Name {
+			matches = append(matches, vpc)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return PrismVPC{}, false, fmt.Sprintf("no VPC named %s", s.Name)
+	case 1:
+		return matches[0], true, ""
+	default:
+		return PrismVPC{}, false, fmt.Sprintf("%d VPCs are named %s", len(matches), s.Name)
+	}
+}
+
+// CompositeSelector tries each selector in turn, returning the first match.
+type CompositeSelector []VPCSelector
+
+func (s CompositeSelector) Select(VPCs []PrismVPC) (PrismVPC, bool, string) {
+	reasons := []string{}
+
+	for _, selector := range s {
+		vpc, ok, reason := selector.Select(VPCs)
+		if ok {
+			return vpc, true, ""
+		}
+
+		reasons = append(reasons, reason)
+	}
+
+	return PrismVPC{}, false, strings.Join(reasons, "; ")
+}
+
+// The supported strategies for '-strategy'.
+var selectionStrategies = []string{"subnet-count", "tag", "name"}
+
+// newSelector builds the selector for a comma-separated list of strategies,
+// which are tried in order. If vpcName is set, the name strategy is tried
+// first even if not listed.
+func newSelector(strategies string, subnetRange SubnetRange, tag string, vpcName string, lenient bool, allowPrivateOnly bool) (VPCSelector, error) {
+	selectors := CompositeSelector{}
+
+	list := splitList(strategies)
+	if vpcName != "" && !slices.Contains(list, "name") {
+		list = append([]string{"name"}, list...)
+	}
+
+	for _, strategy := range list {
+		switch strategy {
+		case "subnet-count":
+			selectors = append(selectors, SubnetCountSelector{Range: subnetRange, Lenient: lenient, AllowPrivateOnly: allowPrivateOnly})
+		case "tag":
+			key, value, ok := strings.Cut(tag, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("the tag strategy requires -select-tag key=value")
+			}
+			selectors = append(selectors, TagSelector{Key: key, Value: value})
+		case "name":
+			if vpcName == "" {
+				return nil, fmt.Errorf("the name strategy requires -vpc-name")
+			}
+			selectors = append(selectors, NameSelector{Name: vpcName})
+		default:
+			return nil, fmt.Errorf("unknown strategy %q; valid strategies are: %s", strategy, strings.Join(selectionStrategies, ", "))
+		}
+	}
+
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no selection strategy given")
+	}
+
+	if len(selectors) == 1 {
+		return selectors[0], nil
+	}
+
+	return selectors, nil
+}
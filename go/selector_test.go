@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func taggedVPC(id string, tags map[string]string) PrismVPC {
+	vpc := testVPC(id, 3, 3)
+	vpc.Tags = tags
+	return vpc
+}
+
+func TestSubnetCountSelector(t *testing.T) {
+	selector := SubnetCountSelector{Range: standardSubnetRange}
+
+	if vpc, ok, _ := selector.Select([]PrismVPC{testVPC("vpc-a", 2, 2), testVPC("vpc-b", 3, 3)}); !ok || vpc.VPCID != "vpc-b" {
+		t.Errorf("got %q, %v; want vpc-b", vpc.VPCID, ok)
+	}
+	if _, ok, reason := selector.Select([]PrismVPC{testVPC("vpc-a", 2, 2)}); ok || reason != "no non-default VPC with 3 public and 3 private subnets" {
+		t.Errorf("got %v, %q", ok, reason)
+	}
+}
+
+func TestLenientSubnetCountSelector(t *testing.T) {
+	selector := SubnetCountSelector{Range: standardSubnetRange, Lenient: true}
+
+	// A standard VPC still wins over a two-AZ one.
+	if vpc, ok, _ := selector.Select([]PrismVPC{testVPC("vpc-a", 2, 2), testVPC("vpc-b", 3, 3)}); !ok || vpc.VPCID != "vpc-b" {
+		t.Errorf("got %q, %v; want vpc-b", vpc.VPCID, ok)
+	}
+
+	// Without one, the two-AZ VPC is accepted...
+	if vpc, ok, _ := selector.Select([]PrismVPC{testVPC("vpc-a", 2, 2)}); !ok || vpc.VPCID != "vpc-a" {
+		t.Errorf("got %q, %v; want vpc-a", vpc.VPCID, ok)
+	}
+
+	// ...but not anything less plausible, which keeps the strict reason.
+	if _, ok, reason := selector.Select([]PrismVPC{testVPC("vpc-a", 1, 1), testVPC("vpc-b", 2, 3)}); ok || reason != "no non-default VPC with 3 public and 3 private subnets" {
+		t.Errorf("got %v, %q", ok, reason)
+	}
+
+	if s, err := newSelector("subnet-count", standardSubnetRange, "", "", true, false); err != nil || s != (SubnetCountSelector{Range: standardSubnetRange, Lenient: true}) {
+		t.Errorf("got %#v, %v", s, err)
+	}
+}
+
+func TestPrivateOnlySubnetCountSelector(t *testing.T) {
+	isolated := testVPC("vpc-isolated", 0, 3)
+
+	// Without the flag, the private-only VPC is reported distinctly.
+	strict := SubnetCountSelector{Range: standardSubnetRange}
+	if _, ok, reason := strict.Select([]PrismVPC{isolated}); ok || reason != "no public subnets found in VPC vpc-isolated (private subnets: 3)" {
+		t.Errorf("got %v, %q", ok, reason)
+	}
+	if _, ok, reason := strict.Select([]PrismVPC{testVPC("vpc-one", 0, 1)}); ok || reason != "no public subnets found in VPC vpc-one (private subnets: 1)" {
+		t.Errorf("got %v, %q", ok, reason)
+	}
+
+	selector := SubnetCountSelector{Range: standardSubnetRange, AllowPrivateOnly: true}
+
+	// A standard VPC still wins.
+	if vpc, ok, _ := selector.Select([]PrismVPC{isolated, testVPC("vpc-b", 3, 3)}); !ok || vpc.VPCID != "vpc-b" {
+		t.Errorf("got %q, %v; want vpc-b", vpc.VPCID, ok)
+	}
+	if vpc, ok, reason := selector.Select([]PrismVPC{isolated}); !ok || vpc.VPCID != "vpc-isolated" || reason != "" {
+		t.Errorf("got %q, %v, %q; want vpc-isolated", vpc.VPCID, ok, reason)
+	}
+
+	// There's no upper limit on the private subnets, but there must be at
+	// least the minimum.
+	if vpc, ok, _ := selector.Select([]PrismVPC{testVPC("vpc-six", 0, 6)}); !ok || vpc.VPCID != "vpc-six" {
+		t.Errorf("got %q, %v; want vpc-six", vpc.VPCID, ok)
+	}
+	if _, ok, _ := selector.Select([]PrismVPC{testVPC("vpc-two", 0, 2)}); ok {
+		t.Error("accepted a VPC with 2 private subnets")
+	}
+
+	// An empty public array is rendered.
+	info := goldenAccountInfo()
+	info.Selection = VPCSelection{VPC: isolated, Found: true}
+	if ts := info.asTypescriptTemplate(RenderOptions{}); !strings.Contains(ts, "publicSubnets: []") {
+		t.Errorf("expected an empty public array:\n%s", ts)
+	}
+
+	if s, err := newSelector("subnet-count", standardSubnetRange, "", "", false, true); err != nil || s != (SubnetCountSelector{Range: standardSubnetRange, AllowPrivateOnly: true}) {
+		t.Errorf("got %#v, %v", s, err)
+	}
+}
+
+func TestTopologyWarning(t *testing.T) {
+	noAZs := testVPC("vpc-a", 2, 2)
+	for i := range noAZs.Subnets {
+		noAZs.Subnets[i].AvailabilityZone = ""
+	}
+
+	tests := []struct {
+		name string
+		vpc  PrismVPC
+		want string
+	}{
+		{"standard", testVPC("vpc-a", 3, 3), ""},
+		{"two AZs", testVPC("vpc-a", 2, 2), "only 2 AZs"},
+		{"unknown AZs", noAZs, "only 2 public and 2 private subnets"},
+	}
+
+	for _, tt := range tests {
+		if got := topologyWarning(tt.vpc, standardSubnetRange); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTagSelector(t *testing.T) {
+	selector := TagSelector{Key: "role", Value: "primary"}
+
+	defaultVPC := taggedVPC("vpc-default", map[string]string{"role": "primary"})
+	defaultVPC.IsDefault = true
+
+	tests := []struct {
+		name   string
+		vpcs   []PrismVPC
+		want   string
+		reason string
+	}{
+		{"match", []PrismVPC{taggedVPC("vpc-a", nil), taggedVPC("vpc-b", map[string]string{"role": "primary"})}, "vpc-b", ""},
+		{"no match", []PrismVPC{taggedVPC("vpc-a", map[string]string{"role": "legacy"})}, "", "no non-default VPC tagged role=primary"},
+		{"default VPC is skipped", []PrismVPC{defaultVPC}, "", "no non-default VPC tagged role=primary"},
+		// If several VPCs have the tag, the first wins.
+		{"ambiguous", []PrismVPC{taggedVPC("vpc-a", map[string]string{"role": "primary"}), taggedVPC("vpc-b", map[string]string{"role": "primary"})}, "vpc-a", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpc, ok, reason := selector.Select(tt.vpcs)
+			if ok != (tt.want != "") || vpc.VPCID != tt.want || reason != tt.reason {
+				t.Errorf("got %q, %v, %q; want %q, %q", vpc.VPCID, ok, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestNameSelector(t *testing.T) {
+	selector := NameSelector{Name: "main"}
+
+	defaultVPC := taggedVPC("vpc-default", map[string]string{"Name": "main"})
+	defaultVPC.IsDefault = true
+
+	tests := []struct {
+		name   string
+		vpcs   []PrismVPC
+		want   string
+		reason string
+	}{
+		{"match", []PrismVPC{taggedVPC("vpc-a", map[string]string{"Name": "legacy"}), taggedVPC("vpc-b", map[string]string{"Name": "main"})}, "vpc-b", ""},
+		{"no match", []PrismVPC{taggedVPC("vpc-a", map[string]string{"Name": "mainframe"}), taggedVPC("vpc-b", nil)}, "", "no VPC named main"},
+		// Names are chosen deliberately, so unlike tags a default VPC can match.
+		{"default VPC", []PrismVPC{defaultVPC}, "vpc-default", ""},
+		{"ambiguous", []PrismVPC{taggedVPC("vpc-a", map[string]string{"Name": "main"}), taggedVPC("vpc-b", map[string]string{"Name": "main"})}, "", "2 VPCs are named main"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpc, ok, reason := selector.Select(tt.vpcs)
+			if ok != (tt.want != "") || vpc.VPCID != tt.want || reason != tt.reason {
+				t.Errorf("got %q, %v, %q; want %q, %q", vpc.VPCID, ok, reason, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestVPCNameFlag(t *testing.T) {
+	named := testVPC("vpc-named", 2, 2)
+	named.Tags = map[string]string{"Name": "main"}
+	vpcs, err := json.Marshal([]PrismVPC{testVPC("vpc-standard", 3, 3), named})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := cannedPrismServer(t, `[{"accountNumber": "111", "accountName": "deploy-tools"}]`, string(vpcs))
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"main", `"vpcId": "vpc-named"`},
+		// Without a match, subnet counting picks the VPC as usual.
+		{"other", `"vpcId": "vpc-standard"`},
+	}
+
+	for _, tt := range tests {
+		out, err := runMain(t, "-prism-url", server.URL, "-format", "json", "-vpc-name", tt.name)
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if !strings.Contains(out, tt.want) {
+			t.Errorf("-vpc-name %s: expected %s in:\n%s", tt.name, tt.want, out)
+		}
+	}
+}
+
+func TestCompositeSelector(t *testing.T) {
+	tagged := taggedVPC("vpc-tagged", map[string]string{"role": "primary"})
+	tagged.Subnets = testVPC("vpc-tagged", 2, 2).Subnets
+	vpcs := []PrismVPC{testVPC("vpc-a", 3, 3), tagged}
+
+	bySubnets := SubnetCountSelector{Range: standardSubnetRange}
+	byTag := TagSelector{Key: "role", Value: "primary"}
+
+	// Selectors are tried in order, so the first to match wins.
+	if vpc, _, _ := (CompositeSelector{byTag, bySubnets}).Select(vpcs); vpc.VPCID != "vpc-tagged" {
+		t.Errorf("tag first: got %q", vpc.VPCID)
+	}
+	if vpc, _, _ := (CompositeSelector{bySubnets, byTag}).Select(vpcs); vpc.VPCID != "vpc-a" {
+		t.Errorf("subnets first: got %q", vpc.VPCID)
+	}
+
+	// Falls through to the next selector when one doesn't match.
+	if vpc, ok, _ := (CompositeSelector{byTag, bySubnets}).Select([]PrismVPC{testVPC("vpc-a", 3, 3)}); !ok || vpc.VPCID != "vpc-a" {
+		t.Errorf("fall through: got %q, %v", vpc.VPCID, ok)
+	}
+
+	// If nothing matches, every reason is given.
+	_, ok, reason := (CompositeSelector{byTag, bySubnets}).Select([]PrismVPC{testVPC("vpc-a", 1, 1)})
+	if ok || reason != "no non-default VPC tagged role=primary; no non-default VPC with 3 public and 3 private subnets" {
+		t.Errorf("got %v, %q", ok, reason)
+	}
+}
+
+func TestNewSelector(t *testing.T) {
+	if s, err := newSelector("subnet-count", standardSubnetRange, "", "", false, false); err != nil || s != (SubnetCountSelector{Range: standardSubnetRange}) {
+		t.Errorf("got %#v, %v", s, err)
+	}
+
+	s, err := newSelector("tag, subnet-count", standardSubnetRange, "role=primary", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	composite, ok := s.(CompositeSelector)
+	if !ok || len(composite) != 2 || composite[0] != (TagSelector{Key: "role", Value: "primary"}) {
+		t.Errorf("got %#v", s)
+	}
+
+	// -vpc-name puts the name strategy first, unless it's already listed.
+	for _, tt := range []struct {
+		strategies string
+		want       CompositeSelector
+	}{
+		{"subnet-count", CompositeSelector{NameSelector{Name: "main"}, SubnetCountSelector{Range: standardSubnetRange}}},
+		{"subnet-count,name", CompositeSelector{SubnetCountSelector{Range: standardSubnetRange}, NameSelector{Name: "main"}}},
+		{"name", nil},
+	} {
+		s, err := newSelector(tt.strategies, standardSubnetRange, "", "main", false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want == nil {
+			if s != (NameSelector{Name: "main"}) {
+				t.Errorf("%q: got %#v", tt.strategies, s)
+			}
+			continue
+		}
+		if composite, ok := s.(CompositeSelector); !ok || !slices.Equal(composite, tt.want) {
+			t.Errorf("%q: got %#v, want %#v", tt.strategies, s, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ strategies, tag, err string }{
+		{"tag", "", "the tag strategy requires -select-tag key=value"},
+		{"tag", "=primary", "the tag strategy requires -select-tag key=value"},
+		{"name", "", "the name strategy requires -vpc-name"},
+		{"count", "", `unknown strategy "count"; valid strategies are: subnet-count, tag, name`},
+		{"", "", "no selection strategy given"},
+	} {
+		if _, err := newSelector(tt.strategies, standardSubnetRange, tt.tag, "", false, false); err == nil || err.Error() != tt.err {
+			t.Errorf("newSelector(%q, %q) error = %v, want %q", tt.strategies, tt.tag, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterruptPrintsPartialSummary(t *testing.T) {
+	// VPC requests hang until the client gives up, so the run is always
+	// mid-fetch when it's interrupted.
+	fetching := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sources/accounts" {
+			fmt.Fprint(w, `{"data": [{"accountNumber": "111", "accountName": "deploy-tools"}]}`)
+			return
+		}
+
+		fetching <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	cmd := mainCommand("-prism-url", server.URL, "-format", "json")
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-fetching:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("timed out waiting for the VPC request")
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 130 {
+		t.Fatalf("got %v, want exit status 130:\n%s", err, &out)
+	}
+	if !strings.Contains(out.String(), "interrupted: results are partial\nsummary: 0 accounts processed, 0 failed\n") {
+		t.Errorf("expected a partial summary, got:\n%s", &out)
+	}
+}
+
+func TestRunSummaryPrintInterrupted(t *testing.T) {
+	var buf bytes.Buffer
+	RunSummary{Processed: 2, Interrupted: true}.print(&buf)
+
+	if want := "interrupted: results are partial\nsummary: 2 accounts processed, 0 failed\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
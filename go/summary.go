@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// AccountFailure records an error processing a single account, so that the
+// rest of the run can continue and all failures be reported at the end.
+type AccountFailure struct {
+	Account string
+	Err     error
+}
+
+// RunSummary collects the outcome of a run.
+type RunSummary struct {
+	Processed int
+	Failures  []AccountFailure
+	// Set if the run was cut short by a signal.
+	Interrupted bool
+}
+
+func (s *RunSummary) fail(account string, err error) {
+	s.Failures = append(s.Failures, AccountFailure{Account: account, Err: err})
+}
+
+func (s RunSummary) print(w io.Writer) {
+	if jsonErrors {
+		// Only the errors, so that each line is a JSON object.
+		if s.Interrupted {
+			writeError(w, context.Canceled, "")
+		}
+		for _, f := range s.Failures {
+			writeError(w, f.Err, f.Account)
+		}
+		return
+	}
+
+	if s.Interrupted {
+		fmt.Fprintln(w, "interrupted: results are partial")
+	}
+
+	fmt.Fprintf(w, "summary: %d accounts processed, %d failed\n", s.Processed, len(s.Failures))
+	for _, f := range s.Failures {
+		writeError(w, f.Err, f.Account)
+	}
+}
+
+// SkippedAccount is an account that was considered but not generated, for
+// '-show-skipped'.
+type SkippedAccount struct {
+	Account string
+	Reason  string
+}
+
+func printSkipped(w io.Writer, skipped []SkippedAccount) {
+	fmt.Fprintf(w, "skipped: %d accounts\n", len(skipped))
+	for _, s := range skipped {
+		fmt.Fprintf(w, "  %s: %s\n", s.Account, s.Reason)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRunSummaryPrint(t *testing.T) {
+	summary := RunSummary{Processed: 3}
+	summary.fail("frontend", errors.New("prism is down"))
+
+	var buf bytes.Buffer
+	summary.print(&buf)
+
+	want := "summary: 3 accounts processed, 1 failed\n  frontend: prism is down\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// failingAccountServer is a Prism with three accounts, where fetching the VPCs
+// for the second one fails.
+func failingAccountServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/sources/accounts":
+			fmt.Fprint(w, `{"data": [
+				{"accountNumber": "111", "accountName": "first"},
+				{"accountNumber": "222", "accountName": "second"},
+				{"accountNumber": "333", "accountName": "third"}
+			]}`)
+		case r.URL.Query().Get("accountId") == "222":
+			http.Error(w, "prism is down", http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, `{"data": {"vpcs": []}}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestContinueOnError(t *testing.T) {
+	server := failingAccountServer(t)
+
+	out, err := runMain(t, "-prism-url", server.URL, "-accounts", "first,second,third", "-per-account-vpcs", "-concurrency", "1", "-format", "json")
+	if err == nil {
+		t.Fatalf("expected a non-zero exit:\n%s", out)
+	}
+
+	// The other accounts are still rendered, and the failure reported at the
+	// end.
+	for _, want := range []string{`"accountName": "first"`, `"accountName": "third"`, "summary: 3 accounts processed, 1 failed", "second: unable to get prism vpcs for 222"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	server := failingAccountServer(t)
+
+	out, err := runMain(t, "-prism-url", server.URL, "-accounts", "first,second,third", "-per-account-vpcs", "-concurrency", "1", "-format", "json", "-fail-fast")
+	if err == nil {
+		t.Fatalf("expected a non-zero exit:\n%s", out)
+	}
+
+	if !strings.Contains(out, "unable to fetch vpcs: unable to get prism vpcs for 222") {
+		t.Errorf("expected the second account's error:\n%s", out)
+	}
+	if strings.Contains(out, `"accountName"`) {
+		t.Errorf("expected no output after the failure:\n%s", out)
+	}
+}
+
+func TestPrintSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	printSkipped(&buf, []SkippedAccount{
+		{Account: "typo", Reason: "not found in prism"},
+		{Account: "sandbox", Reason: "in -exclude-accounts"},
+	})
+
+	want := "skipped: 2 accounts\n  typo: not found in prism\n  sandbox: in -exclude-accounts\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestShowSkipped(t *testing.T) {
+	server := cannedPrismServer(t, `[
+		{"accountNumber": "111", "accountName": "deploy-tools"},
+		{"accountNumber": "222", "accountName": "sandbox"},
+		{"accountNumber": "333", "accountName": "frontend"}
+	]`, "[]")
+
+	out, err := runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-accounts", "deploy-tools,sandbox,typo", "-exclude-accounts", "sandbox", "-show-skipped")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+
+	for _, want := range []string{
+		"skipped: 3 accounts\n",
+		"  typo: not found in prism\n",
+		"  sandbox: in -exclude-accounts\n",
+		"  frontend: not requested\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "  deploy-tools: ") {
+		t.Errorf("deploy-tools was generated, so shouldn't be listed:\n%s", out)
+	}
+
+	// Without the flag, nothing is listed.
+	out, err = runMain(t, "-prism-url", server.URL, "-format", "ndjson", "-accounts", "deploy-tools")
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if strings.Contains(out, "skipped:") {
+		t.Errorf("unexpected skipped list:\n%s", out)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/nicl/scala-school-example/prism"
+)
+
+// TemplateData is the data available to a custom '-template-file'. As well as
+// the AccountInfo fields (e.g. '{{.AccountName}}', '{{.Selection.Found}}',
+// '{{.Selection.VPC.VPCID}}'), it has:
+//
+//   - ConstName: the exported constant name, e.g. 'DeployToolsAccount'
+//   - PublicSubnets, PrivateSubnets, ReservedSubnets: the primary VPC's
+//     subnets, ordered as per '-subnet-order' (empty if no VPC was found)
+//   - AvailabilityZones: the distinct AZs of those subnets, sorted (empty if
+//     no VPC was found or Prism is missing AZ data for any of them)
+//   - Vars: the values given with '-var', e.g. '{{.Vars.team}}'
+//
+// Templates can also use these functions:
+//
+//   - camel: converts a hyphenated name to camel case, e.g. '{{camel .AccountName}}'
+//   - tsArray: renders subnets as a Typescript array of IDs, e.g. '{{tsArray .PublicSubnets}}'
+//   - tsStrings: renders strings as a Typescript array, e.g. '{{tsStrings .AvailabilityZones}}'
+type TemplateData struct {
+	AccountInfo
+	ConstName       string
+	PublicSubnets   []PrismSubnet
+	PrivateSubnets  []PrismSubnet
+	ReservedSubnets []PrismSubnet
+	// Use with tsStrings, e.g. '{{tsStrings .AvailabilityZones}}'.
+	AvailabilityZones []string
+	Vars              map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"camel":     camelCase,
+	"tsArray":   subnetsAsTypescriptArray,
+	"tsStrings": asTypescriptStringArray,
+}
+
+func loadTemplateFile(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(path).Funcs(templateFuncs).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse template %s: %w", path, err)
+	}
+
+	return tmpl, nil
+}
+
+func (info AccountInfo) templateData(opts RenderOptions) TemplateData {
+	data := TemplateData{
+		AccountInfo:       info,
+		ConstName:         info.constName(opts),
+		PublicSubnets:     []PrismSubnet{},
+		PrivateSubnets:    []PrismSubnet{},
+		ReservedSubnets:   []PrismSubnet{},
+		AvailabilityZones: []string{},
+		Vars:              opts.Vars,
+	}
+
+	if info.Selection.Found {
+		data.PublicSubnets = orderSubnets(prism.PublicSubnets(info.Selection.VPC.Subnets), opts.SubnetOrder)
+		data.PrivateSubnets = orderSubnets(prism.PrivateSubnets(info.Selection.VPC.Subnets), opts.SubnetOrder)
+		data.ReservedSubnets = orderSubnets(prism.ReservedSubnets(info.Selection.VPC.Subnets), opts.SubnetOrder)
+		if azs, ok := knownAvailabilityZones(info.Selection.VPC); ok {
+			data.AvailabilityZones = azs
+		}
+	}
+
+	return data
+}
+
+// varsFlag collects repeated '-var key=value' flags, for templates to use as
+// '{{.Vars.key}}'. Like headerFlag, it implements flag.Value.
+type varsFlag struct {
+	vars map[string]string
+}
+
+func (f *varsFlag) String() string {
+	if f.vars == nil {
+		return ""
+	}
+
+	pairs := []string{}
+	for _, key := range sortedKeys(f.vars) {
+		pairs = append(pairs, key+"="+f.vars[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func (f *varsFlag) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("var %q must be of the form 'key=value'", s)
+	}
+
+	// Keys are restricted to what templates can use after '.Vars.', so
+	// that every var can actually be referenced.
+	if !varKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid var name %q: must be letters, digits and underscores, not starting with a digit", key)
+	}
+
+	if _, exists := f.vars[key]; exists {
+		return fmt.Errorf("var %s is set more than once", key)
+	}
+
+	if f.vars == nil {
+		f.vars = map[string]string{}
+	}
+	f.vars[key] = value
+
+	return nil
+}
+
+var varKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// varsComment lists the '-var' values as Typescript comments, sorted by key
+// and followed by a blank line, for the built-in output, which isn't a
+// template. It's empty if there are no vars.
+func varsComment(vars map[string]string) string {
+	if len(vars) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, key := range sortedKeys(vars) {
+		// A newline in the value would end the comment.
+		fmt.Fprintf(&b, "// %s: %s\n", key, strings.ReplaceAll(vars[key], "\n", " "))
+	}
+
+	return b.String() + "\n"
+}
+
+func (info AccountInfo) renderTemplate(w io.Writer, opts RenderOptions) error {
+	return opts.Template.Execute(w, info.templateData(opts))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func writeTemplate(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "custom.tmpl")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCustomTemplateGolden(t *testing.T) {
+	tmpl, err := loadTemplateFile(writeTemplate(t, `// {{.AccountName}} ({{.AccountNumber}})
+export const {{.ConstName}} = {
+    stack: '{{camel .AccountName}}',
+{{- if .Selection.Found}}
+    vpcId: '{{.Selection.VPC.VPCID}}',
+    publicSubnets: {{tsArray .PublicSubnets}},
+    privateSubnets: {{tsArray .PrivateSubnets}},
+{{- end}}
+};
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// generate rejects names that aren't valid identifiers.
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+
+	opts := RenderOptions{Template: tmpl, ConstPrefix: "gen"}
+	for name, info := range map[string]AccountInfo{
+		"custom-template.ts":        goldenAccountInfo(),
+		"custom-template-no-vpc.ts": noVPC,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := info.Render(&buf, opts); err != nil {
+				t.Fatal(err)
+			}
+			assertGolden(t, name, buf.Bytes())
+		})
+	}
+}
+
+func TestLoadTemplateFileErrors(t *testing.T) {
+	if _, err := loadTemplateFile(filepath.Join(t.TempDir(), "missing.tmpl")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	if _, err := loadTemplateFile(writeTemplate(t, "{{.AccountName")); err == nil || !strings.Contains(err.Error(), "unable to parse template") {
+		t.Errorf("got %v, want a parse error", err)
+	}
+
+	// Unknown functions are caught when parsing, not per account.
+	if _, err := loadTemplateFile(writeTemplate(t, "{{snake .AccountName}}")); err == nil {
+		t.Error("expected an error for an unknown function")
+	}
+
+	// Unknown fields only show up when rendering.
+	tmpl, err := loadTemplateFile(writeTemplate(t, "{{.Typo}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := goldenAccountInfo().Render(&bytes.Buffer{}, RenderOptions{Template: tmpl}); err == nil {
+		t.Error("expected an error rendering an unknown field")
+	}
+}
+
+func TestTemplateVars(t *testing.T) {
+	tmpl, err := loadTemplateFile(writeTemplate(t, "// Owned by {{.Vars.team}} ({{.Vars.ticket}})\nexport const {{.ConstName}} = {};\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var vars varsFlag
+	for _, v := range []string{"team=platform", "ticket=OPS-123"} {
+		if err := vars.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := goldenAccountInfo().Render(&buf, RenderOptions{Template: tmpl, Vars: vars.vars}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "// Owned by platform (OPS-123)\nexport const DeployToolsAccount = {};\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+
+	// A var that wasn't given is an error, rather than '<no value>'.
+	if err := goldenAccountInfo().Render(&bytes.Buffer{}, RenderOptions{Template: tmpl}); err == nil {
+		t.Error("expected an error for a missing var")
+	}
+
+	// The no-VPC comment can use them too.
+	comment, err := template.New("no-vpc-comment").Option("missingkey=error").Parse("// No VPC: ask {{.Vars.team}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noVPC := goldenNoVPCAccountInfo()
+	noVPC.AccountName = "legacy-tools"
+	buf.Reset()
+	if err := noVPC.Render(&buf, RenderOptions{NoVPCComment: comment, Vars: vars.vars}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "    // No VPC: ask platform\n") {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+
+	// The built-in output isn't a template, so lists them in a comment.
+	assertGolden(t, "typescript-vars.ts", []byte(goldenAccountInfo().asTypescriptTemplate(RenderOptions{Vars: vars.vars})))
+	compact := goldenAccountInfo().asTypescriptTemplate(RenderOptions{Compact: true, Vars: vars.vars})
+	if !strings.Contains(compact, "\n\n// team: platform\n// ticket: OPS-123\n\nexport const") {
+		t.Errorf("expected the vars in the compact output:\n%s", compact)
+	}
+	if got := varsComment(map[string]string{"note": "two\nlines"}); got != "// note: two lines\n\n" {
+		t.Errorf("got %q, want the value on one line", got)
+	}
+	if got := varsComment(nil); got != "" {
+		t.Errorf("got %q for no vars", got)
+	}
+}
+
+func TestVarsFlag(t *testing.T) {
+	var vars varsFlag
+	if vars.String() != "" {
+		t.Errorf("got %q for no vars", vars.String())
+	}
+
+	for _, v := range []string{"team=platform", "_ticket2=OPS-1=2", "empty="} {
+		if err := vars.Set(v); err != nil {
+			t.Errorf("Set(%q): %v", v, err)
+		}
+	}
+	if want := "_ticket2=OPS-1=2, empty=, team=platform"; vars.String() != want {
+		t.Errorf("got %q, want %q", vars.String(), want)
+	}
+
+	for _, tt := range []struct{ value, err string }{
+		{"team", `var "team" must be of the form 'key=value'`},
+		{"=platform", `invalid var name "": must be letters, digits and underscores, not starting with a digit`},
+		{"2team=platform", `invalid var name "2team"`},
+		{"team-name=platform", `invalid var name "team-name"`},
+		{"team.name=platform", `invalid var name "team.name"`},
+		{"team=other", "var team is set more than once"},
+	} {
+		if err := vars.Set(tt.value); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Set(%q) = %v, want %q", tt.value, err, tt.err)
+		}
+	}
+
+	out, err := runMain(t, "-var", "bad key=x")
+	if err == nil || !strings.Contains(out, `invalid var name "bad key"`) {
+		t.Errorf("got %v: %s", err, out)
+	}
+}
@@ -0,0 +1,12 @@
+import { Vpc } from 'aws-cdk-lib/aws-ec2';
+import type { IVpc } from 'aws-cdk-lib/aws-ec2';
+import type { Construct } from 'constructs';
+
+export function primaryVpcForDeployToolsAccount(scope: Construct): IVpc {
+    return Vpc.fromVpcAttributes(scope, 'Primary', {
+        vpcId: 'vpc-main',
+        publicSubnetIds: ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'],
+        privateSubnetIds: ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'],
+    });
+}
+
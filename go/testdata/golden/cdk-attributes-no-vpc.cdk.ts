@@ -0,0 +1,2 @@
+// No suitable VPC found for legacy-tools: no non-default VPC with 3 public and 3 private subnets
+
@@ -0,0 +1,4 @@
+// legacy-tools (210987654321)
+export const genLegacyToolsAccount = {
+    stack: 'LegacyTools',
+};
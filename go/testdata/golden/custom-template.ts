@@ -0,0 +1,7 @@
+// deploy-tools (123456789012)
+export const genDeployToolsAccount = {
+    stack: 'DeployTools',
+    vpcId: 'vpc-main',
+    publicSubnets: ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'],
+    privateSubnets: ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'],
+};
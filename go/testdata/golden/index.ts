@@ -0,0 +1,2 @@
+export { DeployToolsAccount } from './DeployTools';
+export { LegacyToolsAccount } from './LegacyTools';
@@ -0,0 +1,27 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        primary: {
+            privateSubnets: [
+                'subnet-priv-a', // private, eu-west-1a
+                'subnet-priv-b', // private, eu-west-1b
+                'subnet-priv-c', // private, eu-west-1c
+            ],
+            publicSubnets: [
+                'subnet-pub-a', // public, eu-west-1a
+                'subnet-pub-b', // public, eu-west-1b
+                'subnet-pub-c', // public, eu-west-1c
+            ],
+            availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+        },
+    },
+};
@@ -0,0 +1,8 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const DeployToolsAccount: Partial<AwsAccountSetupProps> = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    vpc: { primary: { privateSubnets: ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'], publicSubnets: ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'] } },
+};
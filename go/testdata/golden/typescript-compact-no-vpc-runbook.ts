@@ -0,0 +1,9 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const LegacyToolsAccount: Partial<AwsAccountSetupProps> = {
+    accountNumber: '210987654321',
+    accountName: 'legacy-tools',
+    stack: 'LegacyTools',
+    // No suitable VPC for legacy-tools (210987654321): no VPCs found.
+    // See https://example.com/runbooks/vpc
+};
@@ -0,0 +1,8 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const LegacyToolsAccount: Partial<AwsAccountSetupProps> = {
+    accountNumber: '210987654321',
+    accountName: 'legacy-tools',
+    stack: 'LegacyTools',
+    // No suitable VPC found: no non-default VPC with 3 public and 3 private subnets
+};
@@ -0,0 +1,19 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const DeployToolsAccountConfig: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        primary: {
+            privateSubnets: ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'],
+            publicSubnets: ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'],
+            availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+        },
+    },
+};
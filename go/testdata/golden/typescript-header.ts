@@ -0,0 +1,42 @@
+// Generated by scala-school-example v1.2.3
+// Prism: https://prism.gutools.co.uk
+// Primary VPC: vpc-main
+
+import type { AwsAccountSetupProps } from '../types';
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        primary: {
+            privateSubnets: ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'],
+            publicSubnets: ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'],
+            availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+        },
+    },
+};
+
+// Generated by scala-school-example v1.2.3
+// Prism: https://prism.gutools.co.uk
+// Primary VPC: none found
+
+import type { AwsAccountSetupProps } from '../types';
+
+export const LegacyToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '210987654321',
+    accountName: 'legacy-tools',
+    stack: '',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    // No suitable VPC found: no non-default VPC with 3 public and 3 private subnets
+};
+
@@ -0,0 +1,29 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        'eu-west-1': {
+            primary: {
+                privateSubnets: ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'],
+                publicSubnets: ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'],
+                availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+            },
+        },
+        // WARNING: only 2 AZs
+        'us-east-1': {
+            primary: {
+                privateSubnets: ['subnet-us-priv-a', 'subnet-us-priv-b'],
+                publicSubnets: ['subnet-us-pub-a', 'subnet-us-pub-b'],
+                availabilityZones: ['us-east-1a', 'us-east-1b'],
+            },
+        },
+    },
+};
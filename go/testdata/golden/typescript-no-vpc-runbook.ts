@@ -0,0 +1,14 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const LegacyToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '210987654321',
+    accountName: 'legacy-tools',
+    stack: 'LegacyTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    // No suitable VPC for legacy-tools (210987654321): no non-default VPC with 3 public and 3 private subnets.
+    // See https://example.com/runbooks/vpc
+};
@@ -0,0 +1,13 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const LegacyToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '210987654321',
+    accountName: 'legacy-tools',
+    stack: 'LegacyTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    // No suitable VPC found: no non-default VPC with 3 public and 3 private subnets
+};
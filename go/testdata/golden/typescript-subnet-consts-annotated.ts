@@ -0,0 +1,30 @@
+import type { AwsAccountSetupProps } from '../types';
+
+const deployToolsAccountPrivateSubnets = [
+    'subnet-priv-a', // private, eu-west-1a
+    'subnet-priv-b', // private, eu-west-1b
+    'subnet-priv-c', // private, eu-west-1c
+];
+const deployToolsAccountPublicSubnets = [
+    'subnet-pub-a', // public, eu-west-1a
+    'subnet-pub-b', // public, eu-west-1b
+    'subnet-pub-c', // public, eu-west-1c
+];
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        primary: {
+            privateSubnets: deployToolsAccountPrivateSubnets,
+            publicSubnets: deployToolsAccountPublicSubnets,
+            availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+        },
+    },
+};
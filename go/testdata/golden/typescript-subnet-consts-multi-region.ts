@@ -0,0 +1,34 @@
+import type { AwsAccountSetupProps } from '../types';
+
+const deployToolsAccountEuWest1PrivateSubnets = ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'];
+const deployToolsAccountEuWest1PublicSubnets = ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'];
+const deployToolsAccountUsEast1PrivateSubnets = ['subnet-us-priv-a', 'subnet-us-priv-b'];
+const deployToolsAccountUsEast1PublicSubnets = ['subnet-us-pub-a', 'subnet-us-pub-b'];
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        'eu-west-1': {
+            primary: {
+                privateSubnets: deployToolsAccountEuWest1PrivateSubnets,
+                publicSubnets: deployToolsAccountEuWest1PublicSubnets,
+                availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+            },
+        },
+        // WARNING: only 2 AZs
+        'us-east-1': {
+            primary: {
+                privateSubnets: deployToolsAccountUsEast1PrivateSubnets,
+                publicSubnets: deployToolsAccountUsEast1PublicSubnets,
+                availabilityZones: ['us-east-1a', 'us-east-1b'],
+            },
+        },
+    },
+};
@@ -0,0 +1,24 @@
+import type { AwsAccountSetupProps } from '../types';
+
+const genDeployToolsAccountPrivateSubnets = ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'];
+const genDeployToolsAccountPublicSubnets = ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'];
+const genDeployToolsAccountReservedSubnets = ['subnet-res-a', 'subnet-res-b', 'subnet-res-c'];
+
+export const genDeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        primary: {
+            privateSubnets: genDeployToolsAccountPrivateSubnets,
+            publicSubnets: genDeployToolsAccountPublicSubnets,
+            reservedSubnets: genDeployToolsAccountReservedSubnets,
+            availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+        },
+    },
+};
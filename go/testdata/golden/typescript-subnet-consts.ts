@@ -0,0 +1,22 @@
+import type { AwsAccountSetupProps } from '../types';
+
+const deployToolsAccountPrivateSubnets = ['subnet-priv-a', 'subnet-priv-b', 'subnet-priv-c'];
+const deployToolsAccountPublicSubnets = ['subnet-pub-a', 'subnet-pub-b', 'subnet-pub-c'];
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    vpc: {
+        primary: {
+            privateSubnets: deployToolsAccountPrivateSubnets,
+            publicSubnets: deployToolsAccountPublicSubnets,
+            availabilityZones: ['eu-west-1a', 'eu-west-1b', 'eu-west-1c'],
+        },
+    },
+};
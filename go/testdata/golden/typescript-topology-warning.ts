@@ -0,0 +1,20 @@
+import type { AwsAccountSetupProps } from '../types';
+
+export const DeployToolsAccount: AwsAccountSetupProps = {
+    accountNumber: '123456789012',
+    accountName: 'deploy-tools',
+    stack: 'DeployTools',
+    bucketForArtifacts: 'TODO',
+    bucketForPrivateConfig: 'TODO',
+    logging: {
+        streamName: 'TODO',
+    },
+    // WARNING: only 2 AZs
+    vpc: {
+        primary: {
+            privateSubnets: ['vpc-two-az-private-0', 'vpc-two-az-private-1'],
+            publicSubnets: ['vpc-two-az-public-0', 'vpc-two-az-public-1'],
+            availabilityZones: ['eu-west-1a', 'eu-west-1b'],
+        },
+    },
+};